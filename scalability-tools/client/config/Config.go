@@ -14,15 +14,36 @@ type Config struct {
 }
 
 type ClientDefaultConfig struct {
-	Template            string `yaml:"template"`
-	Factory             string `yaml:"factory"`
-	Number              int    `yaml:"numberOfDevices"`
-	DevicesRegisterMode string `yaml:"devicesRegisterMode"`
-	NamePrefix          string `yaml:"namePrefix"`
+	Template            string         `yaml:"template"`
+	Factory             string         `yaml:"factory"`
+	Number              int            `yaml:"numberOfDevices"`
+	DevicesRegisterMode string         `yaml:"devicesRegisterMode"`
+	NamePrefix          string         `yaml:"namePrefix"`
+	RampUp              RampUpDetails  `yaml:"rampUp"`
+	DeviceNetwork       NetworkDetails `yaml:"deviceNetwork"`
+	Classes             []DeviceClass  `yaml:"classes"`
+}
+
+// RampUpDetails represents the arrival profile used by the "ramp" devices registration mode
+type RampUpDetails struct {
+	Profile   string       `yaml:"profile"`   // constant, linear or step
+	StartRate float64      `yaml:"startRate"` // devices per second at the beginning of the ramp
+	EndRate   float64      `yaml:"endRate"`   // devices per second at the end of the ramp (kept afterwards)
+	Duration  TimeDuration `yaml:"duration"`  // time needed to go from startRate to endRate
+	Steps     int          `yaml:"steps"`     // number of rate levels for the step profile
+	Poisson   bool         `yaml:"poisson"`   // use Poisson arrivals instead of evenly spaced ones
+}
+
+// NetworkDetails represents the link of each simulated device, e.g. 2G, LTE or Ethernet. Unset limits are not applied
+type NetworkDetails struct {
+	Downlink Bandwidth    `yaml:"downlink"` // bandwidth received by a device, e.g. 256kbps
+	Uplink   Bandwidth    `yaml:"uplink"`   // bandwidth sent by a device
+	Latency  TimeDuration `yaml:"latency"`  // round trip time added to the connections and to every response
 }
 
 type OutputDefaultConfig struct {
-	Path string `yaml:"path"`
+	Path    string   `yaml:"path"`
+	Formats []string `yaml:"formats"` // text (default), json, csv
 }
 
 // ParseConfig parses the configuration file for the program to use
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// DeviceClass represents a homogeneous group of devices within a heterogeneous fleet, e.g. "8000 DDI pollers + 2000 DMF devices".
+// Each class has its own factory, arguments, simulated behavior and network profile
+type DeviceClass struct {
+	Name          string                 `yaml:"name"` // identifies the class in the statistics, namePrefix by default
+	Template      string                 `yaml:"template"`
+	Factory       string                 `yaml:"factory"`
+	Number        int                    `yaml:"numberOfDevices"`
+	NamePrefix    string                 `yaml:"namePrefix"`
+	Args          map[string]interface{} `yaml:"args"`
+	DummyWork     DummyWorkDetails       `yaml:"dummyWork"`
+	Crash         CrashDetails           `yaml:"crash"`
+	Disconnect    DisconnectDetails      `yaml:"disconnect"`
+	DownloadFault DownloadFaultDetails   `yaml:"downloadFault"`
+	UpdateOutcome UpdateOutcomeDetails   `yaml:"updateOutcome"`
+	DeviceNetwork NetworkDetails         `yaml:"deviceNetwork"`
+}
+
+// HasClasses checks whether the fleet is made of several device classes (client.classes)
+func (c ClientDefaultConfig) HasClasses() bool {
+	return len(c.Classes) > 0
+}
+
+// DeviceClasses returns the device classes of the simulation. Without client.classes, the fleet is a single class
+// described by the client and simulation blocks.
+// With client.classes, numberOfDevices (if set, e.g. by the share of a container) is split across the classes
+// in proportion to their size
+func (c ClientDefaultConfig) DeviceClasses(simulation SimulationConfig) (classes []DeviceClass, err error) {
+	if !c.HasClasses() {
+		return []DeviceClass{{
+			Template:      c.Template,
+			Factory:       c.Factory,
+			Number:        c.Number,
+			NamePrefix:    c.NamePrefix,
+			DummyWork:     simulation.DummyWork,
+			Crash:         simulation.Crash,
+			Disconnect:    simulation.Disconnect,
+			DownloadFault: simulation.DownloadFault,
+			UpdateOutcome: simulation.UpdateOutcome,
+			DeviceNetwork: c.DeviceNetwork,
+		}}, nil
+	}
+
+	names := map[string]struct{}{}
+	prefixes := map[string]struct{}{}
+	for _, class := range c.Classes {
+		if len(class.Name) == 0 {
+			class.Name = class.NamePrefix
+		}
+		if len(class.Template) == 0 {
+			class.Template = c.Template
+		}
+		if len(class.Name) == 0 {
+			return nil, xerrors.Errorf("Missing name or namePrefix of a device class")
+		}
+		if _, ok := names[class.Name]; ok {
+			return nil, xerrors.Errorf("Duplicated device class %s. Set a distinct name or namePrefix to each class", class.Name)
+		}
+		if _, ok := prefixes[class.NamePrefix]; ok {
+			return nil, xerrors.Errorf("Duplicated namePrefix %s of device class %s", class.NamePrefix, class.Name)
+		}
+		if len(class.Factory) == 0 {
+			return nil, xerrors.Errorf("Missing factory of device class %s", class.Name)
+		}
+		if class.Number <= 0 {
+			return nil, xerrors.Errorf("Non-positive client number of device class %s. Got %d", class.Name, class.Number)
+		}
+		names[class.Name] = struct{}{}
+		prefixes[class.NamePrefix] = struct{}{}
+		classes = append(classes, class)
+	}
+
+	if c.Number > 0 {
+		scaleClasses(classes, c.Number)
+	}
+	return classes, nil
+}
+
+// scaleClasses sets the size of the classes so that they sum up to total, keeping their proportions (largest remainder method)
+func scaleClasses(classes []DeviceClass, total int) {
+	sum := 0
+	for _, class := range classes {
+		sum += class.Number
+	}
+	if sum == total {
+		return
+	}
+
+	remainders := make([]int, len(classes))
+	assigned := 0
+	for i := range classes {
+		share := classes[i].Number * total
+		remainders[i] = share % sum
+		classes[i].Number = share / sum
+		assigned += classes[i].Number
+	}
+
+	order := make([]int, len(classes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]] > remainders[order[j]] })
+	for i := 0; i < total-assigned; i++ {
+		classes[order[i]].Number += 1
+	}
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// classNumbers returns the number of devices of each class
+func classNumbers(classes []DeviceClass) []int {
+	numbers := []int{}
+	for _, class := range classes {
+		numbers = append(numbers, class.Number)
+	}
+	return numbers
+}
+
+func TestScaleClasses(t *testing.T) {
+	tests := []struct {
+		name    string
+		numbers []int
+		total   int
+		want    []int
+	}{
+		{"unchanged", []int{8000, 2000}, 10000, []int{8000, 2000}},
+		{"scaled down", []int{8000, 2000}, 10, []int{8, 2}},
+		{"scaled up", []int{8, 2}, 10000, []int{8000, 2000}},
+		{"largest remainder", []int{1, 1, 1}, 10, []int{4, 3, 3}},
+		{"largest remainder not first", []int{1, 2}, 4, []int{1, 3}},
+		{"remainders in order of the classes", []int{3, 3, 3, 1}, 7, []int{2, 2, 2, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			classes := []DeviceClass{}
+			for _, number := range test.numbers {
+				classes = append(classes, DeviceClass{Number: number})
+			}
+			scaleClasses(classes, test.total)
+			if got := classNumbers(classes); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDeviceClasses(t *testing.T) {
+	simulation := SimulationConfig{DummyWork: DummyWorkDetails{AffectedNum: 3}}
+
+	// a homogeneous fleet is a single class described by the client block
+	client := ClientDefaultConfig{Template: "hawkbit", Factory: "ddi", Number: 10, NamePrefix: "ddi"}
+	classes, err := client.DeviceClasses(simulation)
+	if err != nil {
+		t.Fatalf("DeviceClasses: %s", err)
+	}
+	want := []DeviceClass{{Template: "hawkbit", Factory: "ddi", Number: 10, NamePrefix: "ddi", DummyWork: simulation.DummyWork}}
+	if !reflect.DeepEqual(classes, want) {
+		t.Errorf("got classes %+v, want %+v", classes, want)
+	}
+
+	// the classes take the template of the client block and their name prefix as name, and are scaled to the client number
+	client.Classes = []DeviceClass{
+		{Factory: "ddi", Number: 8000, NamePrefix: "ddi"},
+		{Name: "dmf devices", Template: "hawkbit2", Factory: "dmf", Number: 2000, NamePrefix: "dmf"},
+	}
+	classes, err = client.DeviceClasses(simulation)
+	if err != nil {
+		t.Fatalf("DeviceClasses: %s", err)
+	}
+	want = []DeviceClass{
+		{Name: "ddi", Template: "hawkbit", Factory: "ddi", Number: 8, NamePrefix: "ddi"},
+		{Name: "dmf devices", Template: "hawkbit2", Factory: "dmf", Number: 2, NamePrefix: "dmf"},
+	}
+	if !reflect.DeepEqual(classes, want) {
+		t.Errorf("got classes %+v, want %+v", classes, want)
+	}
+
+	// without client number, the classes keep their size
+	client.Number = 0
+	classes, _ = client.DeviceClasses(simulation)
+	if got := classNumbers(classes); !reflect.DeepEqual(got, []int{8000, 2000}) {
+		t.Errorf("got class sizes %v without client number, want [8000 2000]", got)
+	}
+}
+
+func TestDeviceClassesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		classes []DeviceClass
+	}{
+		{"missing name", []DeviceClass{{Factory: "ddi", Number: 1}}},
+		{"duplicated name", []DeviceClass{{Name: "a", Factory: "ddi", Number: 1, NamePrefix: "a"}, {Name: "a", Factory: "ddi", Number: 1, NamePrefix: "b"}}},
+		{"duplicated name prefix", []DeviceClass{{Name: "a", Factory: "ddi", Number: 1, NamePrefix: "p"}, {Name: "b", Factory: "ddi", Number: 1, NamePrefix: "p"}}},
+		{"missing factory", []DeviceClass{{NamePrefix: "ddi", Number: 1}}},
+		{"non-positive number", []DeviceClass{{NamePrefix: "ddi", Factory: "ddi"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := ClientDefaultConfig{Classes: test.classes}
+			if _, err := client.DeviceClasses(SimulationConfig{}); err == nil {
+				t.Error("got no error, want an invalid class error")
+			}
+		})
+	}
+}
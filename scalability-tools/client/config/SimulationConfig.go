@@ -5,15 +5,20 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v3"
 )
 
 // SimulationConfig represents the device-side simulation related configuration
 type SimulationConfig struct {
-	Task      string           `yaml:"task"`
-	DummyWork DummyWorkDetails `yaml:"dummyWork"`
-	Crash     CrashDetails     `yaml:"crash"`
-	Seed      int64            `yaml:"seed"`
+	Task          string               `yaml:"task"`
+	DummyWork     DummyWorkDetails     `yaml:"dummyWork"`
+	Crash         CrashDetails         `yaml:"crash"`
+	Disconnect    DisconnectDetails    `yaml:"disconnect"`
+	DownloadFault DownloadFaultDetails `yaml:"downloadFault"`
+	UpdateOutcome UpdateOutcomeDetails `yaml:"updateOutcome"`
+	Seed          int64                `yaml:"seed"`
+	Assertions    AssertionsDetails    `yaml:"assertions"`
 }
 
 // SimulationDetails represents the details of device-side simulation related configuration
@@ -25,14 +30,87 @@ type DummyWorkDetails struct {
 	Period      TimeDuration `yaml:"period"`
 }
 
+// CrashDetails represents the devices crashes. Without reboot, a crashed device is dead for the rest of the simulation.
+// With reboot, it stays offline for the downtime, then it is recreated and resumes its task
 type CrashDetails struct {
+	AffectedNum       int          `yaml:"number"`
+	Percentage        Percentage   `yaml:"percent"`
+	Within            TimeDuration `yaml:"within"`
+	Reboot            bool         `yaml:"reboot"`
+	Downtime          TimeDuration `yaml:"downtime"`
+	DowntimeVariation TimeDuration `yaml:"downtimeVariation"`
+	Reboots           int          `yaml:"reboots"` // number of crashes of each affected device, 1 by default
+}
+
+// DisconnectDetails represents the network partitions of the devices. An affected device loses its connectivity
+// for the duration, one or more times during its task. Several short disconnections simulate a flapping link
+type DisconnectDetails struct {
 	AffectedNum int          `yaml:"number"`
 	Percentage  Percentage   `yaml:"percent"`
-	Within      TimeDuration `yaml:"within"`
+	Within      TimeDuration `yaml:"within"` // from the start of the main task to the first disconnection
+	Duration    TimeDuration `yaml:"duration"`
+	Variation   TimeDuration `yaml:"variation"`
+	Times       int          `yaml:"times"`  // number of disconnections of each affected device, 1 by default
+	Period      TimeDuration `yaml:"period"` // connected time between two disconnections
+}
+
+// DownloadFaultDetails represents the devices receiving altered files, to exercise the failure paths of the update
+type DownloadFaultDetails struct {
+	AffectedNum int        `yaml:"number"`
+	Percentage  Percentage `yaml:"percent"`
+	Mode        string     `yaml:"mode"` // corrupt (default), truncate or mixed
+}
+
+// UpdateOutcomeDetails represents how the updates end on the devices. Each device draws its outcome from the probabilities
+// and its installation and reboot durations from the distributions. Devices that are not failing nor denying install the update
+type UpdateOutcomeDetails struct {
+	InstallFailure   Percentage          `yaml:"installFailure"` // probability that the installation fails
+	Denied           Percentage          `yaml:"denied"`         // probability that the device denies the update
+	Warning          Percentage          `yaml:"warning"`        // probability that the installation ends with a warning
+	InstallDuration  TimeDuration        `yaml:"installDuration"`
+	InstallVariation TimeDuration        `yaml:"installVariation"`
+	RebootDuration   TimeDuration        `yaml:"rebootDuration"`
+	RebootVariation  TimeDuration        `yaml:"rebootVariation"`
+	Confirmation     ConfirmationDetails `yaml:"confirmation"`
+}
+
+// ConfirmationDetails represents the consent of the users, when the platform asks them to confirm the updates.
+// The denial of the confirmation is independent of the denied outcome of the update
+type ConfirmationDetails struct {
+	DenyProbability Percentage   `yaml:"denyProbability"` // probability that the user denies the update
+	Delay           TimeDuration `yaml:"delay"`           // time taken by the user to confirm or deny the update
+	Variation       TimeDuration `yaml:"variation"`
+}
+
+// IsSet checks whether the outcomes of the updates are modelled
+func (d UpdateOutcomeDetails) IsSet() bool {
+	return d != UpdateOutcomeDetails{}
+}
+
+// Validate checks that the probabilities of the outcomes are consistent
+func (d UpdateOutcomeDetails) Validate() error {
+	for _, p := range []Percentage{d.InstallFailure, d.Denied, d.Warning, d.Confirmation.DenyProbability} {
+		if p < 0 || p > 1 {
+			return xerrors.Errorf("Update outcome probability out of range. Got %.2f%%", float64(p)*100)
+		}
+	}
+	if sum := d.InstallFailure + d.Denied + d.Warning; sum > 1 {
+		return xerrors.Errorf("Update outcome probabilities sum up to more than 100%%. Got %.2f%%", float64(sum)*100)
+	}
+	return nil
+}
+
+// AssertionsDetails represents the service level objectives checked at the end of the simulation.
+// Unset objectives are not evaluated
+type AssertionsDetails struct {
+	MinSuccessRate        *Percentage   `yaml:"minSuccessRate"`        // minimum ratio of devices that finished their task successfully
+	MaxP95TaskTime        *TimeDuration `yaml:"maxP95TaskTime"`        // maximum 95th percentile of the task execution time
+	MaxConnectFailureRate *Percentage   `yaml:"maxConnectFailureRate"` // maximum ratio of devices that failed to connect
 }
 
 type TimeDuration time.Duration
 type Percentage float64
+type Bandwidth float64 // bytes per second
 
 // UnmarshalYAML overwrites the parser for the Pecentage struct
 func (p *Percentage) UnmarshalYAML(value *yaml.Node) error {
@@ -57,3 +135,31 @@ func (p *TimeDuration) UnmarshalYAML(value *yaml.Node) error {
 	*p = TimeDuration(duration)
 	return nil
 }
+
+// bandwidthUnits are the bit rate units accepted by Bandwidth, as used by docker-tc
+var bandwidthUnits = []struct {
+	suffix string
+	bits   float64
+}{
+	{"gbps", 1e9},
+	{"mbps", 1e6},
+	{"kbps", 1e3},
+	{"bps", 1},
+}
+
+// UnmarshalYAML overwrites the parser for the Bandwidth struct. The bandwidth is given as bit rate, e.g. 40mbps
+func (b *Bandwidth) UnmarshalYAML(value *yaml.Node) error {
+	s := strings.ToLower(strings.TrimSpace(value.Value))
+	for _, unit := range bandwidthUnits {
+		if !strings.HasSuffix(s, unit.suffix) {
+			continue
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSuffix(s, unit.suffix), 64)
+		if err != nil {
+			return err
+		}
+		*b = Bandwidth(rate * unit.bits / 8)
+		return nil
+	}
+	return xerrors.Errorf("Invalid bandwidth %s (Expected: <number>bps, kbps, mbps or gbps)", value.Value)
+}
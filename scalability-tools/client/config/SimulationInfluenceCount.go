@@ -2,6 +2,8 @@ package config
 
 // SimulationInfluenceCount represents the customized bound on total number of devices that should be affected
 type SimulationInfluenceCount struct {
-	DummyWork int `json:"dummyWork"`
-	Crash     int `json:"crash"`
+	DummyWork     int `json:"dummyWork"`
+	Crash         int `json:"crash"`
+	Disconnect    int `json:"disconnect"`
+	DownloadFault int `json:"downloadFault"`
 }
@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"hitachienergy/scalability-test-client/config"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/network"
 	"hitachienergy/scalability-test-client/templates"
+	"math"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/panjf2000/ants"
 	"github.com/rs/zerolog"
+	"golang.org/x/xerrors"
 )
 
 /* MEMO
@@ -19,10 +24,29 @@ ants tasks cannot be externally stopped during execution.
 This means that, if a crash happens, the scheduler will complete the current task anyway and then stop.
 Using sync.Once ensure that device lifecycle behaviors are not repeated multiple times but only once.
 
+A rebooted device is a new Device instance driven by the same controller, so that the task and its phases are reported once.
+The instance that crashed may still be running its current ants task: its reports are dropped.
+
 */
 
-type ConnectCallback func(success bool)
+type ConnectCallback func(id string, start time.Time, duration time.Duration, success bool)
 type FinishCallback func(id string, start time.Time, duration time.Duration, success bool)
+type PhaseCallback func(id string, phase string, duration time.Duration)
+type StartCallback func(id string)
+type RequestCallback func(endpoint string, statusCode int, err error)
+type RebootCallback func(id string)
+type CancelCallback func(id string)
+
+// Callbacks groups the functions used by the controllers to report the devices status to the simulator
+type Callbacks struct {
+	Connect   ConnectCallback
+	StartTask StartCallback
+	Phase     PhaseCallback
+	Finish    FinishCallback
+	Request   RequestCallback
+	Reboot    RebootCallback
+	Cancel    CancelCallback
+}
 
 // DeviceController is a unit hold by a device.
 // It contains all simulation information related to the device, and help to report device's status to the simulator
@@ -36,71 +60,135 @@ type DeviceController struct {
 	cancel    context.CancelFunc
 	deviceCtx context.Context
 
-	id              string
-	mainTask        string
-	connectCallback ConnectCallback
-	finishCallback  FinishCallback
+	// used to recreate the device after a crash
+	sharedCtx     context.Context
+	clientFactory templates.DeviceFactory
+	instance      *deviceInstance
+
+	// instanceLock protects the current Device instance, its context and the reboots count, replaced by the crash goroutine
+	instanceLock sync.Mutex
+
+	id        string
+	class     string
+	index     int
+	mainTask  string
+	callbacks Callbacks
 
 	willCrash         bool
 	crashWithin       time.Duration
+	willReboot        bool
+	rebootDowntime    time.Duration
+	maxReboots        int
+	reboots           int
+	disconnectWithin  time.Duration
+	disconnections    []time.Duration // duration of each disconnection of the device
+	disconnectPeriod  time.Duration
+	downloadFault     *fault.Download
+	updateOutcome     fault.UpdateOutcome
 	dummyTaskDuration time.Duration
 	dummyTaskTimeout  time.Duration
 	scheduler         *ants.Pool
+	network           *network.Shaper
+
+	connectStartTime time.Time
+	taskStartTime    time.Time
 
-	taskStartTime time.Time
+	phaseLock     sync.Mutex
+	lastPhaseTime time.Time
+	reachedPhases map[string]struct{}
+
+	stateLock sync.Mutex
+	states    map[string]interface{} // persisted by the Device instances, like the flash memory of a real device
 
 	crashOnce        sync.Once
 	connectOnce      sync.Once
 	startTaskOnce    sync.Once
 	completeTaskOnce sync.Once
+	completed        atomic.Bool
 }
 
 // NewDeviceController creates an instance of the controller
-func NewDeviceController(logger *zerolog.Logger, id string, mainTask string, connectFunc ConnectCallback, finishFunc FinishCallback) *DeviceController {
+func NewDeviceController(logger *zerolog.Logger, id string, mainTask string, callbacks Callbacks) *DeviceController {
 	localLogger := logger.With().Str("object", fmt.Sprintf("device-%s", id)).Logger()
 
 	// scheduler for device tasks execution (real and simulated tasks)
 	s, _ := ants.NewPool(1)
 
 	return &DeviceController{
-		logger:          &localLogger,
-		connectCallback: connectFunc,
-		finishCallback:  finishFunc,
-		id:              id,
-		mainTask:        mainTask,
-		scheduler:       s,
+		logger:        &localLogger,
+		callbacks:     callbacks,
+		reachedPhases: map[string]struct{}{},
+		states:        map[string]interface{}{},
+		id:            id,
+		mainTask:      mainTask,
+		scheduler:     s,
 	}
 }
 
 // NewDevice creates a new Device instance. This instance is internally used and managed by the DeviceController
 func (c *DeviceController) NewDevice(sharedCtx context.Context, clientFactory templates.DeviceFactory) error {
-	c.deviceCtx, c.cancel = context.WithCancel(sharedCtx)
-	device, err := clientFactory.NewDevice(c)
+	c.sharedCtx = sharedCtx
+	c.clientFactory = clientFactory
+	return c.newInstance()
+}
+
+// newInstance creates a new Device instance with its own context, e.g. to reboot the device
+func (c *DeviceController) newInstance() error {
+	ctx, cancel := context.WithCancel(c.sharedCtx)
+	instance := &deviceInstance{DeviceController: c}
+
+	c.instanceLock.Lock()
+	c.deviceCtx, c.cancel = ctx, cancel
+	c.instanceLock.Unlock()
+
+	device, err := c.clientFactory.NewDevice(instance)
 	if err != nil {
 		return err
 	}
+
+	c.instanceLock.Lock()
 	c.Device = device
+	c.instance = instance
+	c.instanceLock.Unlock()
 	return nil
 }
 
 // StartDevice tells the DeviceController to start the device
 func (c *DeviceController) StartDevice() error {
-	return c.Device.Start(c.deviceCtx)
+	c.connectStartTime = time.Now()
+	return c.device().Start(c.context())
 }
 
 // StartDevice tells DeviceController to stop the internal Device instance. If the task has already been completed, this function should have no effect.
 func (c *DeviceController) StopDevice() error {
-	if c.Device != nil {
-		return c.Device.Stop()
+	if device := c.device(); device != nil {
+		return device.Stop()
 	}
 	return nil
 }
 
+// device returns the current Device instance, nil if it was never created
+func (c *DeviceController) device() templates.Device {
+	c.instanceLock.Lock()
+	defer c.instanceLock.Unlock()
+	return c.Device
+}
+
 // GetIdentifier returns the unique Identifier of this controller / device
 func (c *DeviceController) GetIdentifier() string {
 	return c.id
 }
 
+// GetIndex returns the index of the device, as in its identifier
+func (c *DeviceController) GetIndex() int {
+	return c.index
+}
+
+// GetClass returns the name of the device class, empty if the fleet is not made of several classes
+func (c *DeviceController) GetClass() string {
+	return c.class
+}
+
 // GetLogger returns a device-specific logger, which generates formatted logs with the device identifier
 func (c *DeviceController) GetLogger() *zerolog.Logger {
 	return c.logger
@@ -111,6 +199,21 @@ func (c *DeviceController) GetScheduler() *ants.Pool {
 	return c.scheduler
 }
 
+// GetNetwork returns the shaper of the device connections, according to its network profile
+func (c *DeviceController) GetNetwork() *network.Shaper {
+	return c.network
+}
+
+// GetDownloadFault returns the alteration of the files downloaded by the device, nil if the downloads are not altered
+func (c *DeviceController) GetDownloadFault() *fault.Download {
+	return c.downloadFault
+}
+
+// GetUpdateOutcome returns how the update ends on the device
+func (c *DeviceController) GetUpdateOutcome() fault.UpdateOutcome {
+	return c.updateOutcome
+}
+
 // Connect reports to the simulator that the device is connected successfully to the remote platform
 func (c *DeviceController) Connect(success bool) {
 	c.connectOnce.Do(func() {
@@ -119,7 +222,14 @@ func (c *DeviceController) Connect(success bool) {
 		} else {
 			c.logger.Debug().Msgf("%s failed connection to the server", c.id)
 		}
-		c.connectCallback(success)
+		start := c.connectStartTime
+		duration := time.Duration(0)
+		if !start.IsZero() {
+			duration = time.Since(start)
+		} else {
+			start = time.Now() // the device failed before starting
+		}
+		c.callbacks.Connect(c.id, start, duration, success)
 	})
 }
 
@@ -127,7 +237,14 @@ func (c *DeviceController) Connect(success bool) {
 func (c *DeviceController) StartTask() {
 	c.startTaskOnce.Do(func() {
 
+		c.phaseLock.Lock()
 		c.taskStartTime = time.Now()
+		c.lastPhaseTime = c.taskStartTime
+		c.phaseLock.Unlock()
+
+		if c.callbacks.StartTask != nil {
+			c.callbacks.StartTask(c.id)
+		}
 
 		if c.dummyTaskDuration > 0 {
 			c.logger.Debug().Msg("Setup dummy work task...")
@@ -140,32 +257,179 @@ func (c *DeviceController) StartTask() {
 			}()
 		}
 
+		if len(c.disconnections) > 0 {
+			c.logger.Debug().Msg("Setup disconnect task...")
+			go c.disconnectNetwork()
+		}
+
 		if c.willCrash {
 			c.logger.Debug().Msg("Setup crash task...")
-			// crash task is not part of the scheduler
-			go func() {
-				select {
-				case <-time.After(c.crashWithin):
-					c.logger.Debug().Msg("Crash event occurred")
-					c.crashOnce.Do(func() {
-						c.cancel()
-						c.CompleteTask(false)
-					})
-				case <-c.deviceCtx.Done():
-					c.logger.Debug().Msg("Disabled crash event")
-				}
-			}()
+			c.scheduleCrash(c.context())
 		}
 	})
 }
 
+// scheduleCrash crashes the device after crashWithin, unless the device context is done before.
+// The crash task is not part of the scheduler
+func (c *DeviceController) scheduleCrash(ctx context.Context) {
+	go func() {
+		select {
+		case <-time.After(c.crashWithin):
+			c.logger.Debug().Msg("Crash event occurred")
+			if c.willReboot {
+				c.reboot()
+				return
+			}
+			c.crashOnce.Do(func() {
+				c.instanceLock.Lock()
+				c.cancel()
+				c.instanceLock.Unlock()
+				c.CompleteTask(false)
+			})
+		case <-ctx.Done():
+			c.logger.Debug().Msg("Disabled crash event")
+		}
+	}()
+}
+
+// reboot turns the device off for the downtime, then recreates and starts it again.
+// The new Device instance registers to the platform and resumes (or restarts) the task
+func (c *DeviceController) reboot() {
+	if c.completed.Load() {
+		c.logger.Debug().Msg("Task already completed, no reboot needed")
+		return
+	}
+
+	c.instanceLock.Lock()
+	c.instance.crashed.Store(true)
+	c.cancel()
+	c.reboots += 1
+	reboots := c.reboots
+	c.instanceLock.Unlock()
+
+	c.StopDevice()
+	if c.callbacks.Reboot != nil {
+		c.callbacks.Reboot(c.id)
+	}
+	c.logger.Debug().Msgf("Device offline for %s before reboot %d / %d", c.rebootDowntime, reboots, c.maxReboots)
+
+	select {
+	case <-time.After(c.rebootDowntime):
+	case <-c.sharedCtx.Done():
+		c.logger.Debug().Msg("Reboot interrupted")
+		return
+	}
+
+	err := c.newInstance()
+	if err == nil {
+		err = c.StartDevice()
+	}
+	if err != nil {
+		c.logger.Err(err).Msg("Fail to reboot the device")
+		c.CompleteTask(false)
+		return
+	}
+	c.logger.Debug().Msgf("Device rebooted (%d / %d)", reboots, c.maxReboots)
+
+	if reboots < c.maxReboots {
+		c.scheduleCrash(c.context())
+	}
+}
+
+// disconnectNetwork follows the disconnections schedule of the device. The transports notice the partition through the network shaper.
+// The schedule survives the device reboots, and stops once the task is completed
+func (c *DeviceController) disconnectNetwork() {
+	wait := c.disconnectWithin
+	for i, duration := range c.disconnections {
+		select {
+		case <-time.After(wait):
+		case <-c.sharedCtx.Done():
+			return
+		}
+		if c.completed.Load() {
+			return
+		}
+
+		c.logger.Debug().Msgf("Network disconnected for %s (%d / %d)", duration, i+1, len(c.disconnections))
+		c.network.Disconnect()
+		select {
+		case <-time.After(duration):
+		case <-c.sharedCtx.Done():
+		}
+		c.network.Reconnect()
+		c.logger.Debug().Msg("Network reconnected")
+
+		wait = c.disconnectPeriod
+	}
+}
+
+// context returns the context of the current Device instance
+func (c *DeviceController) context() context.Context {
+	c.instanceLock.Lock()
+	defer c.instanceLock.Unlock()
+	return c.deviceCtx
+}
+
+// ReportRequest reports to the simulator the result of a request sent by the device to the platform endpoint
+func (c *DeviceController) ReportRequest(endpoint string, statusCode int, err error) {
+	if c.callbacks.Request != nil {
+		c.callbacks.Request(endpoint, statusCode, err)
+	}
+}
+
+// MarkPhase logs that the target task reached the given phase, e.g. DOWNLOADED.
+// The time elapsed since the previous phase (or the task start) is reported to the simulator. Each phase is reported only once
+func (c *DeviceController) MarkPhase(phase string) {
+	c.phaseLock.Lock()
+	if c.lastPhaseTime.IsZero() {
+		c.phaseLock.Unlock()
+		return
+	}
+	if _, ok := c.reachedPhases[phase]; ok {
+		c.phaseLock.Unlock()
+		return
+	}
+	now := time.Now()
+	duration := now.Sub(c.lastPhaseTime)
+	c.lastPhaseTime = now
+	c.reachedPhases[phase] = struct{}{}
+	c.phaseLock.Unlock()
+
+	c.logger.Debug().Msgf("%s reaches phase %s after %s", c.mainTask, phase, duration)
+	if c.callbacks.Phase != nil {
+		c.callbacks.Phase(c.id, phase, duration)
+	}
+}
+
+// TakeState removes and returns the state persisted by the device under the key, so that a single Device instance owns it
+func (c *DeviceController) TakeState(key string) (state interface{}, ok bool) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	state, ok = c.states[key]
+	delete(c.states, key)
+	return state, ok
+}
+
+// KeepState persists a state of the device under the key, e.g. to resume a download after a reboot.
+// The state is dropped if the task is already completed
+func (c *DeviceController) KeepState(key string, state interface{}) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if c.completed.Load() {
+		return
+	}
+	c.states[key] = state
+}
+
 func (c *DeviceController) dummyWork() {
 	c.scheduler.Submit(func() {
 		c.logger.Debug().Msg("Dummy work in progress...")
 		select {
 		case <-time.After(c.dummyTaskDuration):
 			c.logger.Debug().Msg("Dummy work completed")
-		case <-c.deviceCtx.Done():
+		case <-c.context().Done():
 			c.logger.Debug().Msg("Dummy work interrupted")
 		}
 	})
@@ -173,29 +437,86 @@ func (c *DeviceController) dummyWork() {
 
 // Complete Task logs the target task is completed and reports the details to the simulator
 func (c *DeviceController) CompleteTask(success bool) {
+	c.finishTask(success, false)
+}
+
+// CancelTask logs the target task is cancelled by the platform and reports it to the simulator as an unsuccessful task
+func (c *DeviceController) CancelTask() {
+	c.finishTask(false, true)
+}
+
+// finishTask ends the target task once, whether it is completed or cancelled
+func (c *DeviceController) finishTask(success bool, cancelled bool) {
 	c.completeTaskOnce.Do(func() {
+		c.completed.Store(true)
 		c.scheduler.Release()
 
+		c.stateLock.Lock()
+		c.states = map[string]interface{}{}
+		c.stateLock.Unlock()
+
 		duration := time.Since(c.taskStartTime)
 		result := "fail"
 		if success {
 			result = "success"
+		} else if cancelled {
+			result = "cancelled"
 		}
 		c.logger.Debug().Msgf("%s completes (%s).", c.mainTask, result)
 
-		c.finishCallback(c.id, c.taskStartTime, duration, success)
+		if cancelled && c.callbacks.Cancel != nil {
+			c.callbacks.Cancel(c.id)
+		}
+		c.callbacks.Finish(c.id, c.taskStartTime, duration, success)
 	})
 }
 
+// deviceInstance is the controller given to a single Device instance.
+// Once the instance crashed, its reports are dropped since the device is offline or already replaced by a rebooted instance
+type deviceInstance struct {
+	*DeviceController
+	crashed atomic.Bool
+}
+
+// StartTask implements templates.Controller.StartTask
+func (i *deviceInstance) StartTask() {
+	if !i.crashed.Load() {
+		i.DeviceController.StartTask()
+	}
+}
+
+// MarkPhase implements templates.Controller.MarkPhase
+func (i *deviceInstance) MarkPhase(phase string) {
+	if !i.crashed.Load() {
+		i.DeviceController.MarkPhase(phase)
+	}
+}
+
+// CompleteTask implements templates.Controller.CompleteTask
+func (i *deviceInstance) CompleteTask(success bool) {
+	if !i.crashed.Load() {
+		i.DeviceController.CompleteTask(success)
+	}
+}
+
+// CancelTask implements templates.Controller.CancelTask
+func (i *deviceInstance) CancelTask() {
+	if !i.crashed.Load() {
+		i.DeviceController.CancelTask()
+	}
+}
+
 // configureDeviceCtx is a private function. It will make the shared context per-device base so that the crash of a single device does not affect others
 func (c *DeviceController) configureDeviceCtx(sharedCtx context.Context) context.Context {
+	c.instanceLock.Lock()
+	defer c.instanceLock.Unlock()
 	c.deviceCtx, c.cancel = context.WithCancel(sharedCtx)
 	return c.deviceCtx
 }
 
 // CalculateAndSetController takes the simulation configuration and generates the random dummywork and crash for each device.
-// It returns a list of pre-configured controllers. Each controller should be assigned to a distinct device
-func CalculateAndSetController(config config.Config, offset int, influnceRange config.SimulationInfluenceCount, logger *zerolog.Logger, connectDevice ConnectCallback, finishDevice FinishCallback) (controllers []*DeviceController, err error) {
+// It returns a list of pre-configured controllers, for all the device classes. Each controller should be assigned to a distinct device
+func CalculateAndSetController(config config.Config, offset int, influnceRange config.SimulationInfluenceCount, logger *zerolog.Logger, callbacks Callbacks) (controllers []*DeviceController, err error) {
 	var r *rand.Rand
 	if config.Simulation.Seed != 0 {
 		r = rand.New(rand.NewSource(config.Simulation.Seed))
@@ -203,33 +524,187 @@ func CalculateAndSetController(config config.Config, offset int, influnceRange c
 		r = rand.New(rand.NewSource(time.Now().Unix()))
 	}
 
-	for i := offset; i < offset+config.Client.Number; i++ {
-		controllers = append(controllers, NewDeviceController(logger, fmt.Sprintf("%s%d", config.Client.NamePrefix, i), config.Simulation.Task, connectDevice, finishDevice))
+	classes, err := config.Client.DeviceClasses(config.Simulation)
+	if err != nil {
+		return nil, err
+	}
+	for _, class := range classes {
+		switch class.DownloadFault.Mode {
+		case "", string(fault.CORRUPT), string(fault.TRUNCATE), "mixed":
+		default:
+			return nil, xerrors.Errorf("Unrecognized download fault mode %s", class.DownloadFault.Mode)
+		}
+		err = class.UpdateOutcome.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		// without classes, the devices affected in this container are given by the simulator manager
+		classInfluence := influnceRange
+		if config.Client.HasClasses() {
+			classInfluence = classInfluenceCount(class)
+		}
+		controllers = append(controllers, calculateClassControllers(r, config.Simulation.Task, class, offset, classInfluence, logger, callbacks)...)
+	}
+
+	return controllers, nil
+}
+
+// calculateClassControllers generates the controllers of the devices of a class, with their random dummywork and crash
+func calculateClassControllers(r *rand.Rand, task string, class config.DeviceClass, offset int, influnceRange config.SimulationInfluenceCount, logger *zerolog.Logger, callbacks Callbacks) (controllers []*DeviceController) {
+	profile := network.Profile{
+		Downlink: float64(class.DeviceNetwork.Downlink),
+		Uplink:   float64(class.DeviceNetwork.Uplink),
+		Latency:  time.Duration(class.DeviceNetwork.Latency),
+	}
+	for i := offset; i < offset+class.Number; i++ {
+		controller := NewDeviceController(logger, fmt.Sprintf("%s%d", class.NamePrefix, i), task, callbacks)
+		controller.class = class.Name
+		controller.index = i
+		controller.network = network.NewShaper(profile)
+		controllers = append(controllers, controller)
+	}
+	if len(controllers) > 0 && controllers[0].network.Enabled() {
+		logger.Info().Msgf("Devices network%s. Downlink: %.0f B/s Uplink: %.0f B/s Latency: %s", classLabel(class), profile.Downlink, profile.Uplink, profile.Latency)
 	}
 
 	if influnceRange.DummyWork > 0 {
-		dummyWorkDetail := config.Simulation.DummyWork
-		mask := SelectRandom(r, config.Client.Number, influnceRange.DummyWork)
+		dummyWorkDetail := class.DummyWork
+		mask := SelectRandom(r, class.Number, influnceRange.DummyWork)
 		dummyTaskDuration := GenerateVariation(r, time.Duration(dummyWorkDetail.Duration), time.Duration(dummyWorkDetail.Variation), len(mask))
 		for i, idx := range mask {
-			logger.Info().Msgf("Device %d will run a dummy task. Duration: %d Period: %d ", idx, time.Duration(dummyTaskDuration[i]), time.Duration(dummyWorkDetail.Period))
+			logger.Info().Msgf("Device %s will run a dummy task. Duration: %d Period: %d ", controllers[idx].id, time.Duration(dummyTaskDuration[i]), time.Duration(dummyWorkDetail.Period))
 			controllers[idx].dummyTaskDuration = time.Duration(dummyTaskDuration[i])
 			controllers[idx].dummyTaskTimeout = time.Duration(dummyWorkDetail.Period)
 		}
 	}
 
-	crashDetail := config.Simulation.Crash
+	crashDetail := class.Crash
 	if influnceRange.Crash > 0 {
-		mask := SelectRandom(r, config.Client.Number, influnceRange.Crash)
+		mask := SelectRandom(r, class.Number, influnceRange.Crash)
 		dummyCrashDelay := GenerateDuration(r, time.Duration(crashDetail.Within), len(mask))
+		downtime := GenerateVariation(r, time.Duration(crashDetail.Downtime), time.Duration(crashDetail.DowntimeVariation), len(mask))
+		maxReboots := crashDetail.Reboots
+		if maxReboots <= 0 {
+			maxReboots = 1
+		}
 		for i, idx := range mask {
-			logger.Info().Msgf("Device %d will crash. Within: %d ", idx, time.Duration(dummyCrashDelay[i]))
+			logger.Info().Msgf("Device %s will crash. Within: %d ", controllers[idx].id, time.Duration(dummyCrashDelay[i]))
 			controllers[idx].willCrash = true
 			controllers[idx].crashWithin = time.Duration(dummyCrashDelay[i])
+			if crashDetail.Reboot {
+				controllers[idx].willReboot = true
+				controllers[idx].rebootDowntime = time.Duration(math.Max(downtime[i], 0)) // the variation may lead to a negative downtime
+				controllers[idx].maxReboots = maxReboots
+				logger.Info().Msgf("Device %s will reboot %d time(s). Downtime: %d ", controllers[idx].id, maxReboots, controllers[idx].rebootDowntime)
+			}
 		}
 	}
 
-	return controllers, nil
+	disconnectDetail := class.Disconnect
+	if influnceRange.Disconnect > 0 {
+		mask := SelectRandom(r, class.Number, influnceRange.Disconnect)
+		disconnectDelay := GenerateDuration(r, time.Duration(disconnectDetail.Within), len(mask))
+		times := disconnectDetail.Times
+		if times <= 0 {
+			times = 1
+		}
+		for i, idx := range mask {
+			durations := GenerateVariation(r, time.Duration(disconnectDetail.Duration), time.Duration(disconnectDetail.Variation), times)
+			for _, duration := range durations {
+				controllers[idx].disconnections = append(controllers[idx].disconnections, time.Duration(math.Max(duration, 0)))
+			}
+			controllers[idx].disconnectWithin = time.Duration(disconnectDelay[i])
+			controllers[idx].disconnectPeriod = time.Duration(disconnectDetail.Period)
+			controllers[idx].network.AllowDisconnection()
+			logger.Info().Msgf("Device %s will be disconnected %d time(s). Within: %d Period: %d ", controllers[idx].id, times, time.Duration(disconnectDelay[i]), time.Duration(disconnectDetail.Period))
+		}
+	}
+
+	if influnceRange.DownloadFault > 0 {
+		mask := SelectRandom(r, class.Number, influnceRange.DownloadFault)
+		for _, idx := range mask {
+			mode := fault.DownloadMode(class.DownloadFault.Mode)
+			switch mode {
+			case "", fault.CORRUPT:
+				mode = fault.CORRUPT
+			case "mixed":
+				mode = fault.CORRUPT
+				if r.Intn(2) == 1 {
+					mode = fault.TRUNCATE
+				}
+			}
+			logger.Info().Msgf("Device %s will receive altered files. Mode: %s ", controllers[idx].id, mode)
+			controllers[idx].downloadFault = fault.NewDownload(mode)
+		}
+	}
+
+	outcomeDetail := class.UpdateOutcome
+	if outcomeDetail.IsSet() {
+		installDuration := GenerateVariation(r, time.Duration(outcomeDetail.InstallDuration), time.Duration(outcomeDetail.InstallVariation), len(controllers))
+		rebootDuration := GenerateVariation(r, time.Duration(outcomeDetail.RebootDuration), time.Duration(outcomeDetail.RebootVariation), len(controllers))
+		for i, controller := range controllers {
+			result := fault.OUTCOME_SUCCESS
+			draw := config.Percentage(r.Float64())
+			switch {
+			case draw < outcomeDetail.Denied:
+				result = fault.OUTCOME_DENIED
+			case draw < outcomeDetail.Denied+outcomeDetail.InstallFailure:
+				result = fault.OUTCOME_FAILURE
+			case draw < outcomeDetail.Denied+outcomeDetail.InstallFailure+outcomeDetail.Warning:
+				result = fault.OUTCOME_WARNING
+			}
+			controller.updateOutcome = fault.UpdateOutcome{
+				Result:          result,
+				InstallDuration: time.Duration(math.Max(installDuration[i], 0)),
+				RebootDuration:  time.Duration(math.Max(rebootDuration[i], 0)),
+			}
+			if result != fault.OUTCOME_SUCCESS {
+				logger.Info().Msgf("Device %s update outcome: %s ", controller.id, result)
+			}
+		}
+		// drawn last, so that the outcomes do not depend on the confirmation settings
+		confirmation := outcomeDetail.Confirmation
+		confirmationDelay := GenerateVariation(r, time.Duration(confirmation.Delay), time.Duration(confirmation.Variation), len(controllers))
+		for i, controller := range controllers {
+			controller.updateOutcome.ConfirmationDelay = time.Duration(math.Max(confirmationDelay[i], 0))
+			controller.updateOutcome.DenyConfirmation = config.Percentage(r.Float64()) < confirmation.DenyProbability
+			if controller.updateOutcome.DenyConfirmation {
+				logger.Info().Msgf("Device %s will deny the confirmation ", controller.id)
+			}
+		}
+	}
+
+	return controllers
+}
+
+// classInfluenceCount returns the number of devices of a class affected by each fault
+func classInfluenceCount(class config.DeviceClass) config.SimulationInfluenceCount {
+	return config.SimulationInfluenceCount{
+		DummyWork:     affectedCount(class.DummyWork.AffectedNum, class.DummyWork.Percentage, class.Number),
+		Crash:         affectedCount(class.Crash.AffectedNum, class.Crash.Percentage, class.Number),
+		Disconnect:    affectedCount(class.Disconnect.AffectedNum, class.Disconnect.Percentage, class.Number),
+		DownloadFault: affectedCount(class.DownloadFault.AffectedNum, class.DownloadFault.Percentage, class.Number),
+	}
+}
+
+// affectedCount converts an affected number or percentage of devices to a number of devices, capped to the total
+func affectedCount(number int, percentage config.Percentage, total int) int {
+	if number <= 0 {
+		number = int(float64(percentage) * float64(total))
+	}
+	if number > total {
+		number = total
+	}
+	return number
+}
+
+// classLabel returns the label of a named class for the logs
+func classLabel(class config.DeviceClass) string {
+	if len(class.Name) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (class %s)", class.Name)
 }
 
 // SelectRandom randomly selects k devices from n devices
@@ -0,0 +1,228 @@
+package device
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"hitachienergy/scalability-test-client/templates"
+
+	"github.com/rs/zerolog"
+)
+
+// recorder records the reports of the controllers to the simulator
+type recorder struct {
+	sync.Mutex
+	phases    []string
+	durations map[string]time.Duration
+	finishes  []bool // result of each finished task
+	reboots   int
+}
+
+// results returns the results of the finished tasks and the number of reboots
+func (r *recorder) results() ([]bool, int) {
+	r.Lock()
+	defer r.Unlock()
+	return append([]bool{}, r.finishes...), r.reboots
+}
+
+// newController creates a controller reporting to a new recorder
+func newController(t *testing.T) (*DeviceController, *recorder) {
+	r := &recorder{durations: map[string]time.Duration{}}
+	logger := zerolog.Nop()
+	controller := NewDeviceController(&logger, "device0", "update", Callbacks{
+		Connect: func(id string, start time.Time, duration time.Duration, success bool) {},
+		Phase: func(id string, phase string, duration time.Duration) {
+			r.Lock()
+			defer r.Unlock()
+			r.phases = append(r.phases, phase)
+			r.durations[phase] = duration
+		},
+		Finish: func(id string, start time.Time, duration time.Duration, success bool) {
+			r.Lock()
+			defer r.Unlock()
+			r.finishes = append(r.finishes, success)
+		},
+		Reboot: func(id string) {
+			r.Lock()
+			defer r.Unlock()
+			r.reboots += 1
+		},
+	})
+	t.Cleanup(controller.scheduler.Release)
+	return controller, r
+}
+
+func TestMarkPhase(t *testing.T) {
+	controller, r := newController(t)
+
+	controller.MarkPhase("DOWNLOADING") // before the task start
+	controller.StartTask()
+	time.Sleep(50 * time.Millisecond)
+	controller.MarkPhase("DOWNLOADING")
+	time.Sleep(100 * time.Millisecond)
+	controller.MarkPhase("DOWNLOADED")
+	controller.MarkPhase("DOWNLOADING") // a phase is reported once
+	controller.CompleteTask(true)
+
+	if want := []string{"DOWNLOADING", "DOWNLOADED"}; !reflect.DeepEqual(r.phases, want) {
+		t.Errorf("got phases %v, want %v", r.phases, want)
+	}
+	// the duration of a phase is the time elapsed since the previous phase
+	if d := r.durations["DOWNLOADING"]; d < 50*time.Millisecond || d >= 100*time.Millisecond {
+		t.Errorf("got DOWNLOADING after %s, want between 50ms and 100ms", d)
+	}
+	if d := r.durations["DOWNLOADED"]; d < 100*time.Millisecond || d >= 150*time.Millisecond {
+		t.Errorf("got DOWNLOADED after %s, want between 100ms and 150ms", d)
+	}
+}
+
+// PROGRESS is the key of the progress of the test devices in the state persisted by the controller
+const PROGRESS = "test/progress"
+
+// testFactory creates devices which progress by one step per instance: each instance resumes the progress of the previous one,
+// and completes the task once the progress reaches steps. Otherwise it runs until it crashes
+type testFactory struct {
+	steps int
+
+	sync.Mutex
+	instances int
+}
+
+func (f *testFactory) NewDevice(ctr templates.Controller) (templates.Device, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.instances += 1
+	return &testDevice{ctr: ctr, steps: f.steps}, nil
+}
+
+func (f *testFactory) ParseConfig(data []byte) (templates.DeviceFactory, error) {
+	return f, nil
+}
+
+// created returns the number of Device instances created by the factory
+func (f *testFactory) created() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.instances
+}
+
+type testDevice struct {
+	ctr   templates.Controller
+	steps int
+}
+
+func (d *testDevice) Start(ctx context.Context) error {
+	go func() {
+		d.ctr.Connect(true)
+		d.ctr.StartTask()
+		state, _ := d.ctr.TakeState(PROGRESS)
+		progress, _ := state.(int)
+		progress += 1
+		if progress >= d.steps {
+			d.ctr.CompleteTask(true)
+			return
+		}
+		d.ctr.KeepState(PROGRESS, progress)
+		<-ctx.Done()
+		d.ctr.CompleteTask(false) // dropped if the instance crashed and the device reboots
+	}()
+	return nil
+}
+
+func (d *testDevice) Stop() error {
+	return nil
+}
+
+// startCrashingDevice starts a device of the factory which crashes after 50ms
+func startCrashingDevice(t *testing.T, factory *testFactory, reboot bool, maxReboots int) (*DeviceController, *recorder) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	controller, r := newController(t)
+	controller.willCrash = true
+	controller.crashWithin = 50 * time.Millisecond
+	controller.willReboot = reboot
+	controller.rebootDowntime = 50 * time.Millisecond
+	controller.maxReboots = maxReboots
+	if err := controller.NewDevice(ctx, factory); err != nil {
+		t.Fatalf("NewDevice: %s", err)
+	}
+	if err := controller.StartDevice(); err != nil {
+		t.Fatalf("StartDevice: %s", err)
+	}
+	return controller, r
+}
+
+// waitFinish waits for the task of the device to finish
+func waitFinish(t *testing.T, r *recorder) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if finishes, _ := r.results(); len(finishes) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for the task to finish")
+}
+
+func TestCrashAndReboot(t *testing.T) {
+	tests := []struct {
+		name       string
+		reboot     bool
+		maxReboots int
+		steps      int
+		running    bool // the last instance does not crash and runs until the end of the simulation
+		finishes   []bool
+		reboots    int
+		instances  int
+	}{
+		{"crash without reboot", false, 0, 3, false, []bool{false}, 0, 1},
+		{"resume after the reboots", true, 2, 3, false, []bool{true}, 2, 3},
+		{"no crash after the last reboot", true, 1, 3, true, []bool{false}, 1, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factory := &testFactory{steps: test.steps}
+			controller, r := startCrashingDevice(t, factory, test.reboot, test.maxReboots)
+			if test.running {
+				time.Sleep(300 * time.Millisecond)
+				controller.CompleteTask(false)
+			}
+			waitFinish(t, r)
+			time.Sleep(100 * time.Millisecond) // the reports of the crashed instances, if any
+
+			finishes, reboots := r.results()
+			if !reflect.DeepEqual(finishes, test.finishes) {
+				t.Errorf("got task results %v, want %v", finishes, test.finishes)
+			}
+			if reboots != test.reboots {
+				t.Errorf("got %d reboots, want %d", reboots, test.reboots)
+			}
+			if instances := factory.created(); instances != test.instances {
+				t.Errorf("got %d device instances, want %d", instances, test.instances)
+			}
+			if _, ok := controller.TakeState(PROGRESS); ok {
+				t.Error("got the device state after the task completion, want it cleared")
+			}
+		})
+	}
+}
+
+func TestNoRebootAfterCompletion(t *testing.T) {
+	// the device completes its task before the crash
+	factory := &testFactory{steps: 1}
+	_, r := startCrashingDevice(t, factory, true, 1)
+	waitFinish(t, r)
+	time.Sleep(150 * time.Millisecond)
+
+	finishes, reboots := r.results()
+	if !reflect.DeepEqual(finishes, []bool{true}) || reboots != 0 || factory.created() != 1 {
+		t.Errorf("got task results %v, %d reboots and %d instances, want [true], no reboot and a single instance",
+			finishes, reboots, factory.created())
+	}
+}
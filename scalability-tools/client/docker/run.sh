@@ -1,5 +1,7 @@
 #/bin/bash
 
+# device factories are statically linked in the simulator, the plugin is only needed for out-of-tree factories
+TEMPLATE_ARG=""
 if [ $NEED_COMPILE ]; then
     echo "############## Build Plugin ##############"
 
@@ -12,6 +14,7 @@ if [ $NEED_COMPILE ]; then
     update-ca-certificates
 
     go build -buildmode=plugin -o ${PLUGIN_PATH} .
+    TEMPLATE_ARG="--template ${PLUGIN_PATH}"
 
     echo ""
 fi
@@ -26,7 +29,7 @@ echo "IDX_OFFSET=$IDX_OFFSET"
 echo "STATUS_SERVER_PORT=$STATUS_SERVER_PORT"
 
 echo "############## Start devices simulator ##############"
-./simulator --config "${CONFIG}"  --template ${PLUGIN_PATH} --opath ${OPATH} \
+./simulator --config "${CONFIG}" ${TEMPLATE_ARG} --opath ${OPATH} \
             --num ${CLIENT_NUM} --offset ${IDX_OFFSET} --serverport ${STATUS_SERVER_PORT} \
             --influence "${INFLUENCE}" 
             
\ No newline at end of file
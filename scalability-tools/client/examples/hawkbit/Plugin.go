@@ -0,0 +1,11 @@
+package main
+
+import (
+	"hitachienergy/scalability-test-client/examples/hawkbit/hawkbit"
+)
+
+// The hawkBit factories are statically linked in the simulator and resolved through the factory registry.
+// This package only exposes them for the plugin fallback (".client.template"), e.g. for simulators built without them
+
+var HawkbitDDIDefaultFactory hawkbit.DDIDefaultClientFactory
+var HawkbitDMFDefaultFactory hawkbit.DMFDefaultClientFactory
@@ -0,0 +1,612 @@
+package ddimock
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hitachienergy/scalability-test-client/examples/hawkbit/hawkbit"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ARTIFACT_FILENAME = "firmware.bin"
+const SOFTWARE_MODULE_ID = 1
+
+// DDIServerConfig represents the behavior of the mock DDI server
+type DDIServerConfig struct {
+	Tenant       string        // tenant served by the mock (all tenants if empty)
+	ArtifactSize int64         // size in bytes of the artifact of every deployment
+	PollingSleep string        // polling interval advertised to the devices (HH:MM:SS)
+	Latency      time.Duration // delay added to every response
+	ErrorRate    float64       // probability (0-1) of answering a request with ErrorCode
+	ErrorCode    int           // status code of the injected errors
+	Seed         int64         // seed of the errors injection
+	Confirmation bool          // actions wait for the consent of the device before being deployed
+	CancelRate   float64       // probability (0-1) that the action of a device is cancelled
+	CancelAfter  time.Duration // delay between the first poll of a device and the cancellation of its action
+	Download     string        // download handling of the deployments: skip, attempt or forced (default)
+	Update       string        // update handling of the deployments: skip, attempt or forced (default)
+	WindowPeriod time.Duration // period of the maintenance window, no maintenance window if 0
+	WindowLength time.Duration // time during which the maintenance window is available, at the beginning of each period
+
+	GatewayToken      string            // accepted gateway token of the tenant
+	TargetTokens      map[string]string // accepted target token of each device
+	Anonymous         bool              // requests without credentials are accepted
+	AnonymousDownload bool              // artifacts are downloaded without credentials
+}
+
+// DeviceState is the state of a device as seen by the mock server
+type DeviceState struct {
+	ActionID     int64
+	Closed       bool
+	Confirmation string // confirmed or denied, empty while the action waits for confirmation
+	Cancel       string // requested, cancelled or rejected, empty if the action is not cancelled
+	Attributes   map[string]string
+	Uploads      int  // number of attributes uploads
+	Requested    bool // the attributes are requested at the next poll
+	Polls        int
+	Downloads    int
+	Feedbacks    []hawkbit.DDIUpdateFeedback
+	LastPollAt   time.Time
+	Auth         string // authentication scheme of the last request: GatewayToken, TargetToken or anonymous
+}
+
+// DDIServer is an in-process fake of the hawkBit DDI API. Every device gets one deployment action
+// that stays open until the device reports a closed execution. In confirmation mode, the action is only deployed
+// once the device confirmed it, and a denied action keeps waiting for confirmation. A cancelled action is closed once
+// the device accepts the cancellation. The attributes of the devices are requested at their first poll. Once a gateway token
+// or target tokens are configured, requests without valid credentials are rejected with 401. It implements http.Handler
+type DDIServer struct {
+	config DDIServerConfig
+
+	artifact  []byte
+	hashes    map[string]string
+	startedAt time.Time
+
+	*sync.Mutex
+	random       *rand.Rand
+	devices      map[string]*DeviceState
+	nextActionID int64
+	unauthorized int
+}
+
+// NewDDIServer creates a new mock DDI server. The artifact content is generated once and shared by all deployments
+func NewDDIServer(config DDIServerConfig) *DDIServer {
+	if len(config.PollingSleep) == 0 {
+		config.PollingSleep = "00:00:30"
+	}
+	if config.ErrorCode == 0 {
+		config.ErrorCode = http.StatusServiceUnavailable
+	}
+	if config.Seed == 0 {
+		config.Seed = time.Now().Unix()
+	}
+	if len(config.Download) == 0 {
+		config.Download = hawkbit.HANDLING_FORCED
+	}
+	if len(config.Update) == 0 {
+		config.Update = hawkbit.HANDLING_FORCED
+	}
+
+	random := rand.New(rand.NewSource(config.Seed))
+	artifact := make([]byte, config.ArtifactSize)
+	random.Read(artifact)
+
+	sha1Hash := sha1.Sum(artifact)
+	md5Hash := md5.Sum(artifact)
+	sha256Hash := sha256.Sum256(artifact)
+
+	return &DDIServer{
+		config:   config,
+		artifact: artifact,
+		hashes: map[string]string{
+			"sha1":   hex.EncodeToString(sha1Hash[:]),
+			"md5":    hex.EncodeToString(md5Hash[:]),
+			"sha256": hex.EncodeToString(sha256Hash[:]),
+		},
+		startedAt:    time.Now(),
+		Mutex:        &sync.Mutex{},
+		random:       random,
+		devices:      map[string]*DeviceState{},
+		nextActionID: 1,
+	}
+}
+
+// ListenAndServe starts the mock server on the given address. It blocks until the server stops
+func (s *DDIServer) ListenAndServe(addr string) error {
+	server := &http.Server{Addr: addr, Handler: s}
+	return server.ListenAndServe()
+}
+
+// Device returns a copy of the state of a device, or nil if the device never contacted the server
+func (s *DDIServer) Device(id string) *DeviceState {
+	s.Lock()
+	defer s.Unlock()
+
+	device, ok := s.devices[id]
+	if !ok {
+		return nil
+	}
+	state := *device
+	state.Feedbacks = append([]hawkbit.DDIUpdateFeedback{}, device.Feedbacks...)
+	state.Attributes = make(map[string]string, len(device.Attributes))
+	for key, value := range device.Attributes {
+		state.Attributes[key] = value
+	}
+	return &state
+}
+
+// ClosedCount returns the number of devices that closed their deployment action
+func (s *DDIServer) ClosedCount() (count int) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, device := range s.devices {
+		if device.Closed {
+			count += 1
+		}
+	}
+	return count
+}
+
+// ConfirmationCount returns the number of devices that confirmed and denied their action
+func (s *DDIServer) ConfirmationCount() (confirmed int, denied int) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, device := range s.devices {
+		switch device.Confirmation {
+		case "confirmed":
+			confirmed += 1
+		case "denied":
+			denied += 1
+		}
+	}
+	return confirmed, denied
+}
+
+// RequestAttributes requests the device to upload its attributes again at its next poll.
+// It returns false if the device never contacted the server
+func (s *DDIServer) RequestAttributes(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	device, ok := s.devices[id]
+	if ok {
+		device.Requested = true
+	}
+	return ok
+}
+
+// CancelAction requests the cancellation of the action of a device. The device gets the cancel action at its next poll.
+// It returns false if the device has no open action
+func (s *DDIServer) CancelAction(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	device, ok := s.devices[id]
+	if !ok || device.Closed || device.Cancel == "requested" {
+		return false
+	}
+	device.Cancel = "requested"
+	return true
+}
+
+// CancelCount returns the number of devices that accepted and rejected the cancellation of their action
+func (s *DDIServer) CancelCount() (cancelled int, rejected int) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, device := range s.devices {
+		switch device.Cancel {
+		case "cancelled":
+			cancelled += 1
+		case "rejected":
+			rejected += 1
+		}
+	}
+	return cancelled, rejected
+}
+
+// UnauthorizedCount returns the number of requests rejected because of missing or invalid credentials
+func (s *DDIServer) UnauthorizedCount() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.unauthorized
+}
+
+// ServeHTTP implements http.Handler. Paths follow the DDI API: /{tenant}/controller/v1/{controllerId}/...
+func (s *DDIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.config.Latency > 0 {
+		time.Sleep(s.config.Latency)
+	}
+	if s.injectError() {
+		w.WriteHeader(s.config.ErrorCode)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[1] != "controller" || parts[2] != "v1" {
+		http.NotFound(w, r)
+		return
+	}
+	tenant, id, resource := parts[0], parts[3], parts[4:]
+	if len(s.config.Tenant) > 0 && !strings.EqualFold(tenant, s.config.Tenant) {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authenticate(r, id, len(resource) > 0 && resource[0] == "softwaremodules") {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case len(resource) == 0 && r.Method == http.MethodGet:
+		s.handleControllerBase(w, r, tenant, id)
+	case len(resource) == 1 && resource[0] == hawkbit.ConfigData && r.Method == http.MethodPut:
+		s.handleConfigData(w, r, id)
+	case len(resource) == 2 && resource[0] == hawkbit.CancelAction && r.Method == http.MethodGet:
+		s.handleCancelAction(w, r, id, resource[1])
+	case len(resource) == 3 && resource[0] == hawkbit.CancelAction && resource[2] == "feedback" && r.Method == http.MethodPost:
+		s.handleCancelFeedback(w, r, id, resource[1])
+	case len(resource) == 2 && resource[0] == hawkbit.ConfirmationBase && r.Method == http.MethodGet:
+		s.handleConfirmationBase(w, r, tenant, id, resource[1])
+	case len(resource) == 3 && resource[0] == hawkbit.ConfirmationBase && resource[2] == "feedback" && r.Method == http.MethodPost:
+		s.handleConfirmationFeedback(w, r, id, resource[1])
+	case len(resource) == 2 && resource[0] == hawkbit.DeploymentBase && r.Method == http.MethodGet:
+		s.handleDeploymentBase(w, r, tenant, id, resource[1])
+	case len(resource) == 3 && resource[0] == hawkbit.DeploymentBase && resource[2] == "feedback" && r.Method == http.MethodPost:
+		s.handleDeploymentFeedback(w, r, id, resource[1])
+	case len(resource) == 4 && resource[0] == "softwaremodules" && resource[2] == "artifacts" && r.Method == http.MethodGet:
+		s.handleArtifact(w, r, id, resource[3])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// injectError randomly decides if the current request should fail
+func (s *DDIServer) injectError() bool {
+	if s.config.ErrorRate <= 0 {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.random.Float64() < s.config.ErrorRate
+}
+
+// authenticate checks the credentials of a request and records the authentication scheme of the device.
+// All the requests are accepted if neither a gateway token nor target tokens are configured
+func (s *DDIServer) authenticate(r *http.Request, id string, artifact bool) bool {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	enforced := len(s.config.GatewayToken) > 0 || len(s.config.TargetTokens) > 0
+
+	s.Lock()
+	defer s.Unlock()
+	switch {
+	case scheme == "GatewayToken" && (!enforced || token == s.config.GatewayToken && len(token) > 0):
+	case scheme == "TargetToken" && (!enforced || token == s.config.TargetTokens[id] && len(token) > 0):
+	case len(scheme) == 0 && (!enforced || s.config.Anonymous || artifact && s.config.AnonymousDownload):
+		scheme = "anonymous"
+	default:
+		s.unauthorized += 1
+		return false
+	}
+	if !artifact {
+		s.device(id).Auth = scheme
+	}
+	return true
+}
+
+// device returns the state of a device, creating it on first contact. The caller must hold the lock
+func (s *DDIServer) device(id string) *DeviceState {
+	device, ok := s.devices[id]
+	if !ok {
+		device = &DeviceState{ActionID: s.nextActionID, Requested: true}
+		s.nextActionID += 1
+		s.devices[id] = device
+		if s.config.CancelRate > 0 && s.random.Float64() < s.config.CancelRate {
+			time.AfterFunc(s.config.CancelAfter, func() { s.CancelAction(id) })
+		}
+	}
+	return device
+}
+
+// handleControllerBase returns the polling configuration and the link to the open action, if any
+func (s *DDIServer) handleControllerBase(w http.ResponseWriter, r *http.Request, tenant string, id string) {
+	s.Lock()
+	device := s.device(id)
+	device.Polls += 1
+	device.LastPollAt = time.Now()
+	actionID, closed, confirmed := device.ActionID, device.Closed, device.Confirmation == "confirmed"
+	cancelled, requested := device.Cancel == "requested", device.Requested
+	s.Unlock()
+
+	base := hawkbit.ControllerBase{
+		Config: hawkbit.ControllerConfig{Polling: hawkbit.PollingConfig{Sleep: s.config.PollingSleep}},
+		Links:  map[string]hawkbit.Link{},
+	}
+	if requested {
+		base.Links[hawkbit.ConfigData] = hawkbit.Link{Href: fmt.Sprintf("%s/%s", controllerURL(r, tenant, id), hawkbit.ConfigData)}
+	}
+	if !closed {
+		basekey := hawkbit.DeploymentBase
+		if cancelled {
+			basekey = hawkbit.CancelAction
+		} else if s.config.Confirmation && !confirmed {
+			basekey = hawkbit.ConfirmationBase
+		}
+		base.Links[basekey] = hawkbit.Link{
+			Href: fmt.Sprintf("%s/%s/%d?c=%d", controllerURL(r, tenant, id), basekey, actionID, actionID),
+		}
+	}
+	writeJSON(w, base)
+}
+
+// handleConfigData records the attributes uploaded by the device
+func (s *DDIServer) handleConfigData(w http.ResponseWriter, r *http.Request, id string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var configData hawkbit.DDIConfigData
+	err = json.Unmarshal(body, &configData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	device := s.device(id)
+	switch configData.Mode {
+	case "", "merge":
+		if device.Attributes == nil {
+			device.Attributes = map[string]string{}
+		}
+		for key, value := range configData.Data {
+			device.Attributes[key] = value
+		}
+	case "replace":
+		device.Attributes = configData.Data
+	case "remove":
+		for key := range configData.Data {
+			delete(device.Attributes, key)
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	device.Uploads += 1
+	device.Requested = false
+}
+
+// handleCancelAction returns the cancel action, which stops the action of the device
+func (s *DDIServer) handleCancelAction(w http.ResponseWriter, r *http.Request, id string, action string) {
+	actionID, err := strconv.ParseInt(action, 10, 64)
+	if err != nil || !s.isCancelledAction(id, actionID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, hawkbit.ActionWithCancel{
+		ID:           action,
+		CancelAction: hawkbit.CancelStop{StopID: action},
+	})
+}
+
+// handleCancelFeedback closes the action if the device accepts the cancellation. A rejected cancellation lets the action continue
+func (s *DDIServer) handleCancelFeedback(w http.ResponseWriter, r *http.Request, id string, action string) {
+	actionID, err := strconv.ParseInt(action, 10, 64)
+	if err != nil || !s.isCancelledAction(id, actionID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var feedback hawkbit.DDIUpdateFeedback
+	err = json.Unmarshal(body, &feedback)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.Lock()
+	device := s.device(id)
+	switch feedback.Status.Execution {
+	case "closed":
+		device.Cancel = "cancelled"
+		device.Closed = true
+	case "rejected":
+		device.Cancel = "rejected"
+	}
+	s.Unlock()
+}
+
+// handleConfirmationBase returns the action waiting for confirmation
+func (s *DDIServer) handleConfirmationBase(w http.ResponseWriter, r *http.Request, tenant string, id string, action string) {
+	actionID, err := strconv.ParseInt(action, 10, 64)
+	if err != nil || !s.isWaitingAction(id, actionID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, hawkbit.ConfirmationBaseAction{
+		ID:           action,
+		Confirmation: s.deployment(r, tenant, id),
+	})
+}
+
+// handleConfirmationFeedback records the consent of the device. A confirmed action is deployed at the next poll
+func (s *DDIServer) handleConfirmationFeedback(w http.ResponseWriter, r *http.Request, id string, action string) {
+	actionID, err := strconv.ParseInt(action, 10, 64)
+	if err != nil || !s.isWaitingAction(id, actionID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var feedback hawkbit.DDIConfirmationFeedback
+	err = json.Unmarshal(body, &feedback)
+	if err != nil || (feedback.Confirmation != "confirmed" && feedback.Confirmation != "denied") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.Lock()
+	s.device(id).Confirmation = feedback.Confirmation
+	s.Unlock()
+}
+
+// handleDeploymentBase returns the deployment of the action
+func (s *DDIServer) handleDeploymentBase(w http.ResponseWriter, r *http.Request, tenant string, id string, action string) {
+	actionID, err := strconv.ParseInt(action, 10, 64)
+	if err != nil || !s.isOpenAction(id, actionID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, hawkbit.ActionWithDeployment{
+		ID:         action,
+		Deployment: s.deployment(r, tenant, id),
+	})
+}
+
+// windowAvailable checks if the maintenance window is open. The windows open at the start of the server, then every period
+func (s *DDIServer) windowAvailable() bool {
+	return time.Since(s.startedAt)%s.config.WindowPeriod < s.config.WindowLength
+}
+
+// deployment returns the deployment of the action of a device. The update is skipped while the maintenance window is unavailable
+func (s *DDIServer) deployment(r *http.Request, tenant string, id string) hawkbit.Deployment {
+	artifact := hawkbit.DDIArtifact{
+		Filename: ARTIFACT_FILENAME,
+		Hashes:   s.hashes,
+		Size:     int64(len(s.artifact)),
+		Links: map[string]hawkbit.Link{
+			"download-http": {Href: fmt.Sprintf("%s/softwaremodules/%d/artifacts/%s", controllerURL(r, tenant, id), SOFTWARE_MODULE_ID, ARTIFACT_FILENAME)},
+		},
+	}
+	deployment := hawkbit.Deployment{
+		Download: s.config.Download,
+		Update:   s.config.Update,
+		Chunks: []hawkbit.Chunk{{
+			Part:      "os",
+			Version:   "1.0.0",
+			Name:      "simulated-firmware",
+			Artifacts: []hawkbit.DDIArtifact{artifact},
+		}},
+	}
+	if s.config.WindowPeriod > 0 {
+		deployment.MaintenanceWindow = hawkbit.WINDOW_AVAILABLE
+		if !s.windowAvailable() {
+			deployment.MaintenanceWindow = hawkbit.WINDOW_UNAVAILABLE
+			deployment.Update = hawkbit.HANDLING_SKIP
+		}
+	}
+	return deployment
+}
+
+// handleDeploymentFeedback records the feedback of a device and closes the action on closed executions
+func (s *DDIServer) handleDeploymentFeedback(w http.ResponseWriter, r *http.Request, id string, action string) {
+	actionID, err := strconv.ParseInt(action, 10, 64)
+	if err != nil || !s.isOpenAction(id, actionID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var feedback hawkbit.DDIUpdateFeedback
+	err = json.Unmarshal(body, &feedback)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.Lock()
+	device := s.device(id)
+	device.Feedbacks = append(device.Feedbacks, feedback)
+	if feedback.Status.Execution == "closed" {
+		device.Closed = true
+	}
+	s.Unlock()
+}
+
+// handleArtifact serves the artifact content
+func (s *DDIServer) handleArtifact(w http.ResponseWriter, r *http.Request, id string, filename string) {
+	if filename != ARTIFACT_FILENAME {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.Lock()
+	s.device(id).Downloads += 1
+	s.Unlock()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(s.artifact)))
+	w.Write(s.artifact)
+}
+
+// isOpenAction checks that the action is the open action of the device, and that it was confirmed in confirmation mode
+func (s *DDIServer) isOpenAction(id string, actionID int64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	device, ok := s.devices[id]
+	return ok && device.ActionID == actionID && !device.Closed && (!s.config.Confirmation || device.Confirmation == "confirmed")
+}
+
+// isCancelledAction checks that the cancellation of the action of the device is requested
+func (s *DDIServer) isCancelledAction(id string, actionID int64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	device, ok := s.devices[id]
+	return ok && device.ActionID == actionID && !device.Closed && device.Cancel == "requested"
+}
+
+// isWaitingAction checks that the action of the device waits for confirmation
+func (s *DDIServer) isWaitingAction(id string, actionID int64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	device, ok := s.devices[id]
+	return ok && s.config.Confirmation && device.ActionID == actionID && !device.Closed && device.Confirmation != "confirmed"
+}
+
+// controllerURL returns the base url of the device resources, as seen by the device
+func controllerURL(r *http.Request, tenant string, id string) string {
+	return fmt.Sprintf("http://%s/%s/controller/v1/%s", r.Host, tenant, id)
+}
+
+// writeJSON writes a HAL+JSON response
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/hal+json;charset=UTF-8")
+	w.Write(payload)
+}
@@ -0,0 +1,66 @@
+package hawkbit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hitachienergy/scalability-test-client/fault"
+	"strings"
+)
+
+// artifactDownload receives an artifact while it is downloaded. The bytes are hashed on the fly
+// and kept in memory only if required, so that the memory of a device does not grow with the artifact size.
+// The received bytes go through the download fault of the device, if any
+type artifactDownload struct {
+	sha1     hash.Hash
+	size     int64
+	data     []byte
+	keepData bool
+
+	fault    *fault.Download
+	expected int64 // size announced by the server
+}
+
+// newArtifactDownload creates a new artifactDownload
+func newArtifactDownload(keepData bool, expected int64, downloadFault *fault.Download) *artifactDownload {
+	return &artifactDownload{
+		sha1:     sha1.New(),
+		keepData: keepData,
+		fault:    downloadFault,
+		expected: expected,
+	}
+}
+
+// Write implements io.Writer
+func (d *artifactDownload) Write(p []byte) (int, error) {
+	n := len(p)
+	p = d.fault.Apply(p, d.size, d.expected)
+	d.sha1.Write(p)
+	d.size += int64(len(p))
+	if d.keepData {
+		d.data = append(d.data, p...)
+	}
+	return n, nil
+}
+
+// sha1Hash returns the SHA1 hash of the received bytes as lower case hexadecimal string
+func (d *artifactDownload) sha1Hash() string {
+	return strings.ToLower(hex.EncodeToString(d.sha1.Sum(nil)))
+}
+
+// verifyArtifact verifies the size and the SHA1 hash of a downloaded artifact
+func verifyArtifact(url string, hash string, size int64, download *artifactDownload) (status LocalUpdateStatus) {
+	if download.size != size {
+		return LocalUpdateStatus{Status: ERROR,
+			StatusMsgs: []string{fmt.Sprintf("Download %s has wrong content length (Expected: %d, Got %d)", url, size, download.size)}}
+	}
+
+	hashString := download.sha1Hash()
+	if hashString != hash {
+		return LocalUpdateStatus{Status: ERROR,
+			StatusMsgs: []string{fmt.Sprintf("Download %s failed with SHA1 hash missmatch (Expected: %s, Got %s)", url, hash, hashString)}}
+	}
+
+	return LocalUpdateStatus{Status: SUCCESSFUL, StatusMsgs: []string{fmt.Sprintf("Download %s successfully (%d bytes)", url, download.size)}}
+}
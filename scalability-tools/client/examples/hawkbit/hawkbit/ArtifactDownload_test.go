@@ -0,0 +1,68 @@
+package hawkbit
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestArtifactDownload(t *testing.T) {
+	artifact := make([]byte, 100000)
+	for i := range artifact {
+		artifact[i] = byte(i % 251)
+	}
+	sum := sha1.Sum(artifact)
+	hash := hex.EncodeToString(sum[:])
+
+	for _, keepData := range []bool{true, false} {
+		// the artifact is streamed by small pieces, as received from the network
+		download := newArtifactDownload(keepData, int64(len(artifact)), nil)
+		if _, err := io.CopyBuffer(download, bytes.NewReader(artifact), make([]byte, 1000)); err != nil {
+			t.Fatalf("Copy: %s", err)
+		}
+		if got := download.sha1Hash(); got != hash {
+			t.Errorf("got hash %s, want %s", got, hash)
+		}
+		if keepData && !bytes.Equal(download.data, artifact) {
+			t.Errorf("got %d bytes kept, want the %d bytes of the artifact", len(download.data), len(artifact))
+		}
+		if !keepData && download.data != nil {
+			t.Errorf("got %d bytes kept, want the bytes discarded", len(download.data))
+		}
+	}
+}
+
+func TestVerifyArtifact(t *testing.T) {
+	artifact := []byte("artifact")
+	sum := sha1.Sum(artifact)
+	hash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name   string
+		hash   string
+		size   int64
+		status UpdateStage
+		msg    string
+	}{
+		{"valid", hash, 8, SUCCESSFUL, "successfully (8 bytes)"},
+		{"wrong size", hash, 9, ERROR, "wrong content length (Expected: 9, Got 8)"},
+		{"wrong hash", strings.Repeat("0", 40), 8, ERROR, "SHA1 hash missmatch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			download := newArtifactDownload(false, test.size, nil)
+			download.Write(artifact)
+			status := verifyArtifact("http://artifact", test.hash, test.size, download)
+			if status.Status != test.status {
+				t.Errorf("got status %v, want %v", status.Status, test.status)
+			}
+			if len(status.StatusMsgs) != 1 || !strings.Contains(status.StatusMsgs[0], test.msg) {
+				t.Errorf("got messages %q, want %q", status.StatusMsgs, test.msg)
+			}
+		})
+	}
+}
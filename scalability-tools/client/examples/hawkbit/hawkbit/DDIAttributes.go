@@ -0,0 +1,114 @@
+package hawkbit
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	REFRESH_REQUESTED = "requested" // attributes are uploaded when the server requests them
+	REFRESH_POLL      = "poll"      // attributes are uploaded at every poll
+)
+
+// DDIAttributes renders the attributes uploaded by the devices through the configData resource. Each attribute value is
+// a Go template of the device, e.g. "SN-{{printf \"%08d\" .Index}}" or "{{pick .Index \"eu\" \"us\"}}"
+type DDIAttributes struct {
+	names     []string
+	templates map[string]*template.Template
+
+	mode          string        // merge or replace
+	everyPoll     bool          // upload at every poll
+	refreshPeriod time.Duration // upload at the first poll then periodically, in addition to the server requests, if not 0
+}
+
+// AttributesData is the device information given to the attribute templates
+type AttributesData struct {
+	ID      string
+	Index   int
+	Tenant  string
+	Uploads int // number of previous uploads of the device, to simulate changing attributes
+}
+
+// attributeFuncs are the helper functions of the attribute templates
+var attributeFuncs = template.FuncMap{
+	"mod": func(a int, b int) int { return a % b },
+	"add": func(a int, b int) int { return a + b },
+	// pick selects a value by index, e.g. to spread the devices over regions
+	"pick": func(index int, values ...string) string {
+		if len(values) == 0 {
+			return ""
+		}
+		return values[index%len(values)]
+	},
+}
+
+// newDDIAttributes parses the attribute templates. The refresh is either "requested", "poll" or a period, e.g. "10m"
+func newDDIAttributes(attributes map[string]interface{}, mode string, refresh string) (*DDIAttributes, error) {
+	a := &DDIAttributes{
+		templates: map[string]*template.Template{},
+		mode:      mode,
+	}
+
+	switch mode {
+	case "merge", "replace":
+	default:
+		return nil, xerrors.Errorf("Invalid input (attributesMode). Expected: merge or replace")
+	}
+
+	switch refresh {
+	case REFRESH_REQUESTED:
+	case REFRESH_POLL:
+		a.everyPoll = true
+	default:
+		period, err := time.ParseDuration(refresh)
+		if err != nil || period <= 0 {
+			return nil, xerrors.Errorf("Invalid input (attributesRefresh). Expected: requested, poll or a duration")
+		}
+		a.refreshPeriod = period
+	}
+
+	for name, value := range attributes {
+		text, ok := value.(string)
+		if !ok {
+			return nil, xerrors.Errorf("Invalid attribute %s. Expected: string", name)
+		}
+		tmpl, err := template.New(name).Funcs(attributeFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, xerrors.Errorf("Invalid attribute %s: %w", name, err)
+		}
+		a.names = append(a.names, name)
+		a.templates[name] = tmpl
+	}
+	sort.Strings(a.names)
+
+	return a, nil
+}
+
+// render generates the attributes of a device
+func (a *DDIAttributes) render(data AttributesData) (attributes map[string]string, err error) {
+	attributes = make(map[string]string, len(a.names))
+	for _, name := range a.names {
+		var value strings.Builder
+		err = a.templates[name].Execute(&value, data)
+		if err != nil {
+			return nil, xerrors.Errorf("Fail to render attribute %s: %w", name, err)
+		}
+		attributes[name] = value.String()
+	}
+	return attributes, nil
+}
+
+// needUpload checks if the attributes must be uploaded, given whether the server requested them and the last upload
+func (a *DDIAttributes) needUpload(requested bool, lastUpload time.Time) bool {
+	switch {
+	case requested, a.everyPoll:
+		return true
+	case a.refreshPeriod > 0:
+		return time.Since(lastUpload) >= a.refreshPeriod
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package hawkbit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDDIAttributesRender(t *testing.T) {
+	attributes, err := newDDIAttributes(map[string]interface{}{
+		"serial":   `SN-{{printf "%08d" .Index}}`,
+		"region":   `{{pick .Index "eu" "us" "apac"}}`,
+		"rack":     "{{mod .Index 4}}-{{add .Index 100}}",
+		"id":       "{{.Tenant}}/{{.ID}}",
+		"firmware": "v{{.Uploads}}",
+	}, "merge", REFRESH_REQUESTED)
+	if err != nil {
+		t.Fatalf("newDDIAttributes: %s", err)
+	}
+
+	got, err := attributes.render(AttributesData{ID: "ddi5", Index: 5, Tenant: "DEFAULT", Uploads: 2})
+	if err != nil {
+		t.Fatalf("render: %s", err)
+	}
+	want := map[string]string{"serial": "SN-00000005", "region": "apac", "rack": "1-105", "id": "DEFAULT/ddi5", "firmware": "v2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNewDDIAttributesInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string]interface{}
+		mode       string
+		refresh    string
+	}{
+		{"invalid mode", map[string]interface{}{}, "remove", REFRESH_REQUESTED},
+		{"invalid refresh", map[string]interface{}{}, "merge", "sometimes"},
+		{"non-positive period", map[string]interface{}{}, "merge", "0s"},
+		{"non-string attribute", map[string]interface{}{"index": 3}, "merge", REFRESH_REQUESTED},
+		{"invalid template", map[string]interface{}{"index": "{{.Index"}, "merge", REFRESH_REQUESTED},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newDDIAttributes(test.attributes, test.mode, test.refresh); err == nil {
+				t.Error("got no error, want an invalid input error")
+			}
+		})
+	}
+
+	// unknown fields are only detected when rendering
+	attributes, _ := newDDIAttributes(map[string]interface{}{"serial": "{{.Serial}}"}, "merge", REFRESH_REQUESTED)
+	if _, err := attributes.render(AttributesData{}); err == nil {
+		t.Error("render: got no error for an unknown field, want an error")
+	}
+}
+
+func TestDDIAttributesNeedUpload(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		refresh    string
+		requested  bool
+		lastUpload time.Time
+		want       bool
+	}{
+		{REFRESH_REQUESTED, true, now, true},
+		{REFRESH_REQUESTED, false, time.Time{}, false},
+		{REFRESH_POLL, false, now, true},
+		{"10m", false, time.Time{}, true}, // first poll
+		{"10m", false, now.Add(-5 * time.Minute), false},
+		{"10m", false, now.Add(-10 * time.Minute), true},
+		{"10m", true, now, true},
+	}
+
+	for _, test := range tests {
+		attributes, err := newDDIAttributes(map[string]interface{}{}, "merge", test.refresh)
+		if err != nil {
+			t.Fatalf("newDDIAttributes: %s", err)
+		}
+		if got := attributes.needUpload(test.requested, test.lastUpload); got != test.want {
+			t.Errorf("%s, requested %t, uploaded %s ago: got %t, want %t", test.refresh, test.requested, time.Since(test.lastUpload), got, test.want)
+		}
+	}
+}
@@ -35,27 +35,42 @@ import (
 // }
 
 type DDIClient struct {
-	pollDelay time.Duration
+	pollDelay       time.Duration // used until the server dictates the polling interval, or always if it overrides it
+	overridePolling bool
+	pollSleep       time.Duration // current polling interval
+
+	ctx context.Context // context of the device instance, done once the device crashed or stopped
+
+	attributes *DDIAttributes // nil if the device does not upload attributes
+	uploads    int
+	lastUpload time.Time
 
 	*DDIRestApi
 	*DDIUpdateManager
 	controller templates.Controller
 }
 
-// NewDDIClient creates a new DDI client instance
-func NewDDIClient(controller templates.Controller, tenant string, pollDelay int, baseEndpoint string, gatewayToken string, useHTTPPool bool) *DDIClient {
-	api := newDDIRestApi(controller.GetIdentifier(), tenant, baseEndpoint, gatewayToken, useHTTPPool)
+// NewDDIClient creates a new DDI client instance. The device polls at the interval dictated by the server, unless
+// overridePolling is set, and postpones the attempted downloads and updates by attemptDelay seconds. The authorization
+// is the value of the Authorization header, empty for an anonymous device. The attributes are optional
+func NewDDIClient(controller templates.Controller, tenant string, pollDelay int, overridePolling bool, attemptDelay int, baseEndpoint string, authorization string, anonymousDownload bool, useHTTPPool bool, discardArtifacts bool, attributes *DDIAttributes) *DDIClient {
+	api := newDDIRestApi(controller, tenant, baseEndpoint, authorization, anonymousDownload, useHTTPPool)
 	c := DDIClient{
-		DDIRestApi: api,
-		controller: controller,
-		pollDelay:  time.Duration(pollDelay),
+		DDIRestApi:      api,
+		controller:      controller,
+		pollDelay:       time.Duration(pollDelay) * time.Second,
+		overridePolling: overridePolling,
+		pollSleep:       time.Duration(pollDelay) * time.Second,
+		attributes:      attributes,
+		ctx:             context.Background(),
 	}
-	c.DDIUpdateManager = newDDIUpdateManager(&c)
+	c.DDIUpdateManager = newDDIUpdateManager(&c, time.Duration(attemptDelay)*time.Second, discardArtifacts)
 	return &c
 }
 
 // Start implements Device.Start interface
 func (c *DDIClient) Start(ctx context.Context) error {
+	c.ctx = ctx
 	err := c.poll()
 	c.controller.Connect(err == nil)
 	if err != nil {
@@ -68,7 +83,7 @@ func (c *DDIClient) Start(ctx context.Context) error {
 			select {
 			case <-ctx.Done():
 				break out
-			case <-time.After(c.pollDelay * time.Second):
+			case <-time.After(c.pollSleep):
 				err := c.poll()
 				if err != nil {
 					c.controller.GetLogger().Err(err).Send()
@@ -85,35 +100,66 @@ func (c *DDIClient) Stop() error {
 	return nil
 }
 
-// poll retrieves information from the server and do the update if needed
+// poll retrieves information from the server and do the update if needed. Actions waiting for the consent of the user
+// are confirmed or denied first
 func (c *DDIClient) poll() (err error) {
-	// link, err := c.GetRequiredLink(ConfirmationBase)
-	// if err != nil {
-	// 	return err
-	// }
-	// if len(link) > 0 {
-	// 	actionID, err := GetActionId(link)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// 	err = c.SendConfirmation(actionID, "confirmed")
-	// 	return err
-	// }
-
-	link, err := c.getRequiredLink(DeploymentBase)
-	if err != nil || len(link) == 0 {
+	base, err := c.getControllerBase()
+	if err != nil {
 		return err
 	}
+	c.setPollingSleep(base.Config.Polling.Sleep)
+	links := base.Links
+
+	if c.attributes != nil && c.attributes.needUpload(len(links[ConfigData].Href) > 0, c.lastUpload) {
+		// the update goes on even if the attributes could not be uploaded
+		err := c.uploadAttributes()
+		if err != nil {
+			c.controller.GetLogger().Err(err).Send()
+		}
+	}
+
+	if link := links[CancelAction].Href; len(link) > 0 {
+		actionID, err := getActionId(link)
+		if err != nil {
+			return err
+		}
+		return c.pollCancel(actionID)
+	}
+
+	if link := links[ConfirmationBase].Href; len(link) > 0 {
+		// without action, the link only gives the auto-confirmation state of the device
+		if actionID, err := getActionId(link); err == nil {
+			return c.pollConfirmation(actionID)
+		}
+	}
+
+	link := links[DeploymentBase].Href
+	if len(link) == 0 {
+		return nil
+	}
 
 	actionID, err := getActionId(link)
 	if err != nil {
 		return err
 	}
+	if c.isHandled(actionID) {
+		// the update is running or done, the device keeps polling for a cancellation
+		return nil
+	}
 
 	deployment, err := c.getActionWithDeployment(actionID)
 	if err != nil || deployment == nil {
 		return err
 	}
+	if deployment.Download == HANDLING_SKIP {
+		// the server does not allow the download yet
+		return nil
+	}
+	if c.postponeAttempt(actionID, deployment.Download) {
+		// the device is free to download later, it is handled again at the next polls
+		c.controller.GetLogger().Debug().Msgf("Download of action %d postponed", actionID)
+		return nil
+	}
 
 	c.controller.StartTask()
 
@@ -126,3 +172,93 @@ func (c *DDIClient) poll() (err error) {
 
 	return nil
 }
+
+// setPollingSleep adopts the polling interval dictated by the server, unless the configured poll delay overrides it
+func (c *DDIClient) setPollingSleep(sleep string) {
+	if c.overridePolling || len(sleep) == 0 {
+		return
+	}
+	duration, err := parsePollingSleep(sleep)
+	if err != nil || duration <= 0 {
+		c.controller.GetLogger().Debug().Msgf("Ignore polling sleep %s", sleep)
+		return
+	}
+	if duration != c.pollSleep {
+		c.controller.GetLogger().Debug().Msgf("Polling interval set to %s by the server", duration)
+		c.pollSleep = duration
+	}
+}
+
+// pollConfirmation fetches the action waiting for confirmation and lets the user confirm or deny it. The task starts
+// when the action is received, so that the confirmation latency is reported as the CONFIRMED (or DENIED) phase
+func (c *DDIClient) pollConfirmation(actionID int64) (err error) {
+	if !c.tryConfirmation(actionID) {
+		return nil
+	}
+
+	_, err = c.getConfirmationAction(actionID)
+	if err != nil {
+		c.resetConfirmation(actionID)
+		return err
+	}
+
+	c.controller.StartTask()
+
+	c.controller.GetScheduler().Submit(func() {
+		err := c.confirmUpdate(actionID)
+		if err != nil {
+			c.controller.GetLogger().Err(err).Send()
+		}
+	})
+
+	return nil
+}
+
+// pollCancel fetches the cancel action, stops the related update and reports whether the cancellation is accepted.
+// An update is only cancelled before its installation. The cancelled task ends with the CANCEL phase
+func (c *DDIClient) pollCancel(actionID int64) (err error) {
+	stopID, err := c.getCancelAction(actionID)
+	if err != nil {
+		return err
+	}
+
+	// the action can be cancelled before the device received it
+	c.controller.StartTask()
+
+	if !c.cancelUpdate(stopID) {
+		c.controller.GetLogger().Debug().Msgf("Cancellation of action %d rejected", stopID)
+		return c.sendCancelFeedback(actionID, DDIUpdateStatus{
+			Execution: "rejected",
+			Result:    DDIUpdateResult{Finished: "none"},
+			Details:   []string{"Update already installing."},
+		})
+	}
+
+	return c.sendCancelFeedback(actionID, DDIUpdateStatus{
+		Execution: "closed",
+		Result:    DDIUpdateResult{Finished: "success"},
+		Code:      200,
+		Details:   []string{"Simulation canceled."},
+	})
+}
+
+// uploadAttributes renders the attributes of the device and uploads them to the server
+func (c *DDIClient) uploadAttributes() (err error) {
+	attributes, err := c.attributes.render(AttributesData{
+		ID:      c.id,
+		Index:   c.controller.GetIndex(),
+		Tenant:  c.tenant,
+		Uploads: c.uploads,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.sendConfigData(c.attributes.mode, attributes)
+	if err != nil {
+		return err
+	}
+	c.uploads += 1
+	c.lastUpload = time.Now()
+	return nil
+}
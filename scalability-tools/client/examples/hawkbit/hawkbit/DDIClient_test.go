@@ -0,0 +1,298 @@
+package hawkbit_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"hitachienergy/scalability-test-client/examples/hawkbit/ddimock"
+	"hitachienergy/scalability-test-client/examples/hawkbit/hawkbit"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates/templatestest"
+
+	"gopkg.in/yaml.v3"
+)
+
+// taskTimeout bounds the time needed by a device to finish its task, the mock server advertising a polling interval of 1s
+const taskTimeout = 10 * time.Second
+
+// startDDIServer starts the mock DDI server. The devices poll every second
+func startDDIServer(t *testing.T, config ddimock.DDIServerConfig) (*ddimock.DDIServer, string) {
+	config.ArtifactSize = 64 * 1024
+	config.PollingSleep = "00:00:01"
+	server := ddimock.NewDDIServer(config)
+	return server, templatestest.StartHTTPServer(t, server)
+}
+
+// startDDIDevice creates a DDI device with a fake controller and starts polling the server
+func startDDIDevice(t *testing.T, endpoint string, id string, outcome fault.UpdateOutcome) (*templatestest.Controller, error) {
+	controller := templatestest.NewController(id, 0, outcome)
+	client := hawkbit.NewDDIClient(controller, "DEFAULT", 1, false, 0, endpoint, "", false, false, true, nil)
+	return controller, templatestest.StartDevice(t, controller, client.Start)
+}
+
+// startFactoryDevice creates a DDI device with the default factory and the given arguments, and starts polling the server.
+// The device polls every second and discards the artifacts, unless the arguments say otherwise
+func startFactoryDevice(t *testing.T, endpoint string, id string, index int, args map[string]interface{}) (*templatestest.Controller, error) {
+	defaults := map[string]interface{}{"tenant": "DEFAULT", "pollDelay": 1, "discardArtifacts": true, "gatewayToken": "gateway"}
+	for key, value := range defaults {
+		if _, ok := args[key]; !ok {
+			args[key] = value
+		}
+	}
+	data, err := yaml.Marshal(map[string]interface{}{
+		"client": map[string]interface{}{"args": args},
+		"server": map[string]interface{}{"devicesEndpoint": endpoint},
+	})
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	factory, err := hawkbit.DDIDefaultClientFactory{}.ParseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	controller := templatestest.NewController(id, index, fault.UpdateOutcome{})
+	device, err := factory.NewDevice(controller)
+	if err != nil {
+		controller.Release()
+		return nil, err
+	}
+	return controller, templatestest.StartDevice(t, controller, device.Start)
+}
+
+func TestDDIDeployment(t *testing.T) {
+	server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1})
+	controller, err := startDDIDevice(t, endpoint, "ddi0", fault.UpdateOutcome{})
+	if err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+	templatestest.WaitTask(t, controller, taskTimeout)
+
+	if success, cancelled := controller.Result(); !success || cancelled {
+		t.Errorf("got success %t and cancelled %t, want a successful task", success, cancelled)
+	}
+	wantPhases := []string{"RUNNING", "DOWNLOADING", "DOWNLOADED", "SUCCESSFUL"}
+	if phases := controller.Phases(); !reflect.DeepEqual(phases, wantPhases) {
+		t.Errorf("got phases %v, want %v", phases, wantPhases)
+	}
+	if got := controller.Connects(); !reflect.DeepEqual(got, []bool{true}) {
+		t.Errorf("got connects %v, want [true]", got)
+	}
+	if got := controller.Started(); got != 1 {
+		t.Errorf("task started %d times, want 1", got)
+	}
+
+	device := server.Device("ddi0")
+	if device == nil || !device.Closed {
+		t.Fatalf("action not closed on the server: %+v", device)
+	}
+	if device.Downloads != 1 {
+		t.Errorf("got %d downloads, want 1", device.Downloads)
+	}
+	last := device.Feedbacks[len(device.Feedbacks)-1]
+	if last.Status.Execution != "closed" || last.Status.Result.Finished != "success" {
+		t.Errorf("got last feedback %+v, want a closed and successful execution", last.Status)
+	}
+}
+
+func TestDDIInjectedErrors(t *testing.T) {
+	server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 3, ErrorRate: 0.2})
+
+	controllers := map[string]*templatestest.Controller{}
+	connected := map[string]*templatestest.Controller{}
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("ddi%d", i)
+		controller, err := startDDIDevice(t, endpoint, id, fault.UpdateOutcome{})
+		controllers[id] = controller
+		if err != nil {
+			// the first poll failed, the device is not connected
+			if got := controller.Connects(); !reflect.DeepEqual(got, []bool{false}) {
+				t.Errorf("%s: got connects %v after %s, want [false]", id, got, err)
+			}
+			continue
+		}
+		connected[id] = controller
+	}
+	if len(connected) == 0 {
+		t.Fatal("no device connected")
+	}
+
+	for id, controller := range connected {
+		templatestest.WaitTask(t, controller, taskTimeout)
+
+		// the device succeeds if and only if the server received its closed and successful execution
+		success, _ := controller.Result()
+		device := server.Device(id)
+		closed := device.Closed && device.Feedbacks[len(device.Feedbacks)-1].Status.Result.Finished == "success"
+		if success != closed {
+			t.Errorf("%s: got success %t, but closed and successful on the server %t", id, success, closed)
+		}
+	}
+
+	endpoints := []string{"ddi/controllerBase", "ddi/deploymentBase", "ddi/deploymentFeedback", "ddi/cancelFeedback",
+		"ddi/confirmationBase", "ddi/configData", "ddi/download"}
+	if templatestest.CountStatus(controllers, endpoints, http.StatusServiceUnavailable) == 0 {
+		t.Error("no injected error reported by the devices")
+	}
+	// the endpoints of a deployment are reported under these names, successful or not
+	for _, endpoint := range []string{"ddi/controllerBase", "ddi/deploymentBase", "ddi/deploymentFeedback", "ddi/download"} {
+		if templatestest.CountStatus(connected, []string{endpoint}, http.StatusOK) == 0 {
+			t.Errorf("no successful request reported for %s", endpoint)
+		}
+	}
+}
+
+func TestDDIConfigData(t *testing.T) {
+	server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1})
+	attributes := map[string]interface{}{
+		"serial":  `SN-{{printf "%04d" .Index}}`,
+		"region":  `{{pick .Index "eu" "us" "apac"}}`,
+		"uploads": "{{.Uploads}}",
+	}
+	controller, err := startFactoryDevice(t, endpoint, "ddi7", 7, map[string]interface{}{"attributes": attributes})
+	if err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+
+	// the server requests the attributes at the first poll
+	want := map[string]string{"serial": "SN-0007", "region": "us", "uploads": "0"}
+	if device := server.Device("ddi7"); device.Uploads != 1 || !reflect.DeepEqual(device.Attributes, want) {
+		t.Errorf("got %d uploads of %v after the first poll, want 1 upload of %v", device.Uploads, device.Attributes, want)
+	}
+	templatestest.WaitTask(t, controller, taskTimeout)
+	if device := server.Device("ddi7"); device.Uploads != 1 {
+		t.Errorf("got %d uploads without request of the server, want 1", device.Uploads)
+	}
+
+	// the attributes are uploaded again once the server requests them
+	server.RequestAttributes("ddi7")
+	templatestest.WaitFor(t, "second upload", 3*time.Second, func() bool { return server.Device("ddi7").Uploads == 2 })
+	if got := server.Device("ddi7").Attributes["uploads"]; got != "1" {
+		t.Errorf("got uploads attribute %s at the second upload, want 1", got)
+	}
+	// the device reports its request once it got the response of the server
+	templatestest.WaitFor(t, "second configData report", time.Second, func() bool {
+		controllers := map[string]*templatestest.Controller{"ddi7": controller}
+		return templatestest.CountStatus(controllers, []string{"ddi/configData"}, http.StatusOK) == 2
+	})
+}
+
+func TestDDIConfigDataEveryPoll(t *testing.T) {
+	server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1})
+	args := map[string]interface{}{
+		"attributes":        map[string]interface{}{"revision": "rev-{{mod .Index 2}}"},
+		"attributesMode":    "replace",
+		"attributesRefresh": "poll",
+	}
+	if _, err := startFactoryDevice(t, endpoint, "ddi3", 3, args); err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+
+	templatestest.WaitFor(t, "third poll", 4*time.Second, func() bool { return server.Device("ddi3").Polls >= 3 })
+	device := server.Device("ddi3")
+	if device.Uploads < device.Polls-1 {
+		t.Errorf("got %d uploads for %d polls, want an upload at every poll", device.Uploads, device.Polls)
+	}
+	if want := map[string]string{"revision": "rev-1"}; !reflect.DeepEqual(device.Attributes, want) {
+		t.Errorf("got attributes %v, want %v", device.Attributes, want)
+	}
+}
+
+func TestDDIPollingSleep(t *testing.T) {
+	// the server dictates a polling interval of 1s, the configured poll delay is 30s
+	server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1, Download: hawkbit.HANDLING_SKIP})
+	for _, id := range []string{"server", "override"} {
+		_, err := startFactoryDevice(t, endpoint, id, 0, map[string]interface{}{"pollDelay": 30, "overridePolling": id == "override"})
+		if err != nil {
+			t.Fatalf("Start %s: %s", id, err)
+		}
+	}
+
+	templatestest.WaitFor(t, "third poll", taskTimeout, func() bool { return server.Device("server").Polls >= 3 })
+	if polls := server.Device("override").Polls; polls != 1 {
+		t.Errorf("got %d polls with the overridden polling interval, want 1", polls)
+	}
+}
+
+func TestDDIAuthentication(t *testing.T) {
+	config := ddimock.DDIServerConfig{
+		Seed:         1,
+		GatewayToken: "gateway",
+		TargetTokens: map[string]string{"ddi0": "DEFAULT-ddi0"},
+	}
+
+	tests := []struct {
+		name         string
+		server       func(config *ddimock.DDIServerConfig)
+		args         map[string]interface{}
+		connected    bool
+		success      bool
+		auth         string // authentication scheme recorded by the server
+		unauthorized bool
+	}{
+		{"gateway token", nil, map[string]interface{}{"authMode": "gateway"}, true, true, "GatewayToken", false},
+		{"target token", nil, map[string]interface{}{"authMode": "target", "targetToken": "{{.Tenant}}-{{.ID}}"}, true, true, "TargetToken", false},
+		{"invalid gateway token", nil, map[string]interface{}{"authMode": "gateway", "gatewayToken": "invalid"}, false, false, "", true},
+		{"invalid target token", nil, map[string]interface{}{"authMode": "target", "targetToken": "{{.ID}}"}, false, false, "", true},
+		{"anonymous rejected", nil, map[string]interface{}{"authMode": "anonymous"}, false, false, "", true},
+		{"anonymous", func(config *ddimock.DDIServerConfig) { config.Anonymous = true },
+			map[string]interface{}{"authMode": "anonymous"}, true, true, "anonymous", false},
+		{"anonymous download", func(config *ddimock.DDIServerConfig) { config.AnonymousDownload = true },
+			map[string]interface{}{"authMode": "gateway", "anonymousDownload": true}, true, true, "GatewayToken", false},
+		{"anonymous download rejected", nil,
+			map[string]interface{}{"authMode": "gateway", "anonymousDownload": true}, true, false, "GatewayToken", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := config
+			if test.server != nil {
+				test.server(&config)
+			}
+			server, endpoint := startDDIServer(t, config)
+			controller, err := startFactoryDevice(t, endpoint, "ddi0", 0, test.args)
+			if controller == nil {
+				t.Fatalf("NewDevice: %s", err)
+			}
+			if connected := err == nil; connected != test.connected {
+				t.Fatalf("got connected %t (error %v), want %t", connected, err, test.connected)
+			}
+			if test.connected {
+				templatestest.WaitTask(t, controller, taskTimeout)
+			}
+
+			if success, _ := controller.Result(); success != test.success {
+				t.Errorf("got success %t, want %t", success, test.success)
+			}
+			auth := "" // the rejected device is unknown to the server
+			if device := server.Device("ddi0"); device != nil {
+				auth = device.Auth
+			}
+			if auth != test.auth {
+				t.Errorf("got authentication %q, want %q", auth, test.auth)
+			}
+			if unauthorized := server.UnauthorizedCount() > 0; unauthorized != test.unauthorized {
+				t.Errorf("got unauthorized requests %t, want %t", unauthorized, test.unauthorized)
+			}
+		})
+	}
+}
+
+func TestDDIAuthenticationMissingTargetToken(t *testing.T) {
+	tokens := filepath.Join(t.TempDir(), "tokens.csv")
+	if err := os.WriteFile(tokens, []byte("ddi0,secret0\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	// the device without target token cannot be created
+	_, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1})
+	args := map[string]interface{}{"authMode": "target", "targetTokens": tokens}
+	if _, err := startFactoryDevice(t, endpoint, "ddi1", 1, args); err == nil {
+		t.Error("got no error for a device without target token, want an error")
+	}
+}
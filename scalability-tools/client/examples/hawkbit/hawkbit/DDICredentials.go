@@ -0,0 +1,104 @@
+package hawkbit
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	AUTH_GATEWAY   = "gateway"   // all the devices share the gateway token of the tenant
+	AUTH_TARGET    = "target"    // each device has its own target token
+	AUTH_ANONYMOUS = "anonymous" // no credentials
+)
+
+// DDICredentials gives the credentials of the devices, according to the authentication mode. Target tokens are either read
+// from a credentials file or generated from a Go template of the device, e.g. "{{.ID}}-secret"
+type DDICredentials struct {
+	mode          string
+	gatewayToken  string
+	targetTokens  map[string]string
+	tokenTemplate *template.Template
+}
+
+// newDDICredentials creates the credentials of the devices. The target tokens file and template are only used in target mode
+func newDDICredentials(mode string, gatewayToken string, tokensPath string, tokenTemplate string) (*DDICredentials, error) {
+	c := &DDICredentials{mode: mode, gatewayToken: gatewayToken}
+
+	switch mode {
+	case AUTH_GATEWAY:
+		if len(gatewayToken) == 0 {
+			return nil, xerrors.Errorf("Missing mandatory input (gatewayToken) for the gateway authentication")
+		}
+	case AUTH_TARGET:
+		var err error
+		switch {
+		case len(tokensPath) > 0:
+			c.targetTokens, err = LoadTargetTokens(tokensPath)
+		case len(tokenTemplate) > 0:
+			c.tokenTemplate, err = template.New("targetToken").Funcs(attributeFuncs).Option("missingkey=error").Parse(tokenTemplate)
+		default:
+			err = xerrors.Errorf("Missing mandatory input (targetTokens or targetToken) for the target authentication")
+		}
+		if err != nil {
+			return nil, err
+		}
+	case AUTH_ANONYMOUS:
+	default:
+		return nil, xerrors.Errorf("Invalid input (authMode). Expected: gateway, target or anonymous")
+	}
+
+	return c, nil
+}
+
+// LoadTargetTokens reads a credentials file. Each line holds the controller id of a device and its target token,
+// separated by a comma. Lines starting with # are ignored
+func LoadTargetTokens(path string) (tokens map[string]string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("Fail to open the target tokens: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid target tokens %s: %w", path, err)
+	}
+
+	tokens = make(map[string]string, len(records))
+	for _, record := range records {
+		tokens[record[0]] = record[1]
+	}
+	return tokens, nil
+}
+
+// authorization returns the value of the Authorization header of a device, empty for anonymous devices
+func (c *DDICredentials) authorization(data AttributesData) (string, error) {
+	switch c.mode {
+	case AUTH_GATEWAY:
+		return fmt.Sprintf("GatewayToken %s", c.gatewayToken), nil
+	case AUTH_TARGET:
+		if c.tokenTemplate != nil {
+			var token strings.Builder
+			err := c.tokenTemplate.Execute(&token, data)
+			if err != nil {
+				return "", xerrors.Errorf("Fail to generate the target token of %s: %w", data.ID, err)
+			}
+			return fmt.Sprintf("TargetToken %s", token.String()), nil
+		}
+		token, ok := c.targetTokens[data.ID]
+		if !ok {
+			return "", xerrors.Errorf("No target token for %s", data.ID)
+		}
+		return fmt.Sprintf("TargetToken %s", token), nil
+	}
+	return "", nil
+}
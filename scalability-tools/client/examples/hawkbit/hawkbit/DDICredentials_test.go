@@ -0,0 +1,97 @@
+package hawkbit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTargetTokens writes a credentials file in the test directory
+func writeTargetTokens(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "tokens.csv")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	return path
+}
+
+func TestDDICredentialsAuthorization(t *testing.T) {
+	tokens := writeTargetTokens(t, "# controller id, target token\nddi0,secret0\nddi1, secret1\n")
+	device := AttributesData{ID: "ddi1", Index: 1, Tenant: "DEFAULT"}
+
+	tests := []struct {
+		name          string
+		mode          string
+		gatewayToken  string
+		tokensPath    string
+		tokenTemplate string
+		want          string
+	}{
+		{"gateway", AUTH_GATEWAY, "gateway", "", "", "GatewayToken gateway"},
+		{"target tokens file", AUTH_TARGET, "", tokens, "", "TargetToken secret1"},
+		{"target token template", AUTH_TARGET, "", "", "{{.Tenant}}-{{.ID}}-{{add .Index 1}}", "TargetToken DEFAULT-ddi1-2"},
+		{"file before template", AUTH_TARGET, "", tokens, "{{.ID}}", "TargetToken secret1"},
+		{"anonymous", AUTH_ANONYMOUS, "gateway", "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			credentials, err := newDDICredentials(test.mode, test.gatewayToken, test.tokensPath, test.tokenTemplate)
+			if err != nil {
+				t.Fatalf("newDDICredentials: %s", err)
+			}
+			got, err := credentials.authorization(device)
+			if err != nil {
+				t.Fatalf("authorization: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	// a device missing from the credentials file cannot authenticate
+	credentials, _ := newDDICredentials(AUTH_TARGET, "", tokens, "")
+	if _, err := credentials.authorization(AttributesData{ID: "ddi2"}); err == nil {
+		t.Error("got no error for a device without target token, want an error")
+	}
+}
+
+func TestNewDDICredentialsInvalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          string
+		gatewayToken  string
+		tokensPath    string
+		tokenTemplate string
+	}{
+		{"unknown mode", "certificate", "gateway", "", ""},
+		{"missing gateway token", AUTH_GATEWAY, "", "", ""},
+		{"missing target tokens", AUTH_TARGET, "gateway", "", ""},
+		{"missing tokens file", AUTH_TARGET, "", filepath.Join(t.TempDir(), "missing.csv"), ""},
+		{"invalid token template", AUTH_TARGET, "", "", "{{.ID"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newDDICredentials(test.mode, test.gatewayToken, test.tokensPath, test.tokenTemplate); err == nil {
+				t.Error("got no error, want an invalid input error")
+			}
+		})
+	}
+}
+
+func TestLoadTargetTokens(t *testing.T) {
+	tokens, err := LoadTargetTokens(writeTargetTokens(t, "ddi0,secret0\n# ddi1,secret1\nddi2,  secret2\n"))
+	if err != nil {
+		t.Fatalf("LoadTargetTokens: %s", err)
+	}
+	if want := map[string]string{"ddi0": "secret0", "ddi2": "secret2"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("got %v, want %v", tokens, want)
+	}
+
+	if _, err := LoadTargetTokens(writeTargetTokens(t, "ddi0,secret0\nddi1\n")); err == nil {
+		t.Error("got no error for a line without target token, want an error")
+	}
+}
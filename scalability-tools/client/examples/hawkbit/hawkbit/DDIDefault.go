@@ -0,0 +1,154 @@
+package hawkbit
+
+import (
+	"hitachienergy/scalability-test-client/examples/httppool"
+	"hitachienergy/scalability-test-client/registry"
+	"hitachienergy/scalability-test-client/templates"
+
+	"golang.org/x/xerrors"
+)
+
+// ------------------------------------ Client Factory -----------------------------------
+
+func init() {
+	registry.Register("HawkbitDDIDefaultFactory", DDIDefaultClientFactory{})
+}
+
+type DDIDefaultClientFactory struct {
+	templates.DeviceFactory
+	Config      HawkbitConfig
+	Attributes  *DDIAttributes
+	Credentials *DDICredentials
+}
+
+func (d DDIDefaultClientFactory) ParseConfig(data []byte) (templates.DeviceFactory, error) {
+	configs, err := ParseConfig(data)
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid config structure for devices simulation")
+	}
+	d.Config = *configs
+
+	err = ddiCheckAndSetInputs(d.Config.Client.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	// the attribute templates are parsed once for all the devices
+	if attributes, ok := d.Config.Client.Args["attributes"].(map[string]interface{}); ok {
+		d.Attributes, err = newDDIAttributes(attributes, d.Config.Client.Args["attributesMode"].(string), d.Config.Client.Args["attributesRefresh"].(string))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the target tokens are loaded once for all the devices
+	d.Credentials, err = newDDICredentials(d.Config.Client.Args["authMode"].(string),
+		d.Config.Client.Args["gatewayToken"].(string),
+		d.Config.Client.Args["targetTokens"].(string),
+		d.Config.Client.Args["targetToken"].(string),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d DDIDefaultClientFactory) NewDevice(controller templates.Controller) (client templates.Device, err error) {
+	params := d.Config.Client.Args
+	baseEndpoint := d.Config.Server.DevicesEndpoint
+
+	httpPoolSize := params["httpPoolSize"].(int)
+	if httpPoolSize > 0 {
+		httppool.Pool.Init(httpPoolSize)
+	}
+
+	authorization, err := d.Credentials.authorization(AttributesData{
+		ID:     controller.GetIdentifier(),
+		Index:  controller.GetIndex(),
+		Tenant: params["tenant"].(string),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client = NewDDIClient(controller,
+		params["tenant"].(string),
+		params["pollDelay"].(int),
+		params["overridePolling"].(bool),
+		params["attemptDelay"].(int),
+		baseEndpoint,
+		authorization,
+		params["anonymousDownload"].(bool),
+		httpPoolSize > 0,
+		params["discardArtifacts"].(bool),
+		d.Attributes,
+	)
+
+	return client, nil
+}
+
+func ddiCheckAndSetInputs(params map[string]interface{}) (err error) {
+	if _, ok := params["tenant"]; !ok {
+		return xerrors.Errorf("Missing mandatory input (tenant)")
+	}
+
+	if _, ok := params["pollDelay"]; !ok {
+		params["pollDelay"] = 30 // default poll delay: 30s
+	}
+	if _, ok := params["pollDelay"].(int); !ok {
+		return xerrors.Errorf("Invalid input (pollDelay). Expected: int")
+	}
+	if _, ok := params["overridePolling"]; !ok {
+		params["overridePolling"] = false // default: poll at the interval dictated by the server
+	} else if _, ok := params["overridePolling"].(bool); !ok {
+		return xerrors.Errorf("Invalid input (overridePolling). Expected: bool")
+	}
+	if _, ok := params["attemptDelay"]; !ok {
+		params["attemptDelay"] = 0 // default: attempted downloads and updates are handled at once, like forced ones
+	} else if _, ok := params["attemptDelay"].(int); !ok {
+		return xerrors.Errorf("Invalid input (attemptDelay). Expected: int")
+	}
+	if _, ok := params["httpPoolSize"].(int); !ok {
+		params["httpPoolSize"] = 0 // default: not use HTTPPool (no limit on HTTP Connections)
+	}
+	if _, ok := params["discardArtifacts"]; !ok {
+		params["discardArtifacts"] = false // default: keep the downloaded artifacts in memory
+	} else if _, ok := params["discardArtifacts"].(bool); !ok {
+		return xerrors.Errorf("Invalid input (discardArtifacts). Expected: bool")
+	}
+	if _, ok := params["attributes"]; ok {
+		if _, ok := params["attributes"].(map[string]interface{}); !ok {
+			return xerrors.Errorf("Invalid input (attributes). Expected: map of attribute templates")
+		}
+	}
+	if _, ok := params["attributesMode"]; !ok {
+		params["attributesMode"] = "merge" // default: the uploaded attributes are merged with the existing ones
+	} else if _, ok := params["attributesMode"].(string); !ok {
+		return xerrors.Errorf("Invalid input (attributesMode). Expected: string")
+	}
+	if _, ok := params["attributesRefresh"]; !ok {
+		params["attributesRefresh"] = REFRESH_REQUESTED // default: upload the attributes when the server requests them
+	} else if _, ok := params["attributesRefresh"].(string); !ok {
+		return xerrors.Errorf("Invalid input (attributesRefresh). Expected: string")
+	}
+	if _, ok := params["authMode"]; !ok {
+		params["authMode"] = AUTH_GATEWAY // default: the devices authenticate with the gateway token
+	} else if _, ok := params["authMode"].(string); !ok {
+		return xerrors.Errorf("Invalid input (authMode). Expected: string")
+	}
+	for _, key := range []string{"gatewayToken", "targetTokens", "targetToken"} {
+		if _, ok := params[key]; !ok {
+			params[key] = "" // checked against the authentication mode
+		} else if _, ok := params[key].(string); !ok {
+			return xerrors.Errorf("Invalid input (%s). Expected: string", key)
+		}
+	}
+	if _, ok := params["anonymousDownload"]; !ok {
+		params["anonymousDownload"] = false // default: the artifacts are downloaded with the credentials of the device
+	} else if _, ok := params["anonymousDownload"].(bool); !ok {
+		return xerrors.Errorf("Invalid input (anonymousDownload). Expected: bool")
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"hitachienergy/scalability-test-client/examples/httppool"
+	"hitachienergy/scalability-test-client/templates"
 	"io"
 	"net/http"
 	"strconv"
@@ -14,32 +15,47 @@ import (
 )
 
 type DDIRestApi struct {
-	tenant string
-	id     string
+	tenant     string
+	id         string
+	controller templates.Controller
 
 	baseEndpoint string
-	gatewayToken string
+
+	authorization     string // value of the Authorization header, empty for anonymous requests
+	anonymousDownload bool   // artifacts are downloaded without credentials
 
 	usePool bool
 }
 
 // newDDIRestApi creates a new instance of DDIRestApi
-func newDDIRestApi(id string, tenant string, baseEndpoint string, gatewayToken string, usePool bool) *DDIRestApi {
+func newDDIRestApi(controller templates.Controller, tenant string, baseEndpoint string, authorization string, anonymousDownload bool, usePool bool) *DDIRestApi {
 	r := DDIRestApi{
-		id:           id,
-		tenant:       tenant,
-		baseEndpoint: baseEndpoint,
-		gatewayToken: gatewayToken,
-		usePool:      usePool,
+		id:                controller.GetIdentifier(),
+		controller:        controller,
+		tenant:            tenant,
+		baseEndpoint:      baseEndpoint,
+		authorization:     authorization,
+		anonymousDownload: anonymousDownload,
+		usePool:           usePool,
 	}
 
 	return &r
 }
 
+// authorize adds the credentials of the device to the request, if it is not anonymous
+func (r *DDIRestApi) authorize(req *http.Request) {
+	if len(r.authorization) > 0 {
+		req.Header.Add("Authorization", r.authorization)
+	}
+}
+
 // getActionId extracts the action id from the link
 func getActionId(link string) (id int64, err error) {
 	startIndex := strings.LastIndex(link, "/") + 1
 	endIndex := strings.Index(link, "?")
+	if endIndex < startIndex {
+		endIndex = len(link)
+	}
 
 	id, err = strconv.ParseInt(link[startIndex:endIndex], 10, 64)
 	if err != nil {
@@ -49,35 +65,35 @@ func getActionId(link string) (id int64, err error) {
 	return id, nil
 }
 
-// getRequiredLink polls the server for the newest information and extracts the target link from the response
-func (r *DDIRestApi) getRequiredLink(basekey string) (link string, err error) {
+// getControllerBase polls the server for the newest information, i.e. the polling configuration and the links to the actions
+func (r *DDIRestApi) getControllerBase() (base *ControllerBase, err error) {
 	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/%s/controller/v1/%s", r.baseEndpoint, r.tenant, r.id), nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Add("Accept", "application/hal+json")
-	req.Header.Add("Authorization", fmt.Sprintf("GatewayToken %s", r.gatewayToken))
-	res, err := r.send(req)
+	r.authorize(req)
+	res, err := r.send("ddi/controllerBase", req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode > 299 {
-		return "", xerrors.Errorf("Fail to get %s. Status code: %d (%s)", basekey, res.StatusCode, res.Status)
+		return nil, xerrors.Errorf("Fail to get controller base. Status code: %d (%s)", res.StatusCode, res.Status)
 	}
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	var data ControllerBase
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return data.Links[basekey].Href, nil
+	return &data, nil
 }
 
 // getActionWithDeployment gets a new deployment information by sending the related messages to the server
@@ -87,8 +103,8 @@ func (r *DDIRestApi) getActionWithDeployment(actionID int64) (deployment *Deploy
 		return nil, err
 	}
 	req.Header.Add("Accept", "application/hal+json")
-	req.Header.Add("Authorization", fmt.Sprintf("GatewayToken %s", r.gatewayToken))
-	res, err := r.send(req)
+	r.authorize(req)
+	res, err := r.send("ddi/deploymentBase", req)
 	if err != nil {
 		return nil, err
 	}
@@ -111,10 +127,73 @@ func (r *DDIRestApi) getActionWithDeployment(actionID int64) (deployment *Deploy
 	return &data.Deployment, nil
 }
 
-// sendConfirmation sends a confirmation message to the server
-func (r *DDIRestApi) sendConfirmation(actionID int64, status string) (err error) {
-	payload := map[string]interface{}{
-		"confirmation": status,
+// getConfirmationAction gets the action waiting for the consent of the user
+func (r *DDIRestApi) getConfirmationAction(actionID int64) (deployment *Deployment, err error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/%s/controller/v1/%s/confirmationBase/%d", r.baseEndpoint, r.tenant, r.id, actionID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/hal+json")
+	r.authorize(req)
+	res, err := r.send("ddi/confirmationBase", req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 {
+		return nil, xerrors.Errorf("Fail to get action waiting for confirmation. Status code: %d (%s)", res.StatusCode, res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	var data ConfirmationBaseAction
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Confirmation, nil
+}
+
+// getCancelAction gets the cancel action and returns the id of the action to stop
+func (r *DDIRestApi) getCancelAction(actionID int64) (stopID int64, err error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/%s/controller/v1/%s/cancelAction/%d", r.baseEndpoint, r.tenant, r.id, actionID), nil)
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Add("Accept", "application/hal+json")
+	r.authorize(req)
+	res, err := r.send("ddi/cancelAction", req)
+	if err != nil {
+		return -1, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 {
+		return -1, xerrors.Errorf("Fail to get cancel action. Status code: %d (%s)", res.StatusCode, res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return -1, err
+	}
+	var data ActionWithCancel
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return -1, err
+	}
+
+	return strconv.ParseInt(data.CancelAction.StopID, 10, 64)
+}
+
+// sendConfirmation sends a confirmation message to the server. The status is either "confirmed" or "denied"
+func (r *DDIRestApi) sendConfirmation(actionID int64, status string, details []string) (err error) {
+	payload := DDIConfirmationFeedback{
+		Confirmation: status,
+		Details:      details,
 	}
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
@@ -129,8 +208,8 @@ func (r *DDIRestApi) sendConfirmation(actionID int64, status string) (err error)
 	}
 	req.Header.Add("Content-Type", "application/json;charset=UTF-8")
 	req.Header.Add("Accept", "application/hal+json")
-	req.Header.Add("Authorization", fmt.Sprintf("GatewayToken %s", r.gatewayToken))
-	res, err := r.send(req)
+	r.authorize(req)
+	res, err := r.send("ddi/confirmationFeedback", req)
 	if err != nil {
 		return err
 	}
@@ -143,6 +222,39 @@ func (r *DDIRestApi) sendConfirmation(actionID int64, status string) (err error)
 	return nil
 }
 
+// sendConfigData uploads the attributes of the device to the server
+func (r *DDIRestApi) sendConfigData(mode string, attributes map[string]string) (err error) {
+	payload := DDIConfigData{
+		Mode: mode,
+		Data: attributes,
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT",
+		fmt.Sprintf("http://%s/%s/controller/v1/%s/configData", r.baseEndpoint, r.tenant, r.id),
+		bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json;charset=UTF-8")
+	req.Header.Add("Accept", "application/hal+json")
+	r.authorize(req)
+	res, err := r.send("ddi/configData", req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 {
+		return xerrors.Errorf("Fail to put config data. Status code: %d (%s)", res.StatusCode, res.Status)
+	}
+
+	return nil
+}
+
 // reportUpdate reports update status to the server
 func (r *DDIRestApi) reportUpdate(actionID int64, localStatus LocalUpdateStatus) (err error) {
 	status := DDIUpdateStatus{
@@ -166,6 +278,12 @@ func (r *DDIRestApi) reportUpdate(actionID int64, localStatus LocalUpdateStatus)
 	case RUNNING:
 		status.Execution = "proceeding"
 		status.Result.Finished = "none"
+	case WARNING:
+		status.Execution = "proceeding" // DDI has no warning status, the warning is in the details
+		status.Result.Finished = "none"
+	case DENIED:
+		status.Execution = "rejected"
+		status.Result.Finished = "none"
 	}
 
 	return r.sendUpdateFeedback(actionID, status)
@@ -173,6 +291,17 @@ func (r *DDIRestApi) reportUpdate(actionID int64, localStatus LocalUpdateStatus)
 
 // sendUpdateFeedback sends an update feedback message to the server
 func (r *DDIRestApi) sendUpdateFeedback(actionID int64, status DDIUpdateStatus) (err error) {
+	return r.sendFeedback(DeploymentBase, "ddi/deploymentFeedback", actionID, status)
+}
+
+// sendCancelFeedback sends the feedback of a cancel action to the server. A closed execution accepts the cancellation
+// while a rejected execution lets the action continue
+func (r *DDIRestApi) sendCancelFeedback(actionID int64, status DDIUpdateStatus) (err error) {
+	return r.sendFeedback(CancelAction, "ddi/cancelFeedback", actionID, status)
+}
+
+// sendFeedback sends a feedback message about an action of the basekey resource to the server
+func (r *DDIRestApi) sendFeedback(basekey string, endpoint string, actionID int64, status DDIUpdateStatus) (err error) {
 	payload := DDIUpdateFeedback{
 		Status: status,
 	}
@@ -182,36 +311,35 @@ func (r *DDIRestApi) sendUpdateFeedback(actionID int64, status DDIUpdateStatus)
 	}
 
 	req, err := http.NewRequest("POST",
-		fmt.Sprintf("http://%s/%s/controller/v1/%s/deploymentBase/%d/feedback", r.baseEndpoint, r.tenant, r.id, actionID),
+		fmt.Sprintf("http://%s/%s/controller/v1/%s/%s/%d/feedback", r.baseEndpoint, r.tenant, r.id, basekey, actionID),
 		bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return err
 	}
 	req.Header.Add("Content-Type", "application/json;charset=UTF-8")
 	req.Header.Add("Accept", "application/hal+json")
-	req.Header.Add("Authorization", fmt.Sprintf("GatewayToken %s", r.gatewayToken))
+	r.authorize(req)
 
-	res, err := r.send(req)
+	res, err := r.send(endpoint, req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode > 299 {
-		return xerrors.Errorf("Fail to post update feedback. Status code: %d (%s)", res.StatusCode, res.Status)
+		return xerrors.Errorf("Fail to post %s feedback. Status code: %d (%s)", basekey, res.StatusCode, res.Status)
 	}
 
 	return nil
 }
 
-// sendHTTP sends a simple http request. It can either send directly or using HTTP Pool
-func (r *DDIRestApi) send(request *http.Request) (*http.Response, error) {
+// send sends a simple http request with the client of the device.
+// The result of the request is reported to the controller under the given endpoint name
+func (r *DDIRestApi) send(endpoint string, request *http.Request) (res *http.Response, err error) {
 	request.Close = true
+	defer func() {
+		r.controller.ReportRequest(endpoint, statusCode(res), err)
+	}()
 
-	if !r.usePool {
-		return httppool.Client.Do(request)
-	}
-	client := httppool.Pool.Get()
-	defer httppool.Pool.Put(client)
-	return client.Do(request)
+	return httppool.Do(r.controller.GetNetwork(), r.usePool, request)
 }
@@ -1,39 +1,63 @@
 package hawkbit
 
 import (
-	"crypto/sha1"
-	"crypto/tls"
-	"encoding/hex"
+	"context"
 	"fmt"
+	"hitachienergy/scalability-test-client/examples/httppool"
 	"io"
 	"net/http"
-	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 )
 
 /** Update Manager **/
 
+const (
+	// MAINTENANCE_WINDOW is the phase reached when the maintenance window of a downloaded update opens
+	MAINTENANCE_WINDOW = "MAINTENANCE_WINDOW"
+	// POSTPONED is the phase reached when the device stops postponing the installation of an attempted update
+	POSTPONED = "POSTPONED"
+)
+
 type DDIUpdateManager struct {
 	// UpdateManagerDDI
 
 	*sync.Mutex
-	CurrentActionID int64
-	IsUpdating      bool
+	CurrentActionID      int64
+	ConfirmationActionID int64 // action confirmed or denied by the user
+	IsUpdating           bool
 	// status          LocalUpdateStatus
 
+	installing         bool
+	stopUpdate         context.CancelFunc // stops the running update
+	downloadedActionID int64              // action downloaded and waiting for its maintenance window or its postponed installation
+	waitPhase          string             // phase reached once the downloaded action is installed
+
+	attemptDelay    time.Duration // how long the device postpones the attempted downloads and updates
+	attemptActionID int64         // action postponed by the device
+	attemptSince    time.Time     // first time the device postponed the action
+
+	keepArtifacts bool
+
 	*DDIClient
 }
 
-// newDDIUpdateManager creates a new instance of DDI update manager
-func newDDIUpdateManager(client *DDIClient) *DDIUpdateManager {
+// newDDIUpdateManager creates a new instance of DDI update manager. The attempted downloads and updates are postponed by
+// attemptDelay. The downloaded artifacts are only hashed and counted if they are discarded
+func newDDIUpdateManager(client *DDIClient, attemptDelay time.Duration, discardArtifacts bool) *DDIUpdateManager {
 	return &DDIUpdateManager{
 		// status:          LocalUpdateStatus{status: IDLE},
-		CurrentActionID: -1,
-		DDIClient:       client,
-		IsUpdating:      false,
-		Mutex:           &sync.Mutex{},
+		CurrentActionID:      -1,
+		ConfirmationActionID: -1,
+		downloadedActionID:   -1,
+		attemptDelay:         attemptDelay,
+		attemptActionID:      -1,
+		DDIClient:            client,
+		IsUpdating:           false,
+		Mutex:                &sync.Mutex{},
+		keepArtifacts:        !discardArtifacts,
 	}
 }
 
@@ -57,6 +81,11 @@ func (u *DDIUpdateManager) resetUpdate(id int64) bool {
 	defer u.Unlock()
 
 	u.IsUpdating = false
+	u.installing = false
+	if u.stopUpdate != nil {
+		u.stopUpdate()
+		u.stopUpdate = nil
+	}
 	if id >= 0 {
 		u.CurrentActionID = id
 	}
@@ -64,51 +93,238 @@ func (u *DDIUpdateManager) resetUpdate(id int64) bool {
 	return true
 }
 
-// tryState checks if there is current an update happening and tries the lock
-func (u *DDIUpdateManager) tryState(id int64) bool {
+// tryState checks if there is current an update happening and tries the lock. It returns the context of the update,
+// cancelled if the update is cancelled, or nil if the update must not start
+func (u *DDIUpdateManager) tryState(id int64) (ctx context.Context) {
 	u.Lock()
 	defer u.Unlock()
 
 	if u.IsUpdating || u.CurrentActionID == id {
-		return false
+		return nil
 	}
 	u.IsUpdating = true
+	// the update also stops when the device crashes
+	ctx, u.stopUpdate = context.WithCancel(u.ctx)
+	return ctx
+}
+
+// setDownloaded records that the artifacts of the action are downloaded, or forgets it if id is -1
+func (u *DDIUpdateManager) setDownloaded(id int64) {
+	u.Lock()
+	defer u.Unlock()
+
+	u.downloadedActionID = id
+}
+
+// isDownloaded checks if the artifacts of the action are already downloaded
+func (u *DDIUpdateManager) isDownloaded(id int64) bool {
+	u.Lock()
+	defer u.Unlock()
+
+	return u.downloadedActionID == id
+}
+
+// postponeAttempt checks if the device still postpones an attempted download or update of the action. The delay starts
+// when the device first postpones the action. Skipped and forced handlings are never postponed
+func (u *DDIUpdateManager) postponeAttempt(id int64, handling string) bool {
+	u.Lock()
+	defer u.Unlock()
+
+	if handling != HANDLING_ATTEMPT || u.attemptDelay <= 0 {
+		return false
+	}
+	if u.attemptActionID != id {
+		u.attemptActionID = id
+		u.attemptSince = time.Now()
+	}
+	return time.Since(u.attemptSince) < u.attemptDelay
+}
+
+// tryInstall marks the running update as installing, unless it was cancelled
+func (u *DDIUpdateManager) tryInstall(ctx context.Context) bool {
+	u.Lock()
+	defer u.Unlock()
+
+	if ctx.Err() != nil {
+		return false
+	}
+	u.installing = true
+	return true
+}
+
+// cancelUpdate cancels an action. The running update is stopped, unless it is already installing.
+// An action not received yet is marked as handled and its task is cancelled. It returns false if the cancellation is rejected
+func (u *DDIUpdateManager) cancelUpdate(id int64) bool {
+	u.Lock()
+	if u.IsUpdating {
+		defer u.Unlock()
+		if u.installing {
+			return false
+		}
+		// the update stops and cancels its task
+		u.stopUpdate()
+		return true
+	}
+	handled := u.CurrentActionID == id
+	u.CurrentActionID = id
+	u.downloadedActionID = -1
+	u.Unlock()
+
+	if !handled {
+		u.controller.MarkPhase(CANCEL.String())
+		u.controller.CancelTask()
+	}
+	return true
+}
+
+// tryConfirmation checks if the action still needs the consent of the user and locks the confirmation
+func (u *DDIUpdateManager) tryConfirmation(id int64) bool {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.IsUpdating || u.CurrentActionID == id || u.ConfirmationActionID == id {
+		return false
+	}
+	u.ConfirmationActionID = id
 	return true
 }
 
-// startUpdate launches an update simulation
+// isHandled checks if an update is running, or if the action was already handled, e.g. cancelled
+func (u *DDIUpdateManager) isHandled(id int64) bool {
+	u.Lock()
+	defer u.Unlock()
+
+	return u.IsUpdating || u.CurrentActionID == id
+}
+
+// resetConfirmation releases the confirmation lock, so that the action is confirmed again at the next poll
+func (u *DDIUpdateManager) resetConfirmation(id int64) {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.ConfirmationActionID == id {
+		u.ConfirmationActionID = -1
+	}
+}
+
+// confirmUpdate simulates the consent of the user to an action waiting for confirmation. After the confirmation delay,
+// the device denies the action if the user denies the confirmation, and confirms it otherwise.
+// Once confirmed, the action is deployed at the next poll. The confirmation must be locked by tryConfirmation
+func (u *DDIUpdateManager) confirmUpdate(actionID int64) (err error) {
+	outcome := u.controller.GetUpdateOutcome()
+	time.Sleep(outcome.ConfirmationDelay)
+	if u.isHandled(actionID) || u.ctx.Err() != nil {
+		// cancelled while the user was deciding, or the device crashed
+		return nil
+	}
+
+	if outcome.DenyConfirmation {
+		err = u.sendConfirmation(actionID, "denied", []string{"Update denied by the user"})
+		if err != nil {
+			u.resetConfirmation(actionID)
+			return err
+		}
+		u.controller.MarkPhase(DENIED.String())
+		u.controller.CompleteTask(false)
+		return nil
+	}
+
+	err = u.sendConfirmation(actionID, "confirmed", []string{"Update confirmed by the user"})
+	if err != nil {
+		u.resetConfirmation(actionID)
+		return err
+	}
+	u.controller.MarkPhase(CONFIRMED.String())
+	return nil
+}
+
+// reportPhase reports the update status to the server and marks the related phase of the task
+func (u *DDIUpdateManager) reportPhase(actionID int64, localStatus LocalUpdateStatus) (err error) {
+	// a crashed device does not report anymore, the rebooted instance resumes the action
+	if err = u.ctx.Err(); err != nil {
+		return err
+	}
+	err = u.reportUpdate(actionID, localStatus)
+	u.controller.MarkPhase(localStatus.Status.String())
+	return err
+}
+
+// startUpdate launches an update simulation. If the update is skipped because the maintenance window is unavailable, or if
+// the device postpones an attempted update, the action stays open after the download, and the update is installed at a
+// later poll, once the window is available or the attempt delay elapsed. Otherwise, a skipped update is a download only action
 func (u *DDIUpdateManager) startUpdate(actionID int64, deployment *Deployment) (err error) {
-	success := u.tryState(actionID)
-	if !success {
+	ctx := u.tryState(actionID)
+	if ctx == nil {
 		return nil
 	}
 
+	waiting := false
 	defer func() {
+		cancelled := ctx.Err() != nil // before resetUpdate, which releases the context
+		if waiting && !cancelled {
+			// the action is handled again at the next polls
+			u.resetUpdate(-1)
+			return
+		}
 		// TODO-Option: only set actionID for SUCCESS or ERROR
+		u.setDownloaded(-1)
 		u.resetUpdate(actionID)
+		if cancelled {
+			u.controller.MarkPhase(CANCEL.String())
+			u.controller.CancelTask()
+			err = nil
+			return
+		}
 		u.controller.CompleteTask(err == nil)
 	}()
 
-	err = u.reportUpdate(actionID, LocalUpdateStatus{RUNNING, []string{"Simulation begins!"}})
-	if err != nil {
-		return err
-	}
+	report := func(status LocalUpdateStatus) error { return u.reportPhase(actionID, status) }
+	downloaded := u.isDownloaded(actionID)
+	if !downloaded {
+		err = denyUpdate(u.controller, report)
+		if err != nil {
+			return err
+		}
 
-	err = u.simulateDownload(deployment.Chunks, actionID)
-	if err != nil {
-		return err
+		err = u.reportPhase(actionID, LocalUpdateStatus{RUNNING, []string{"Simulation begins!"}})
+		if err != nil {
+			return err
+		}
+
+		err = u.simulateDownload(ctx, deployment.Chunks, actionID)
+		if err != nil {
+			return err
+		}
+		u.setDownloaded(actionID)
 	}
 
-	if deployment.Update != "skip" {
-		err = u.reportUpdate(actionID, LocalUpdateStatus{SUCCESSFUL, []string{"Simulation complete!"}})
-		return err
+	if deployment.Update == HANDLING_SKIP {
+		if deployment.MaintenanceWindow == WINDOW_UNAVAILABLE {
+			u.controller.GetLogger().Debug().Msg("Waiting for the maintenance window")
+			u.waitPhase = MAINTENANCE_WINDOW
+			waiting = true
+		}
+		return nil
+	}
+	if u.postponeAttempt(actionID, deployment.Update) {
+		u.controller.GetLogger().Debug().Msg("Installation postponed")
+		u.waitPhase = POSTPONED
+		waiting = true
+		return nil
 	}
 
-	return nil
+	if downloaded {
+		// the time spent waiting for the maintenance window or the postponed installation
+		u.controller.MarkPhase(u.waitPhase)
+	}
+	if !u.tryInstall(ctx) {
+		return ctx.Err()
+	}
+	return installUpdate(u.controller, report)
 }
 
 // simulateDownload downloads firmware from remote platform
-func (u *DDIUpdateManager) simulateDownload(modules []Chunk, actionID int64) (err error) {
+func (u *DDIUpdateManager) simulateDownload(ctx context.Context, modules []Chunk, actionID int64) (err error) {
 	messages := []string{}
 	for _, chunk := range modules {
 		for _, artifact := range chunk.Artifacts {
@@ -117,7 +333,7 @@ func (u *DDIUpdateManager) simulateDownload(modules []Chunk, actionID int64) (er
 					artifact.Filename, artifact.Hashes["sha1"], artifact.Size))
 		}
 	}
-	err = u.reportUpdate(actionID, LocalUpdateStatus{DOWNLOADING, messages})
+	err = u.reportPhase(actionID, LocalUpdateStatus{DOWNLOADING, messages})
 	if err != nil {
 		return err
 	}
@@ -127,7 +343,11 @@ func (u *DDIUpdateManager) simulateDownload(modules []Chunk, actionID int64) (er
 	result := LocalUpdateStatus{Status: DOWNLOADED}
 	for _, chunk := range modules {
 		for _, artifact := range chunk.Artifacts {
-			status := u.handleArtifact(&artifact)
+			status := u.handleArtifact(ctx, &artifact)
+			if ctx.Err() != nil {
+				u.controller.GetLogger().Debug().Msg("Cancel downloading")
+				return ctx.Err()
+			}
 			result.StatusMsgs = append(result.StatusMsgs, status.StatusMsgs...)
 			if status.Status == ERROR {
 				err = xerrors.Errorf(result.StatusMsgs[0])
@@ -135,7 +355,7 @@ func (u *DDIUpdateManager) simulateDownload(modules []Chunk, actionID int64) (er
 			}
 		}
 	}
-	reportErr := u.reportUpdate(actionID, LocalUpdateStatus{result.Status, result.StatusMsgs})
+	reportErr := u.reportPhase(actionID, LocalUpdateStatus{result.Status, result.StatusMsgs})
 
 	// log.Info().Msgf("[%s] Finish downloading", u.id)
 
@@ -147,11 +367,11 @@ func (u *DDIUpdateManager) simulateDownload(modules []Chunk, actionID int64) (er
 }
 
 // handleArtifact handles the artifact including download and verification
-func (u *DDIUpdateManager) handleArtifact(artifact *DDIArtifact) (status LocalUpdateStatus) {
+func (u *DDIUpdateManager) handleArtifact(ctx context.Context, artifact *DDIArtifact) (status LocalUpdateStatus) {
 	if url, ok := artifact.Links["download"]; ok {
-		return u.downloadUrl(url.Href, artifact.Hashes["sha1"], artifact.Size)
+		return u.downloadUrl(ctx, url.Href, artifact.Hashes["sha1"], artifact.Size)
 	} else if url, ok := artifact.Links["download-http"]; ok {
-		return u.downloadUrl(url.Href, artifact.Hashes["sha1"], artifact.Size)
+		return u.downloadUrl(ctx, url.Href, artifact.Hashes["sha1"], artifact.Size)
 	} else {
 		return LocalUpdateStatus{Status: ERROR,
 			StatusMsgs: []string{fmt.Sprintf("No supported url for artifact %s (Expected: HTTPS, HTTP)", artifact.Filename)}}
@@ -159,56 +379,38 @@ func (u *DDIUpdateManager) handleArtifact(artifact *DDIArtifact) (status LocalUp
 }
 
 // downloadUrl downloads a file and do verification
-func (u *DDIUpdateManager) downloadUrl(url string, hash string, size int64) (status LocalUpdateStatus) {
-	data, err := u.download(url)
+func (u *DDIUpdateManager) downloadUrl(ctx context.Context, url string, hash string, size int64) (status LocalUpdateStatus) {
+	download := newArtifactDownload(u.keepArtifacts, size, u.controller.GetDownloadFault())
+	err := u.download(ctx, url, download)
 	if err != nil {
 		return LocalUpdateStatus{Status: ERROR, StatusMsgs: []string{fmt.Sprintf("Failed to download %s: %s", url, err)}}
 	}
 
-	contentSize := int64(len(data))
-	if contentSize != size {
-		return LocalUpdateStatus{Status: ERROR,
-			StatusMsgs: []string{fmt.Sprintf("Download %s has wrong content length (Expected: %d, Got %d)", url, size, contentSize)}}
-	}
-
-	myhash := sha1.New()
-	myhash.Write(data)
-	hashString := strings.ToLower(hex.EncodeToString(myhash.Sum(nil)))
-	if hashString != hash {
-		return LocalUpdateStatus{Status: ERROR,
-			StatusMsgs: []string{fmt.Sprintf("Download %s failed with SHA1 hash missmatch (Expected: %s, Got %s)", url, hash, hashString)}}
-	}
-
-	return LocalUpdateStatus{Status: SUCCESSFUL, StatusMsgs: []string{fmt.Sprintf("Download %s successfully (%d bytes)", url, contentSize)}}
+	return verifyArtifact(url, hash, size, download)
 }
 
-// download does the real file downloading
-func (u *DDIUpdateManager) download(url string) (body []byte, err error) {
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-
+// download does the real file downloading. The body is streamed to the writer
+func (u *DDIUpdateManager) download(ctx context.Context, url string, w io.Writer) (err error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Close = true // each download opens its own connection
+	if !u.anonymousDownload {
+		u.authorize(req)
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("GatewayToken %s", u.gatewayToken))
-	res, err := client.Do(req)
+	res, err := httppool.Do(u.controller.GetNetwork(), false, req)
+	u.controller.ReportRequest("ddi/download", statusCode(res), err)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode > 299 {
-		return nil, xerrors.Errorf("Fail to get action with deployment. Status code: %d (%s)", res.StatusCode, res.Status)
+		return xerrors.Errorf("Fail to get action with deployment. Status code: %d (%s)", res.StatusCode, res.Status)
 	}
 
-	body, err = io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return body, nil
+	_, err = io.Copy(w, res.Body)
+	return err
 }
@@ -0,0 +1,172 @@
+package hawkbit_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"hitachienergy/scalability-test-client/examples/hawkbit/ddimock"
+	"hitachienergy/scalability-test-client/examples/hawkbit/hawkbit"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates/templatestest"
+)
+
+func TestDDIConfirmation(t *testing.T) {
+	tests := []struct {
+		name      string
+		deny      bool
+		success   bool
+		phases    []string
+		confirmed int
+		denied    int
+	}{
+		{"confirmed", false, true, []string{"CONFIRMED", "RUNNING", "DOWNLOADING", "DOWNLOADED", "SUCCESSFUL"}, 1, 0},
+		{"denied", true, false, []string{"DENIED"}, 0, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1, Confirmation: true})
+			outcome := fault.UpdateOutcome{ConfirmationDelay: 100 * time.Millisecond, DenyConfirmation: test.deny}
+			controller, err := startDDIDevice(t, endpoint, "ddi0", outcome)
+			if err != nil {
+				t.Fatalf("Start: %s", err)
+			}
+			templatestest.WaitTask(t, controller, taskTimeout)
+
+			if success, _ := controller.Result(); success != test.success {
+				t.Errorf("got success %t, want %t", success, test.success)
+			}
+			if phases := controller.Phases(); !reflect.DeepEqual(phases, test.phases) {
+				t.Errorf("got phases %v, want %v", phases, test.phases)
+			}
+			if confirmed, denied := server.ConfirmationCount(); confirmed != test.confirmed || denied != test.denied {
+				t.Errorf("got %d confirmed and %d denied, want %d and %d", confirmed, denied, test.confirmed, test.denied)
+			}
+			if device := server.Device("ddi0"); device.Closed != test.success {
+				t.Errorf("got closed %t, want %t", device.Closed, test.success)
+			}
+		})
+	}
+}
+
+func TestDDICancel(t *testing.T) {
+	// the download is skipped, so that the action is cancelled before the device receives it
+	server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1, Download: hawkbit.HANDLING_SKIP})
+	controller, err := startDDIDevice(t, endpoint, "ddi0", fault.UpdateOutcome{})
+	if err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+	if !server.CancelAction("ddi0") {
+		t.Fatal("CancelAction: no open action")
+	}
+	templatestest.WaitTask(t, controller, taskTimeout)
+
+	if success, cancelled := controller.Result(); success || !cancelled {
+		t.Errorf("got success %t and cancelled %t, want a cancelled task", success, cancelled)
+	}
+	if phases := controller.Phases(); !reflect.DeepEqual(phases, []string{"CANCEL"}) {
+		t.Errorf("got phases %v, want [CANCEL]", phases)
+	}
+	templatestest.WaitFor(t, "cancellation feedback", taskTimeout, func() bool {
+		cancelled, _ := server.CancelCount()
+		return cancelled == 1
+	})
+	if device := server.Device("ddi0"); !device.Closed || device.Downloads != 0 {
+		t.Errorf("got closed %t and %d downloads, want a closed action without download", device.Closed, device.Downloads)
+	}
+}
+
+func TestDDIHandling(t *testing.T) {
+	tests := []struct {
+		name         string
+		download     string
+		update       string
+		attemptDelay int
+		closed       bool // a skipped update is a download only action, left open
+		phases       []string
+		minDuration  time.Duration // before the end of the task, from the start of the device
+	}{
+		{"forced", hawkbit.HANDLING_FORCED, hawkbit.HANDLING_FORCED, 2, true,
+			[]string{"RUNNING", "DOWNLOADING", "DOWNLOADED", "SUCCESSFUL"}, 0},
+		{"download only", hawkbit.HANDLING_FORCED, hawkbit.HANDLING_SKIP, 2, false,
+			[]string{"RUNNING", "DOWNLOADING", "DOWNLOADED"}, 0},
+		{"attempt without delay", hawkbit.HANDLING_ATTEMPT, hawkbit.HANDLING_ATTEMPT, 0, true,
+			[]string{"RUNNING", "DOWNLOADING", "DOWNLOADED", "SUCCESSFUL"}, 0},
+		{"attempted download", hawkbit.HANDLING_ATTEMPT, hawkbit.HANDLING_ATTEMPT, 2, true,
+			[]string{"RUNNING", "DOWNLOADING", "DOWNLOADED", "SUCCESSFUL"}, 2 * time.Second},
+		{"attempted update", hawkbit.HANDLING_FORCED, hawkbit.HANDLING_ATTEMPT, 2, true,
+			[]string{"RUNNING", "DOWNLOADING", "DOWNLOADED", "POSTPONED", "SUCCESSFUL"}, 2 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1, Download: test.download, Update: test.update})
+			start := time.Now()
+			controller, err := startFactoryDevice(t, endpoint, "ddi0", 0, map[string]interface{}{"attemptDelay": test.attemptDelay})
+			if err != nil {
+				t.Fatalf("Start: %s", err)
+			}
+			templatestest.WaitTask(t, controller, taskTimeout)
+
+			if success, _ := controller.Result(); !success {
+				t.Error("got a failed task, want a successful task")
+			}
+			if phases := controller.Phases(); !reflect.DeepEqual(phases, test.phases) {
+				t.Errorf("got phases %v, want %v", phases, test.phases)
+			}
+			if elapsed := time.Since(start); elapsed < test.minDuration {
+				t.Errorf("got the task finished after %s, want the device to postpone it by %s", elapsed, test.minDuration)
+			}
+			if device := server.Device("ddi0"); device.Closed != test.closed || device.Downloads != 1 {
+				t.Errorf("got closed %t and %d downloads, want closed %t and 1 download", device.Closed, device.Downloads, test.closed)
+			}
+		})
+	}
+}
+
+func TestDDIDownloadSkipped(t *testing.T) {
+	server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1, Download: hawkbit.HANDLING_SKIP})
+	controller, err := startDDIDevice(t, endpoint, "ddi0", fault.UpdateOutcome{})
+	if err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+
+	// the device keeps polling without starting the task
+	templatestest.WaitFor(t, "third poll", taskTimeout, func() bool { return server.Device("ddi0").Polls >= 3 })
+	if started := controller.Started(); started != 0 {
+		t.Errorf("task started %d times, want 0", started)
+	}
+	if device := server.Device("ddi0"); device.Downloads != 0 || len(device.Feedbacks) != 0 {
+		t.Errorf("got %d downloads and %d feedbacks, want none", device.Downloads, len(device.Feedbacks))
+	}
+}
+
+func TestDDIMaintenanceWindow(t *testing.T) {
+	// the window is available during the first second of every 2 seconds: the device starts when it is unavailable
+	server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1, WindowPeriod: 2 * time.Second, WindowLength: time.Second})
+	time.Sleep(1100 * time.Millisecond)
+	controller, err := startDDIDevice(t, endpoint, "ddi0", fault.UpdateOutcome{})
+	if err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+
+	// the update is downloaded at once, then installed at the first poll once the window is available
+	templatestest.WaitFor(t, "download", taskTimeout, func() bool { return server.Device("ddi0").Downloads == 1 })
+	if device := server.Device("ddi0"); device.Closed {
+		t.Error("got the action closed while the maintenance window is unavailable")
+	}
+	templatestest.WaitTask(t, controller, taskTimeout)
+
+	if success, _ := controller.Result(); !success {
+		t.Error("got a failed task, want a successful task")
+	}
+	wantPhases := []string{"RUNNING", "DOWNLOADING", "DOWNLOADED", "MAINTENANCE_WINDOW", "SUCCESSFUL"}
+	if phases := controller.Phases(); !reflect.DeepEqual(phases, wantPhases) {
+		t.Errorf("got phases %v, want %v", phases, wantPhases)
+	}
+	if device := server.Device("ddi0"); !device.Closed || device.Downloads != 1 || device.Polls < 2 {
+		t.Errorf("got closed %t, %d downloads and %d polls, want a closed action downloaded once over several polls",
+			device.Closed, device.Downloads, device.Polls)
+	}
+}
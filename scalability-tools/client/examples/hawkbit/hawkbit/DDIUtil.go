@@ -1,14 +1,43 @@
 package hawkbit
 
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
 var ConfirmationBase = "confirmationBase"
 var DeploymentBase = "deploymentBase"
+var CancelAction = "cancelAction"
+var ConfigData = "configData"
 
 type Link struct {
 	Href string `json:"href"`
 }
 
 type ControllerBase struct {
-	Links map[string]Link `json:"_links"`
+	Config ControllerConfig `json:"config"`
+	Links  map[string]Link  `json:"_links"`
+}
+
+type ControllerConfig struct {
+	Polling PollingConfig `json:"polling"`
+}
+
+type PollingConfig struct {
+	Sleep string `json:"sleep"` // HH:MM:SS
+}
+
+// parsePollingSleep parses the polling interval dictated by the server
+func parsePollingSleep(sleep string) (duration time.Duration, err error) {
+	var hours, minutes, seconds int
+	_, err = fmt.Sscanf(sleep, "%d:%d:%d", &hours, &minutes, &seconds)
+	if err != nil {
+		return 0, xerrors.Errorf("Invalid polling sleep %s (Expected: HH:MM:SS)", sleep)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second, nil
 }
 
 type ActionWithDeployment struct {
@@ -16,12 +45,40 @@ type ActionWithDeployment struct {
 	Deployment Deployment `json:"deployment"`
 }
 
+// ConfirmationBaseAction is an action waiting for the consent of the user before being deployed
+type ConfirmationBaseAction struct {
+	ID           string     `json:"id"`
+	Confirmation Deployment `json:"confirmation"`
+}
+
+// ActionWithCancel is a cancel action, stopping the action of the stop id
+type ActionWithCancel struct {
+	ID           string     `json:"id"`
+	CancelAction CancelStop `json:"cancelAction"`
+}
+
+type CancelStop struct {
+	StopID string `json:"stopId"`
+}
+
+// Deployment describes an action. Download and Update are either "skip", "attempt" or "forced". The maintenance window
+// is only given if the action has one, and is either "available" or "unavailable"
 type Deployment struct {
-	Download string  `json:"download"`
-	Update   string  `json:"update"`
-	Chunks   []Chunk `json:"chunks"`
+	Download          string  `json:"download"`
+	Update            string  `json:"update"`
+	MaintenanceWindow string  `json:"maintenanceWindow,omitempty"`
+	Chunks            []Chunk `json:"chunks"`
 }
 
+const (
+	HANDLING_SKIP    = "skip"
+	HANDLING_ATTEMPT = "attempt"
+	HANDLING_FORCED  = "forced"
+
+	WINDOW_AVAILABLE   = "available"
+	WINDOW_UNAVAILABLE = "unavailable"
+)
+
 type Chunk struct {
 	Part      string        `json:"part"`
 	Version   string        `json:"version"`
@@ -51,3 +108,22 @@ type DDIUpdateStatus struct {
 type DDIUpdateResult struct {
 	Finished string `json:"finished"`
 }
+
+type DDIConfigData struct {
+	Mode string            `json:"mode"` // merge, replace or remove
+	Data map[string]string `json:"data"`
+}
+
+type DDIConfirmationFeedback struct {
+	Confirmation string   `json:"confirmation"` // confirmed or denied
+	Code         int32    `json:"code,omitempty"`
+	Details      []string `json:"details,omitempty"`
+}
+
+// statusCode returns the status code of the response, or 0 if no response was received
+func statusCode(res *http.Response) int {
+	if res == nil {
+		return 0
+	}
+	return res.StatusCode
+}
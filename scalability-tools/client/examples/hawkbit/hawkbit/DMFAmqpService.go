@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"hitachienergy/scalability-test-client/examples/httppool"
+	"hitachienergy/scalability-test-client/templates"
 	"io"
 	"net/http"
 	"time"
@@ -15,8 +16,9 @@ import (
 )
 
 type DMFAmqpService struct {
-	tenant string
-	id     string
+	tenant     string
+	id         string
+	controller templates.Controller
 
 	conn         *amqp.Connection
 	ch           *amqp.Channel
@@ -30,9 +32,10 @@ type DMFAmqpService struct {
 }
 
 // newDMFAmqpService creates an instance of DMF AMQP Service
-func newDMFAmqpService(id string, tenant string, baseEndpoint string, virtualHost string, exchangeName string, useHttpPool bool) (service *DMFAmqpService) {
+func newDMFAmqpService(controller templates.Controller, tenant string, baseEndpoint string, virtualHost string, exchangeName string, useHttpPool bool) (service *DMFAmqpService) {
 	service = &DMFAmqpService{
-		id:           id,
+		id:           controller.GetIdentifier(),
+		controller:   controller,
 		tenant:       tenant,
 		baseEndpoint: fmt.Sprintf("amqp://%s%s", baseEndpoint, virtualHost),
 		exchangeName: exchangeName,
@@ -45,7 +48,7 @@ func newDMFAmqpService(id string, tenant string, baseEndpoint string, virtualHos
 // startService starts the update simulation
 func (s *DMFAmqpService) startService(ctx context.Context) (err error) {
 	s.ctx = ctx
-	conn, err := amqp.Dial(s.baseEndpoint)
+	conn, err := s.dial()
 	if err != nil {
 		return err
 	}
@@ -111,6 +114,10 @@ func (u *DMFAmqpService) reportUpdate(actionID int64, localStatus LocalUpdateSta
 		feedback.ActionStatus = UPDATE_DOWNLOADED
 	case RUNNING:
 		feedback.ActionStatus = UPDATE_RUNNING
+	case WARNING:
+		feedback.ActionStatus = UPDATE_WARNING
+	case DENIED:
+		feedback.ActionStatus = UPDATE_DENIED
 	}
 
 	return u.sendUpdateFeedback(feedback)
@@ -255,40 +262,48 @@ func (s *DMFAmqpService) sendMessage(data []byte, properties amqp.Table, correla
 	return err
 }
 
-// download downloads firmware from the server using HTTP (weird but this is Hawkbit simulator written as)
-func (s *DMFAmqpService) download(ctx context.Context, url string, token string) (body []byte, err error) {
+// dial opens the AMQP connection. The connection is shaped by the network profile of the device, if any
+func (s *DMFAmqpService) dial() (*amqp.Connection, error) {
+	shaper := s.controller.GetNetwork()
+	if !shaper.Enabled() {
+		return amqp.Dial(s.baseEndpoint)
+	}
+	return amqp.DialConfig(s.baseEndpoint, amqp.Config{
+		Heartbeat: AMQP_HEARTBEAT,
+		Locale:    AMQP_LOCALE,
+		Dial:      shaper.Dial,
+	})
+}
+
+// download downloads firmware from the server using HTTP (weird but this is Hawkbit simulator written as).
+// The body is streamed to the writer
+func (s *DMFAmqpService) download(ctx context.Context, url string, token string, w io.Writer) (err error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	req = req.WithContext(ctx)
 	req.Header.Add("Authorization", fmt.Sprintf("TargetToken %s", token))
-	res, err := s.sendHTTP(req)
+	res, err := s.sendHTTP("dmf/download", req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode > 299 {
-		return nil, xerrors.Errorf("Fail to get action with deployment. Status code: %d (%s)", res.StatusCode, res.Status)
+		return xerrors.Errorf("Fail to get action with deployment. Status code: %d (%s)", res.StatusCode, res.Status)
 	}
 
-	body, err = io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return body, nil
+	_, err = io.Copy(w, res.Body)
+	return err
 }
 
-// sendHTTP sends a simple http request. It can either send directly or using HTTP Pool
-func (s *DMFAmqpService) sendHTTP(request *http.Request) (*http.Response, error) {
+// sendHTTP sends a simple http request (see httppool.Do) and reports its result to the controller under the given endpoint name
+func (s *DMFAmqpService) sendHTTP(endpoint string, request *http.Request) (res *http.Response, err error) {
 	request.Close = true
+	defer func() {
+		s.controller.ReportRequest(endpoint, statusCode(res), err)
+	}()
 
-	if !s.useHttpPool {
-		return httppool.Client.Do(request)
-	}
-	client := httppool.Pool.Get()
-	defer httppool.Pool.Put(client)
-	return client.Do(request)
+	return httppool.Do(s.controller.GetNetwork(), s.useHttpPool, request)
 }
@@ -58,8 +58,8 @@ type DMFClient struct {
 
 // NewDMFClient creates a new instance of DMF client
 func NewDMFClient(controller templates.Controller, tenant string, baseEndpoint string, virtualHost string,
-	exchangeName string, useHTTPPool bool, pingPeriod uint, attributes map[string]string) *DMFClient {
-	service := newDMFAmqpService(controller.GetIdentifier(), tenant, baseEndpoint,
+	exchangeName string, useHTTPPool bool, discardArtifacts bool, pingPeriod uint, attributes map[string]string) *DMFClient {
+	service := newDMFAmqpService(controller, tenant, baseEndpoint,
 		virtualHost, exchangeName, useHTTPPool)
 	c := &DMFClient{
 		controller:     controller,
@@ -67,7 +67,7 @@ func NewDMFClient(controller templates.Controller, tenant string, baseEndpoint s
 		attributes:     attributes,
 		DMFAmqpService: service,
 	}
-	c.DMFUpdateManager = newDMFUpdateManager(c)
+	c.DMFUpdateManager = newDMFUpdateManager(c, discardArtifacts)
 	return c
 }
 
@@ -1,15 +1,18 @@
-package main
+package hawkbit
 
 import (
-	"hitachienergy/scalability-test-client/examples/hawkbit/hawkbit"
 	"hitachienergy/scalability-test-client/examples/httppool"
+	"hitachienergy/scalability-test-client/registry"
 	"hitachienergy/scalability-test-client/templates"
 
 	"golang.org/x/xerrors"
 )
 
 // ------------------------------------ Client Factory -----------------------------------
-var HawkbitDMFDefaultFactory DMFDefaultClientFactory
+
+func init() {
+	registry.Register("HawkbitDMFDefaultFactory", DMFDefaultClientFactory{})
+}
 
 type DMFDefaultClientFactory struct {
 	templates.DeviceFactory
@@ -41,18 +44,19 @@ func (d DMFDefaultClientFactory) NewDevice(controller templates.Controller) (cli
 		httppool.Pool.Init(httpPoolSize)
 	}
 
-	client = hawkbit.NewDMFClient(controller,
+	client = NewDMFClient(controller,
 		params["tenant"].(string),
 		baseEndpoint,
 		params["virtualHost"].(string),
 		params["replyExchange"].(string),
 		httpPoolSize > 0,
+		params["discardArtifacts"].(bool),
 		params["pingPeriod"].(uint),
 		map[string]string{
 			"targetType": "DMF",
 		},
 	)
-	// c.UpdateManagerDMF = &defaultDMFUM{DMFUpdateManager: hawkbit.NewDMFUpdateManager(c.DMFAmqpService), ctr: controller}
+	// c.UpdateManagerDMF = &defaultDMFUM{DMFUpdateManager: NewDMFUpdateManager(c.DMFAmqpService), ctr: controller}
 
 	return client, nil
 }
@@ -79,6 +83,11 @@ func dmfCheckAndSetInputs(params map[string]interface{}) (err error) {
 	if _, ok := params["httpPoolSize"].(int); !ok {
 		params["httpPoolSize"] = 0 // default: not use HTTPPool (no limit on HTTP Connections)
 	}
+	if _, ok := params["discardArtifacts"]; !ok {
+		params["discardArtifacts"] = false // default: keep the downloaded artifacts in memory
+	} else if _, ok := params["discardArtifacts"].(bool); !ok {
+		return xerrors.Errorf("Invalid input (discardArtifacts). Expected: bool")
+	}
 
 	return nil
 }
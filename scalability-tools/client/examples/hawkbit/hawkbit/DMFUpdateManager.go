@@ -2,10 +2,7 @@ package hawkbit
 
 import (
 	"context"
-	"crypto/sha1"
-	"encoding/hex"
 	"fmt"
-	"strings"
 	"sync"
 
 	"golang.org/x/xerrors"
@@ -17,15 +14,19 @@ type DMFUpdateManager struct {
 	actions map[int64]context.CancelFunc
 	*sync.Mutex
 
+	keepArtifacts bool
+
 	*DMFClient
 }
 
-// newDMFUpdateManager creates a new DMFUpdateManager
-func newDMFUpdateManager(client *DMFClient) *DMFUpdateManager {
+// newDMFUpdateManager creates a new DMFUpdateManager. The downloaded artifacts are only hashed and counted
+// if they are discarded
+func newDMFUpdateManager(client *DMFClient, discardArtifacts bool) *DMFUpdateManager {
 	return &DMFUpdateManager{
-		actions:   map[int64]context.CancelFunc{},
-		Mutex:     &sync.Mutex{},
-		DMFClient: client,
+		actions:       map[int64]context.CancelFunc{},
+		Mutex:         &sync.Mutex{},
+		keepArtifacts: !discardArtifacts,
+		DMFClient:     client,
 	}
 }
 
@@ -59,6 +60,13 @@ func (u *DMFUpdateManager) resetUpdate(actionID int64) (exist bool) {
 
 // func (u *DMFUpdateManager) PrepareUpdate(actionID int64) (deployment *Deployment, err error) { return }
 
+// reportPhase reports the update status to the server and marks the related phase of the task
+func (u *DMFUpdateManager) reportPhase(actionID int64, localStatus LocalUpdateStatus) (err error) {
+	err = u.reportUpdate(actionID, localStatus)
+	u.controller.MarkPhase(localStatus.Status.String())
+	return err
+}
+
 // startUpdate launches the updates
 func (u *DMFUpdateManager) startUpdate(action *DMFAction, requireInstall bool) (err error) {
 	ctx := u.setUpdate(action.ID)
@@ -67,12 +75,24 @@ func (u *DMFUpdateManager) startUpdate(action *DMFAction, requireInstall bool) (
 	}
 
 	defer func() {
+		cancelled := ctx.Err() != nil // before resetUpdate, which releases the context
 		// FIXME: only set actionID for SUCCESS or ERROR
 		u.resetUpdate(action.ID)
+		if cancelled {
+			u.controller.MarkPhase(CANCEL.String())
+			u.controller.CancelTask()
+			return
+		}
 		u.controller.CompleteTask(err == nil)
 	}()
 
-	err = u.reportUpdate(action.ID, LocalUpdateStatus{RUNNING, []string{"Simulation begins!"}})
+	report := func(status LocalUpdateStatus) error { return u.reportPhase(action.ID, status) }
+	err = denyUpdate(u.controller, report)
+	if err != nil {
+		return err
+	}
+
+	err = u.reportPhase(action.ID, LocalUpdateStatus{RUNNING, []string{"Simulation begins!"}})
 	if err != nil {
 		return err
 	}
@@ -83,8 +103,7 @@ func (u *DMFUpdateManager) startUpdate(action *DMFAction, requireInstall bool) (
 	}
 
 	if !cancel && requireInstall {
-		err = u.reportUpdate(action.ID, LocalUpdateStatus{SUCCESSFUL, []string{"Simulation complete!"}})
-		return err
+		return installUpdate(u.controller, report)
 	}
 
 	return nil
@@ -101,7 +120,7 @@ func (u *DMFUpdateManager) simulateDownload(ctx context.Context, action *DMFActi
 		}
 	}
 
-	err = u.reportUpdate(action.ID, LocalUpdateStatus{DOWNLOADING, messages})
+	err = u.reportPhase(action.ID, LocalUpdateStatus{DOWNLOADING, messages})
 	if err != nil {
 		return false, err
 	}
@@ -125,7 +144,7 @@ func (u *DMFUpdateManager) simulateDownload(ctx context.Context, action *DMFActi
 			}
 		}
 	}
-	reportErr := u.reportUpdate(action.ID, LocalUpdateStatus{result.Status, result.StatusMsgs})
+	reportErr := u.reportPhase(action.ID, LocalUpdateStatus{result.Status, result.StatusMsgs})
 
 	u.controller.GetLogger().Debug().Msgf("Finish downloading. Success: %t", result.Status == DOWNLOADED)
 
@@ -150,24 +169,11 @@ func (u *DMFUpdateManager) handleArtifact(ctx context.Context, artifact *DMFArti
 
 // downloadUrl performs downloading from the given url using different protocols
 func (u *DMFUpdateManager) downloadUrl(ctx context.Context, url string, token string, hash string, size int64) (status LocalUpdateStatus) {
-	data, err := u.download(ctx, url, token)
+	download := newArtifactDownload(u.keepArtifacts, size, u.controller.GetDownloadFault())
+	err := u.download(ctx, url, token, download)
 	if err != nil {
 		return LocalUpdateStatus{Status: ERROR, StatusMsgs: []string{fmt.Sprintf("Failed to download %s: %s", url, err)}}
 	}
 
-	contentSize := int64(len(data))
-	if contentSize != size {
-		return LocalUpdateStatus{Status: ERROR,
-			StatusMsgs: []string{fmt.Sprintf("Download %s has wrong content length (Expected: %d, Got %d)", url, size, contentSize)}}
-	}
-
-	myhash := sha1.New()
-	myhash.Write(data)
-	hashString := strings.ToLower(hex.EncodeToString(myhash.Sum(nil)))
-	if hashString != hash {
-		return LocalUpdateStatus{Status: ERROR,
-			StatusMsgs: []string{fmt.Sprintf("Download %s failed with SHA1 hash missmatch (Expected: %s, Got %s)", url, hash, hashString)}}
-	}
-
-	return LocalUpdateStatus{Status: SUCCESSFUL, StatusMsgs: []string{fmt.Sprintf("Download %s successfully (%d bytes)", url, contentSize)}}
+	return verifyArtifact(url, hash, size, download)
 }
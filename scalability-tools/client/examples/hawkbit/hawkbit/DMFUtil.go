@@ -1,6 +1,9 @@
 package hawkbit
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 var DMF_EXCHANGE = "dmf.exchange"
 
@@ -36,6 +39,10 @@ const AMQP_KEY_CONTENT_TYPE = "content-type"
 
 const ContentTypeJSON = "application/json"
 
+// AMQP connection defaults of amqp.Dial, kept when the connection is dialed with a custom configuration
+const AMQP_HEARTBEAT = 10 * time.Second
+const AMQP_LOCALE = "en_US"
+
 const (
 	UPDATE_DOWNLOAD        = "DOWNLOAD"
 	UPDATE_RETRIEVED       = "RETRIEVED"
@@ -1,4 +1,4 @@
-package main
+package hawkbit
 
 import (
 	"gopkg.in/yaml.v3"
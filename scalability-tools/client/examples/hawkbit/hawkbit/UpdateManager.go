@@ -1,5 +1,13 @@
 package hawkbit
 
+import (
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
 type UpdateStage int
 
 const (
@@ -10,13 +18,76 @@ const (
 	DOWNLOADED
 	CONFIRMED
 	CANCEL
+	WARNING
+	DENIED
 )
 
+// String returns the name of the update stage
+func (s UpdateStage) String() string {
+	switch s {
+	case SUCCESSFUL:
+		return "SUCCESSFUL"
+	case ERROR:
+		return "ERROR"
+	case RUNNING:
+		return "RUNNING"
+	case DOWNLOADING:
+		return "DOWNLOADING"
+	case DOWNLOADED:
+		return "DOWNLOADED"
+	case CONFIRMED:
+		return "CONFIRMED"
+	case CANCEL:
+		return "CANCEL"
+	case WARNING:
+		return "WARNING"
+	case DENIED:
+		return "DENIED"
+	}
+	return "UNKNOWN"
+}
+
 type LocalUpdateStatus struct {
 	Status     UpdateStage
 	StatusMsgs []string
 }
 
+// denyUpdate reports that the device denies the update, according to its update outcome. It returns nil if the device accepts the update
+func denyUpdate(controller templates.Controller, report func(status LocalUpdateStatus) error) (err error) {
+	if controller.GetUpdateOutcome().Result != fault.OUTCOME_DENIED {
+		return nil
+	}
+
+	err = report(LocalUpdateStatus{DENIED, []string{"Update denied by the device"}})
+	if err != nil {
+		return err
+	}
+	return xerrors.Errorf("Update denied by the device")
+}
+
+// installUpdate simulates the installation of the downloaded update and the reboot of the device, according to its update outcome
+func installUpdate(controller templates.Controller, report func(status LocalUpdateStatus) error) (err error) {
+	outcome := controller.GetUpdateOutcome()
+
+	time.Sleep(outcome.InstallDuration)
+	switch outcome.Result {
+	case fault.OUTCOME_FAILURE:
+		err = report(LocalUpdateStatus{ERROR, []string{"Simulated installation failure!"}})
+		if err != nil {
+			return err
+		}
+		return xerrors.Errorf("Simulated installation failure")
+	case fault.OUTCOME_WARNING:
+		err = report(LocalUpdateStatus{WARNING, []string{"Simulated installation warning!"}})
+		if err != nil {
+			return err
+		}
+	}
+
+	time.Sleep(outcome.RebootDuration)
+	return report(LocalUpdateStatus{SUCCESSFUL, []string{"Simulation complete!"}})
+}
+
 type UpdateManagerDDI interface {
 	PrepareUpdate(actionID int64) (deployment *Deployment, err error)
 	StartUpdate(actionID int64, deployment *Deployment) (err error)
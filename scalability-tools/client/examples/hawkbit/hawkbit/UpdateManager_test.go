@@ -0,0 +1,52 @@
+package hawkbit_test
+
+import (
+	"testing"
+
+	"hitachienergy/scalability-test-client/examples/hawkbit/ddimock"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates/templatestest"
+)
+
+func TestDDIDeploymentOutcome(t *testing.T) {
+	tests := []struct {
+		name       string
+		outcome    fault.UpdateResult
+		success    bool
+		lastPhase  string
+		finished   string // result of the last feedback
+		downloaded bool
+	}{
+		{"warning", fault.OUTCOME_WARNING, true, "SUCCESSFUL", "success", true},
+		{"failure", fault.OUTCOME_FAILURE, false, "ERROR", "failure", true},
+		{"denied", fault.OUTCOME_DENIED, false, "DENIED", "none", false}, // rejected execution
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, endpoint := startDDIServer(t, ddimock.DDIServerConfig{Seed: 1})
+			controller, err := startDDIDevice(t, endpoint, "ddi0", fault.UpdateOutcome{Result: test.outcome})
+			if err != nil {
+				t.Fatalf("Start: %s", err)
+			}
+			templatestest.WaitTask(t, controller, taskTimeout)
+
+			if success, _ := controller.Result(); success != test.success {
+				t.Errorf("got success %t, want %t", success, test.success)
+			}
+			phases := controller.Phases()
+			if len(phases) == 0 || phases[len(phases)-1] != test.lastPhase {
+				t.Errorf("got phases %v, want %s last", phases, test.lastPhase)
+			}
+
+			device := server.Device("ddi0")
+			if got := device.Downloads > 0; got != test.downloaded {
+				t.Errorf("got %d downloads, want downloaded %t", device.Downloads, test.downloaded)
+			}
+			last := device.Feedbacks[len(device.Feedbacks)-1]
+			if last.Status.Result.Finished != test.finished {
+				t.Errorf("got last feedback %+v, want finished %s", last.Status, test.finished)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package httppool
 import (
 	"crypto/tls"
 	"fmt"
+	"hitachienergy/scalability-test-client/network"
 	"net/http"
 	"sync"
 )
@@ -53,3 +54,17 @@ func (p *HTTPClientPool) Get() *http.Client {
 func (p *HTTPClientPool) Put(client *http.Client) {
 	p.pool <- client
 }
+
+// Do sends a request through the shaped link of the device if its network is shaped, since the link is shaped on the
+// connections of the device. Otherwise it uses either the shared client or a client of the pool
+func Do(shaper *network.Shaper, usePool bool, request *http.Request) (*http.Response, error) {
+	if shaper.Enabled() {
+		return shaper.HTTPClient().Do(request)
+	}
+	if !usePool {
+		return Client.Do(request)
+	}
+	client := Pool.Get()
+	defer Pool.Put(client)
+	return client.Do(request)
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"hitachienergy/scalability-test-client/examples/thingsboard/thingsboard"
+)
+
+// The ThingsBoard factories are statically linked in the simulator and resolved through the factory registry.
+// This package only exposes them for the plugin fallback (".client.template"), e.g. for simulators built without them
+
+var TBHTTPDefaultFactory thingsboard.HTTPDefaultClientFactory
+var TBMQTTDefaultFactory thingsboard.MQTTDefaultClientFactory
+var TBCoAPDefaultFactory thingsboard.CoAPDefaultClientFactory
@@ -0,0 +1,107 @@
+package tbmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"hitachienergy/scalability-test-client/examples/thingsboard/thingsboard"
+	"strings"
+	"time"
+
+	coap "github.com/plgd-dev/go-coap/v3"
+	"github.com/plgd-dev/go-coap/v3/message"
+	"github.com/plgd-dev/go-coap/v3/message/codes"
+	"github.com/plgd-dev/go-coap/v3/mux"
+)
+
+// ListenAndServeCoAP starts the CoAP device API of the mock server on the given UDP address. It blocks until the server stops.
+// Large responses (e.g. the firmware) are transferred block by block (Block2)
+func (s *TBServer) ListenAndServeCoAP(addr string) error {
+	return coap.ListenAndServe("udp", addr, s)
+}
+
+// ServeCOAP implements mux.Handler. Paths follow the device CoAP API: /api/v1/{token}/...
+// An observation of the attributes is answered with the current attributes only, as they never change
+func (s *TBServer) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	if s.config.Latency > 0 {
+		time.Sleep(s.config.Latency)
+	}
+
+	path, err := r.Options().Path()
+	if err != nil {
+		w.SetResponse(codes.BadRequest, message.TextPlain, nil)
+		return
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "api" || parts[1] != "v1" {
+		w.SetResponse(codes.NotFound, message.TextPlain, nil)
+		return
+	}
+	token, resource := parts[2], parts[3]
+	if s.injectError(token, resource) {
+		w.SetResponse(codes.ServiceUnavailable, message.TextPlain, nil)
+		return
+	}
+
+	switch {
+	case resource == "attributes" && r.Code() == codes.GET:
+		s.handleCoAPAttributes(w, r, token)
+	case resource == "firmware" && r.Code() == codes.GET:
+		s.handleCoAPFirmware(w, r, token)
+	case resource == "telemetry" && r.Code() == codes.POST:
+		s.handleCoAPTelemetry(w, r, token)
+	default:
+		w.SetResponse(codes.NotFound, message.TextPlain, nil)
+	}
+}
+
+// handleCoAPAttributes returns the shared firmware attributes. Notifications carry the attributes without the "shared" wrapper
+func (s *TBServer) handleCoAPAttributes(w mux.ResponseWriter, r *mux.Message, token string) {
+	s.recordAttributesRequest(token)
+
+	var data interface{} = thingsboard.HTTPAttributes{Client: map[string]interface{}{}, Shared: s.info}
+	observe, err := r.Options().Observe()
+	isObservation := err == nil && observe == 0
+	if isObservation {
+		data = s.info
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		w.SetResponse(codes.InternalServerError, message.TextPlain, nil)
+		return
+	}
+
+	w.SetResponse(codes.Content, message.AppJSON, bytes.NewReader(payload))
+	if isObservation {
+		w.Message().SetObserve(1)
+	}
+}
+
+// handleCoAPFirmware serves the whole firmware
+func (s *TBServer) handleCoAPFirmware(w mux.ResponseWriter, r *mux.Message, token string) {
+	queries, _ := r.Options().Queries()
+	query := map[string]string{}
+	for _, q := range queries {
+		key, value, _ := strings.Cut(q, "=")
+		query[key] = value
+	}
+	if query["title"] != s.info.Title || query["version"] != s.info.Version {
+		w.SetResponse(codes.NotFound, message.TextPlain, nil)
+		return
+	}
+
+	s.recordFirmwareRequest(token, len(s.firmware))
+	w.SetResponse(codes.Content, message.AppOctets, bytes.NewReader(s.firmware))
+}
+
+// handleCoAPTelemetry records the firmware state transitions reported by the device
+func (s *TBServer) handleCoAPTelemetry(w mux.ResponseWriter, r *mux.Message, token string) {
+	body, err := r.ReadBody()
+	if err == nil {
+		err = s.recordTelemetry(token, body)
+	}
+	if err != nil {
+		w.SetResponse(codes.BadRequest, message.TextPlain, nil)
+		return
+	}
+	w.SetResponse(codes.Changed, message.TextPlain, nil)
+}
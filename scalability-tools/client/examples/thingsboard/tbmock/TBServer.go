@@ -0,0 +1,326 @@
+package tbmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"hitachienergy/scalability-test-client/examples/thingsboard/thingsboard"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// EXPECTED_STATES is the sequence of firmware states a device reports during a successful update
+var EXPECTED_STATES = []thingsboard.UpdateState{
+	thingsboard.UPDATE_DOWNLOADING,
+	thingsboard.UPDATE_DOWNLOADED,
+	thingsboard.UPDATE_VERIFIED,
+	thingsboard.UPDATE_UPDATING,
+	thingsboard.UPDATE_UPDATED,
+}
+
+// TBServerConfig represents the behavior of the mock ThingsBoard server
+type TBServerConfig struct {
+	Title        string                  // firmware title shared with the devices
+	Version      string                  // firmware version shared with the devices
+	FirmwareSize int64                   // size in bytes of the firmware
+	ChecksumAlg  thingsboard.ChecksumAlg // checksum algorithm shared with the devices
+	Latency      time.Duration           // delay added to every response
+	ErrorRate    float64                 // probability (0-1) of answering a request with ErrorCode, drawn per device and resource
+	ErrorCode    int                     // status code of the injected errors
+	Seed         int64                   // seed of the firmware generation and errors injection
+}
+
+// DeviceState is the state of a device as seen by the mock server
+type DeviceState struct {
+	AttributeRequests int
+	FirmwareRequests  int
+	DownloadedBytes   int64
+	States            []thingsboard.UpdateState
+}
+
+// TBServer is an in-process fake of the ThingsBoard device HTTP and CoAP APIs. Every device is assigned the same firmware.
+// It implements http.Handler and mux.Handler (CoAP)
+type TBServer struct {
+	config TBServerConfig
+
+	firmware []byte
+	info     thingsboard.FirmwareInfo
+
+	*sync.Mutex
+	devices  map[string]*DeviceState
+	requests map[string]int // number of requests per device and resource, including the failed ones
+}
+
+// NewTBServer creates a new mock ThingsBoard server. The firmware content is generated once and shared by all devices
+func NewTBServer(config TBServerConfig) (*TBServer, error) {
+	if len(config.Title) == 0 {
+		config.Title = "simulated-firmware"
+	}
+	if len(config.Version) == 0 {
+		config.Version = "1.0.0"
+	}
+	if len(config.ChecksumAlg) == 0 {
+		config.ChecksumAlg = thingsboard.SHA256
+	}
+	if config.ErrorCode == 0 {
+		config.ErrorCode = http.StatusServiceUnavailable
+	}
+	if config.Seed == 0 {
+		config.Seed = time.Now().Unix()
+	}
+
+	random := rand.New(rand.NewSource(config.Seed))
+	firmware := make([]byte, config.FirmwareSize)
+	random.Read(firmware)
+
+	checksum, err := thingsboard.Checksum(config.ChecksumAlg, firmware)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TBServer{
+		config:   config,
+		firmware: firmware,
+		info: thingsboard.FirmwareInfo{
+			Checksum:    checksum,
+			ChecksumAlg: config.ChecksumAlg,
+			Size:        float64(len(firmware)),
+			Title:       config.Title,
+			Version:     config.Version,
+		},
+		Mutex:    &sync.Mutex{},
+		devices:  map[string]*DeviceState{},
+		requests: map[string]int{},
+	}, nil
+}
+
+// ListenAndServe starts the mock server on the given address. It blocks until the server stops
+func (s *TBServer) ListenAndServe(addr string) error {
+	server := &http.Server{Addr: addr, Handler: s}
+	return server.ListenAndServe()
+}
+
+// Device returns a copy of the state of a device, or nil if the device never contacted the server
+func (s *TBServer) Device(token string) *DeviceState {
+	s.Lock()
+	defer s.Unlock()
+
+	device, ok := s.devices[token]
+	if !ok {
+		return nil
+	}
+	state := *device
+	state.States = append([]thingsboard.UpdateState{}, device.States...)
+	return &state
+}
+
+// Verify checks that the device reported the expected firmware states (DOWNLOADING -> UPDATED) in order
+func (s *TBServer) Verify(token string) error {
+	device := s.Device(token)
+	if device == nil {
+		return xerrors.Errorf("Device %s never contacted the server", token)
+	}
+	if len(device.States) != len(EXPECTED_STATES) {
+		return xerrors.Errorf("Device %s reported %v (Expected: %v)", token, device.States, EXPECTED_STATES)
+	}
+	for i, state := range EXPECTED_STATES {
+		if device.States[i] != state {
+			return xerrors.Errorf("Device %s reported %v (Expected: %v)", token, device.States, EXPECTED_STATES)
+		}
+	}
+	return nil
+}
+
+// VerifyAll verifies all the devices that contacted the server and returns the failures per device
+func (s *TBServer) VerifyAll() map[string]error {
+	s.Lock()
+	tokens := make([]string, 0, len(s.devices))
+	for token := range s.devices {
+		tokens = append(tokens, token)
+	}
+	s.Unlock()
+
+	failures := map[string]error{}
+	for _, token := range tokens {
+		if err := s.Verify(token); err != nil {
+			failures[token] = err
+		}
+	}
+	return failures
+}
+
+// ServeHTTP implements http.Handler. Paths follow the device HTTP API: /api/v1/{token}/...
+func (s *TBServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.config.Latency > 0 {
+		time.Sleep(s.config.Latency)
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "api" || parts[1] != "v1" {
+		http.NotFound(w, r)
+		return
+	}
+	token, resource := parts[2], parts[3]
+	if s.injectError(token, resource) {
+		w.WriteHeader(s.config.ErrorCode)
+		return
+	}
+
+	switch {
+	case resource == "attributes" && r.Method == http.MethodGet:
+		s.handleAttributes(w, token)
+	case resource == "firmware" && r.Method == http.MethodGet:
+		s.handleFirmware(w, r, token)
+	case resource == "telemetry" && r.Method == http.MethodPost:
+		s.handleTelemetry(w, r, token)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// injectError randomly decides if the current request of the device to the resource should fail. The draw only depends
+// on the seed and on the previous requests of the device to the resource, not on the interleaving of the devices
+func (s *TBServer) injectError(token string, resource string) bool {
+	if s.config.ErrorRate <= 0 {
+		return false
+	}
+	s.Lock()
+	key := token + "/" + resource
+	count := s.requests[key]
+	s.requests[key] = count + 1
+	s.Unlock()
+
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d/%s/%d", s.config.Seed, key, count)
+	return rand.New(rand.NewSource(int64(hash.Sum64()))).Float64() < s.config.ErrorRate
+}
+
+// device returns the state of a device, creating it on first contact. The caller must hold the lock
+func (s *TBServer) device(token string) *DeviceState {
+	device, ok := s.devices[token]
+	if !ok {
+		device = &DeviceState{}
+		s.devices[token] = device
+	}
+	return device
+}
+
+// handleAttributes returns the shared firmware attributes
+func (s *TBServer) handleAttributes(w http.ResponseWriter, token string) {
+	s.recordAttributesRequest(token)
+
+	writeJSON(w, thingsboard.HTTPAttributes{
+		Client: map[string]interface{}{},
+		Shared: s.info,
+	})
+}
+
+// handleFirmware serves the firmware, either whole or the chunk selected by the chunk and size parameters
+func (s *TBServer) handleFirmware(w http.ResponseWriter, r *http.Request, token string) {
+	query := r.URL.Query()
+	if query.Get("title") != s.info.Title || query.Get("version") != s.info.Version {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := s.firmware
+	if len(query.Get("size")) > 0 {
+		size, err := strconv.Atoi(query.Get("size"))
+		if err != nil || size <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		chunk, err := strconv.Atoi(query.Get("chunk"))
+		if err != nil || chunk < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data = s.firmwareChunk(chunk, size)
+	}
+	s.recordFirmwareRequest(token, len(data))
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// handleTelemetry records the firmware state transitions reported by the device
+func (s *TBServer) handleTelemetry(w http.ResponseWriter, r *http.Request, token string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err = s.recordTelemetry(token, body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+}
+
+// firmwareChunk returns the given chunk of the firmware, empty if the chunk is after the end of the firmware
+func (s *TBServer) firmwareChunk(chunk int, size int) []byte {
+	start := int64(chunk) * int64(size)
+	end := start + int64(size)
+	if start > int64(len(s.firmware)) {
+		start = int64(len(s.firmware))
+	}
+	if end > int64(len(s.firmware)) {
+		end = int64(len(s.firmware))
+	}
+	return s.firmware[start:end]
+}
+
+// recordAttributesRequest records that the device requested its attributes
+func (s *TBServer) recordAttributesRequest(token string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.device(token).AttributeRequests += 1
+}
+
+// recordFirmwareRequest records that the device downloaded (a chunk of) the firmware
+func (s *TBServer) recordFirmwareRequest(token string, size int) {
+	s.Lock()
+	defer s.Unlock()
+
+	device := s.device(token)
+	device.FirmwareRequests += 1
+	device.DownloadedBytes += int64(size)
+}
+
+// recordTelemetry records the firmware state reported in the telemetry of the device, if any
+func (s *TBServer) recordTelemetry(token string, body []byte) error {
+	var state thingsboard.FWUpdateState
+	err := json.Unmarshal(body, &state)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	device := s.device(token)
+	if len(state.State) > 0 {
+		device.States = append(device.States, state.State)
+	}
+	return nil
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
@@ -0,0 +1,81 @@
+package thingsboard
+
+import (
+	"context"
+	"hitachienergy/scalability-test-client/templates"
+	"time"
+)
+
+// CoAPClient is a ThingsBoard device using the CoAP device API, as constrained devices do.
+// Firmware updates are notified through the observation of the device attributes
+type CoAPClient struct {
+	*CoAPService
+	controller templates.Controller
+	UpdateModule
+}
+
+// NewCoAPClient creates an instance of CoAP Client
+func NewCoAPClient(controller templates.Controller, endpoint string, blockSize int, timeout int, discardFirmware bool) *CoAPClient {
+	service := newCoAPService(controller, endpoint, controller.GetIdentifier(), blockSize, time.Duration(timeout)*time.Second)
+	c := &CoAPClient{
+		controller:  controller,
+		CoAPService: service,
+	}
+	c.UpdateModule = newUpdateManager(controller, service, discardFirmware)
+	return c
+}
+
+// Start implements Device.Start
+func (c *CoAPClient) Start(ctx context.Context) (err error) {
+	err = c.dial()
+	if err != nil {
+		c.controller.Connect(false)
+		return err
+	}
+	err = c.ReportCurrState()
+	c.controller.Connect(err == nil)
+	if err != nil {
+		c.close()
+		return err
+	}
+
+	go func() {
+		err := c.observeAttributes(c.handleFirmwareInfo)
+		if err != nil {
+			c.controller.GetLogger().Err(err).Send()
+		}
+
+		// the observation only notifies the changes, the firmware may have been assigned before
+		fwInfo, err := c.getFirmwareInfo()
+		if err != nil {
+			c.controller.GetLogger().Err(err).Send()
+		} else {
+			c.handleFirmwareInfo(*fwInfo)
+		}
+
+		<-ctx.Done()
+		c.close()
+	}()
+
+	return nil
+}
+
+// Stop implements device.Stop
+func (c *CoAPClient) Stop() error {
+	return nil
+}
+
+// handleFirmwareInfo starts the update if the server assigned a new firmware
+func (c *CoAPClient) handleFirmwareInfo(fwInfo FirmwareInfo) {
+	if !c.CheckFw(fwInfo) {
+		return
+	}
+
+	c.controller.StartTask()
+	c.controller.GetScheduler().Submit(func() {
+		err := c.StartUpdate(fwInfo)
+		if err != nil {
+			c.controller.GetLogger().Err(err).Send()
+		}
+	})
+}
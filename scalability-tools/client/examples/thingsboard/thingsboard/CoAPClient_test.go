@@ -0,0 +1,165 @@
+package thingsboard_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"hitachienergy/scalability-test-client/examples/thingsboard/tbmock"
+	"hitachienergy/scalability-test-client/examples/thingsboard/thingsboard"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates/templatestest"
+
+	coapnet "github.com/plgd-dev/go-coap/v3/net"
+	"github.com/plgd-dev/go-coap/v3/options"
+	"github.com/plgd-dev/go-coap/v3/udp"
+)
+
+// coapTimeout is the timeout of the CoAP requests of the devices, in seconds
+const coapTimeout = 5
+
+// startCoAPServer starts the CoAP device API of the mock ThingsBoard server on a local UDP port
+func startCoAPServer(t *testing.T, config tbmock.TBServerConfig) (*tbmock.TBServer, string) {
+	config.FirmwareSize = firmwareSize
+	server, err := tbmock.NewTBServer(config)
+	if err != nil {
+		t.Fatalf("NewTBServer: %s", err)
+	}
+	listener, err := coapnet.NewListenUDP("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewListenUDP: %s", err)
+	}
+	coapServer := udp.NewServer(options.WithMux(server))
+	go coapServer.Serve(listener)
+	t.Cleanup(func() {
+		coapServer.Stop()
+		listener.Close()
+	})
+	return server, listener.LocalAddr().String()
+}
+
+// startCoAPDevice creates a ThingsBoard CoAP device with a fake controller and starts observing its attributes
+func startCoAPDevice(t *testing.T, endpoint string, token string, blockSize int, outcome fault.UpdateOutcome) (*templatestest.Controller, error) {
+	controller := templatestest.NewController(token, 0, outcome)
+	client := thingsboard.NewCoAPClient(controller, endpoint, blockSize, coapTimeout, true)
+	return controller, templatestest.StartDevice(t, controller, client.Start)
+}
+
+func TestCoAPUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		blockSize int
+	}{
+		{"1024 bytes blocks", 1024},
+		{"256 bytes blocks", 256},
+		{"unsupported block size", 1000}, // 1024 bytes blocks
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, endpoint := startCoAPServer(t, tbmock.TBServerConfig{Seed: 1})
+
+			controllers := map[string]*templatestest.Controller{}
+			for i := 0; i < 3; i++ {
+				token := fmt.Sprintf("coap%d", i)
+				controller, err := startCoAPDevice(t, endpoint, token, test.blockSize, fault.UpdateOutcome{})
+				if err != nil {
+					t.Fatalf("%s: Start: %s", token, err)
+				}
+				controllers[token] = controller
+			}
+
+			for token, controller := range controllers {
+				templatestest.WaitTask(t, controller, taskTimeout)
+
+				if success, _ := controller.Result(); !success {
+					t.Errorf("%s: task failed. Phases: %v", token, controller.Phases())
+				}
+				if phases := controller.Phases(); !reflect.DeepEqual(phases, updatePhases) {
+					t.Errorf("%s: got phases %v, want %v", token, phases, updatePhases)
+				}
+				// the observation and the attributes request both give the firmware, the update starts once
+				if started := controller.Started(); started != 1 {
+					t.Errorf("%s: task started %d times, want 1", token, started)
+				}
+				if device := server.Device(token); device.FirmwareRequests == 0 {
+					t.Errorf("%s: firmware never requested", token)
+				}
+			}
+
+			if failures := server.VerifyAll(); len(failures) > 0 {
+				t.Errorf("VerifyAll: %v", failures)
+			}
+		})
+	}
+}
+
+func TestCoAPInjectedErrors(t *testing.T) {
+	// the errors are drawn per device and resource, so the outcome of every device is fixed by the seed
+	const (
+		REJECTED = "rejected" // the report of the current state failed, the device is not connected
+		NO_TASK  = "no task"  // the observation and the attributes request both failed, the firmware is never received
+		UPDATED  = "updated"  // the update succeeded
+		FAILED   = "failed"   // the firmware transfer failed, there is no retry
+	)
+	want := map[string]string{
+		"coap0": REJECTED, "coap1": FAILED, "coap2": UPDATED, "coap3": UPDATED, "coap4": REJECTED,
+		"coap5": UPDATED, "coap6": FAILED, "coap7": NO_TASK, "coap8": UPDATED, "coap9": UPDATED,
+	}
+	_, endpoint := startCoAPServer(t, tbmock.TBServerConfig{Seed: 22, ErrorRate: 0.2})
+
+	controllers := map[string]*templatestest.Controller{}
+	got := map[string]string{}
+	for i := 0; i < 10; i++ {
+		token := fmt.Sprintf("coap%d", i)
+		controller, err := startCoAPDevice(t, endpoint, token, 1024, fault.UpdateOutcome{})
+		controllers[token] = controller
+		if err != nil {
+			got[token] = REJECTED
+			if connects := controller.Connects(); !reflect.DeepEqual(connects, []bool{false}) {
+				t.Errorf("%s: got connects %v after %s, want [false]", token, connects, err)
+			}
+		}
+	}
+
+	for token, controller := range controllers {
+		if _, ok := got[token]; ok {
+			continue
+		}
+		// the attributes are requested once the observation is registered
+		templatestest.WaitFor(t, token+" attributes request", taskTimeout, func() bool {
+			return len(controller.Requests("tb/coap/attributes")) > 0
+		})
+		if want[token] == NO_TASK {
+			continue
+		}
+		templatestest.WaitTask(t, controller, taskTimeout)
+
+		success, _ := controller.Result()
+		phases := controller.Phases()
+		switch {
+		case success && !reflect.DeepEqual(phases, updatePhases):
+			t.Errorf("%s: got phases %v, want %v", token, phases, updatePhases)
+		case !success && (len(phases) == 0 || phases[len(phases)-1] != "FAILED"):
+			t.Errorf("%s: got phases %v, want FAILED last", token, phases)
+		}
+		got[token] = map[bool]string{true: UPDATED, false: FAILED}[success]
+	}
+	// every other device is done, the devices without firmware had the time to start their task
+	for token, controller := range controllers {
+		if want[token] == NO_TASK {
+			got[token] = NO_TASK
+			if started := controller.Started(); started != 0 {
+				t.Errorf("%s: task started %d times, want never started", token, started)
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got outcomes %v, want %v", got, want)
+	}
+	endpoints := []string{"tb/coap/attributes", "tb/coap/firmware", "tb/coap/telemetry"}
+	if templatestest.CountStatus(controllers, endpoints, 503) == 0 {
+		t.Error("no injected error reported by the devices")
+	}
+}
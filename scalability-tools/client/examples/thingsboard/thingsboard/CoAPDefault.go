@@ -0,0 +1,63 @@
+package thingsboard
+
+import (
+	"hitachienergy/scalability-test-client/registry"
+	"hitachienergy/scalability-test-client/templates"
+
+	"golang.org/x/xerrors"
+)
+
+// ------------------------------------ Client Factory -----------------------------------
+
+func init() {
+	registry.Register("TBCoAPDefaultFactory", CoAPDefaultClientFactory{})
+}
+
+type CoAPDefaultClientFactory struct {
+	templates.DeviceFactory
+	Config ThingsBoardConfig
+}
+
+func (d CoAPDefaultClientFactory) ParseConfig(data []byte) (templates.DeviceFactory, error) {
+	configs, err := ParseConfig(data)
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid config structure for devices simulation")
+	}
+	d.Config = *configs
+
+	err = coapCheckAndSetInputs(d.Config.Client.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d CoAPDefaultClientFactory) NewDevice(controller templates.Controller) (client templates.Device, err error) {
+	params := d.Config.Client.Args
+	address := d.Config.Server.DevicesEndpoint
+
+	c := NewCoAPClient(controller, address, params["blockSize"].(int), params["requestTimeout"].(int), params["discardFirmware"].(bool))
+
+	return c, nil
+}
+
+func coapCheckAndSetInputs(params map[string]interface{}) (err error) {
+	if _, ok := params["blockSize"]; !ok {
+		params["blockSize"] = 1024 // default Block2 size: 1KB (the biggest CoAP block)
+	} else if blockSize, ok := params["blockSize"].(int); !ok || blockSize < 16 || blockSize > 1024 || blockSize&(blockSize-1) != 0 {
+		return xerrors.Errorf("Invalid input (blockSize). Expected: power of two between 16 and 1024")
+	}
+	if _, ok := params["requestTimeout"]; !ok {
+		params["requestTimeout"] = 60 // default request timeout: 60s
+	} else if _, ok := params["requestTimeout"].(int); !ok {
+		return xerrors.Errorf("Invalid input (requestTimeout). Expected: int")
+	}
+	if _, ok := params["discardFirmware"]; !ok {
+		params["discardFirmware"] = false // default: keep the downloaded firmware in memory
+	} else if _, ok := params["discardFirmware"].(bool); !ok {
+		return xerrors.Errorf("Invalid input (discardFirmware). Expected: bool")
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package thingsboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hitachienergy/scalability-test-client/network"
+	"hitachienergy/scalability-test-client/templates"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v3/message"
+	"github.com/plgd-dev/go-coap/v3/message/codes"
+	"github.com/plgd-dev/go-coap/v3/message/pool"
+	"github.com/plgd-dev/go-coap/v3/net/blockwise"
+	netclient "github.com/plgd-dev/go-coap/v3/net/client"
+	"github.com/plgd-dev/go-coap/v3/options"
+	"github.com/plgd-dev/go-coap/v3/udp"
+	"github.com/plgd-dev/go-coap/v3/udp/client"
+	"golang.org/x/xerrors"
+)
+
+type CoAPService struct {
+	controller   templates.Controller
+	baseEndpoint string
+	accessToken  string
+	blockSZX     blockwise.SZX
+	timeout      time.Duration
+
+	conn        *client.Conn
+	observation netclient.Observation
+}
+
+// newCoAPService creates a new CoAPService. blockSize is the size of the Block2 blocks of the firmware transfer
+func newCoAPService(controller templates.Controller, baseEndpoint string, accessToken string, blockSize int, timeout time.Duration) *CoAPService {
+	szx := blockwise.SZX1024
+	for candidate := blockwise.SZX16; candidate <= blockwise.SZX1024; candidate++ {
+		if candidate.Size() == int64(blockSize) {
+			szx = candidate
+		}
+	}
+	return &CoAPService{
+		controller:   controller,
+		baseEndpoint: baseEndpoint,
+		accessToken:  accessToken,
+		blockSZX:     szx,
+		timeout:      timeout,
+	}
+}
+
+// GetID implements CommunicationService.GetID. It returns the access token of the device
+func (s *CoAPService) GetID() string {
+	return s.accessToken
+}
+
+// dial opens the UDP socket of the device. CoAP is connectionless, no message is sent to the server
+func (s *CoAPService) dial() (err error) {
+	s.conn, err = udp.Dial(s.baseEndpoint,
+		options.WithBlockwise(true, s.blockSZX, s.timeout),
+		options.WithErrors(func(err error) {
+			s.controller.GetLogger().Debug().Msgf("CoAP error: %s", err)
+		}))
+	return err
+}
+
+// close cancels the attributes observation and closes the socket of the device
+func (s *CoAPService) close() {
+	if s.conn == nil {
+		return
+	}
+	if s.observation != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		s.observation.Cancel(ctx)
+		cancel()
+	}
+	s.conn.Close()
+}
+
+// observeAttributes registers the device as an observer of its attributes.
+// The firmware info of every notification is given to the handler
+func (s *CoAPService) observeAttributes(onFirmwareInfo FirmwareInfoHandler) (err error) {
+	defer func() {
+		s.controller.ReportRequest("tb/coap/observe", 0, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	observation, err := s.conn.Observe(ctx, s.path("attributes"), func(notification *pool.Message) {
+		if notification.Code() != codes.Content || !s.controller.GetNetwork().Connected() {
+			return // the notifications do not reach a disconnected device
+		}
+		body, err := notification.ReadBody()
+		if err != nil {
+			s.controller.GetLogger().Err(err).Send()
+			return
+		}
+		fw, err := parseFirmwareInfo(body)
+		if err != nil {
+			s.controller.GetLogger().Err(err).Send()
+			return
+		}
+		onFirmwareInfo(*fw)
+	})
+	if err != nil {
+		return err // the failed observation is a nil pointer, it must not be cancelled
+	}
+	s.observation = observation
+	return nil
+}
+
+// getFirmwareInfo returns the firmware info pulled from the server
+func (s *CoAPService) getFirmwareInfo() (info *FirmwareInfo, err error) {
+	body, err := s.get("tb/coap/attributes", s.path("attributes"), "sharedKeys="+FIRMWARE_SHARED_KEYS)
+	if err != nil {
+		return nil, err
+	}
+	return parseFirmwareInfo(body)
+}
+
+// GetFirmware implements CommunicationService.GetFirmware. The firmware is transferred block by block (Block2).
+// The blocks are reassembled by the CoAP stack, so the download always starts over
+func (s *CoAPService) GetFirmware(fwinfo FirmwareInfo, download *firmwareDownload) (err error) {
+	data, err := s.get("tb/coap/firmware", s.path("firmware"), "title="+fwinfo.Title, "version="+fwinfo.Version)
+	if err != nil {
+		return err
+	}
+	download.reset()
+	download.Write(data)
+	return nil
+}
+
+// ReportUpdateState implements CommunicationService.ReportUpdateState. It posts the update state as telemetry
+func (s *CoAPService) ReportUpdateState(state FWUpdateState) (err error) {
+	var res *pool.Message
+	defer func() {
+		s.controller.ReportRequest("tb/coap/telemetry", coapStatusCode(res), err)
+	}()
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if !s.controller.GetNetwork().Connected() {
+		return network.ErrDisconnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	res, err = s.conn.Post(ctx, s.path("telemetry"), message.AppJSON, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if res.Code() != codes.Created && res.Code() != codes.Changed && res.Code() != codes.Content {
+		return xerrors.Errorf("Fail to post update feedback. Response code: %s", res.Code())
+	}
+	return nil
+}
+
+// get sends a GET request and returns the whole body of the response.
+// The result of the request is reported to the controller under the given endpoint name
+func (s *CoAPService) get(endpoint string, path string, queries ...string) (body []byte, err error) {
+	var res *pool.Message
+	defer func() {
+		s.controller.ReportRequest(endpoint, coapStatusCode(res), err)
+	}()
+
+	if !s.controller.GetNetwork().Connected() {
+		return nil, network.ErrDisconnected
+	}
+
+	opts := make(message.Options, 0, len(queries))
+	for _, query := range queries {
+		opts = append(opts, message.Option{ID: message.URIQuery, Value: []byte(query)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	res, err = s.conn.Get(ctx, path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if res.Code() != codes.Content {
+		return nil, xerrors.Errorf("Fail to get %s. Response code: %s", path, res.Code())
+	}
+	return res.ReadBody()
+}
+
+// path returns the path of a resource of the device
+func (s *CoAPService) path(resource string) string {
+	return fmt.Sprintf("/api/v1/%s/%s", s.accessToken, resource)
+}
+
+// parseFirmwareInfo reads the firmware info from either an attributes response ({"shared": {...}})
+// or an attributes update notification (flat shared attributes)
+func parseFirmwareInfo(body []byte) (*FirmwareInfo, error) {
+	var data HTTPAttributes
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.Shared.Title) > 0 {
+		return &data.Shared, nil
+	}
+
+	var fw FirmwareInfo
+	err = json.Unmarshal(body, &fw)
+	if err != nil {
+		return nil, err
+	}
+	return &fw, nil
+}
+
+// coapStatusCode converts the response code to its HTTP-like notation (e.g. 2.05 -> 205), or 0 if no response was received
+func coapStatusCode(res *pool.Message) int {
+	if res == nil {
+		return 0
+	}
+	code := res.Code()
+	return int(code>>5)*100 + int(code&0x1f)
+}
@@ -1,4 +1,4 @@
-package main
+package thingsboard
 
 import (
 	"gopkg.in/yaml.v3"
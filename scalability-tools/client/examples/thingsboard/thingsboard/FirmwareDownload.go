@@ -0,0 +1,85 @@
+package thingsboard
+
+import (
+	"encoding/hex"
+	"hash"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates"
+	"strings"
+)
+
+// PARTIAL_DOWNLOAD is the key of the interrupted download in the state persisted by the device controller.
+// It outlives the devices instances, as the flash memory of a real device survives its reboot
+const PARTIAL_DOWNLOAD = "tb/partialDownload"
+
+// firmwareDownload receives a firmware while it is downloaded. The bytes are hashed on the fly with the checksum
+// algorithm of the firmware and kept in memory only if required, so that the memory of a device does not grow
+// with the firmware size. The received bytes go through the download fault of the device, if any
+type firmwareDownload struct {
+	title     string
+	version   string
+	alg       ChecksumAlg
+	hash      hash.Hash
+	hashErr   error // the checksum algorithm is not supported
+	keepData  bool
+	data      []byte
+	size      int64
+	nextChunk int // next chunk to request for a chunked download
+	fault     *fault.Download
+	expected  int64 // size announced in the firmware info
+}
+
+// newFirmwareDownload creates a new, empty, firmwareDownload
+func newFirmwareDownload(fw FirmwareInfo, keepData bool, downloadFault *fault.Download) *firmwareDownload {
+	d := &firmwareDownload{
+		title:    fw.Title,
+		version:  fw.Version,
+		alg:      fw.ChecksumAlg,
+		keepData: keepData,
+		fault:    downloadFault,
+		expected: int64(fw.Size),
+	}
+	d.reset()
+	return d
+}
+
+// Write implements io.Writer
+func (d *firmwareDownload) Write(p []byte) (int, error) {
+	n := len(p)
+	p = d.fault.Apply(p, d.size, d.expected)
+	if d.hash != nil {
+		d.hash.Write(p)
+	}
+	d.size += int64(len(p))
+	if d.keepData {
+		d.data = append(d.data, p...)
+	}
+	return n, nil
+}
+
+// reset discards the received bytes, e.g. before a download that cannot be resumed
+func (d *firmwareDownload) reset() {
+	d.hash, d.hashErr = newChecksumHash(d.alg)
+	d.data = nil
+	d.size = 0
+	d.nextChunk = 0
+}
+
+// checksum returns the checksum of the received bytes as hexadecimal string, as ThingsBoard expects it in the firmware info
+func (d *firmwareDownload) checksum() (string, error) {
+	if d.hashErr != nil {
+		return "", d.hashErr
+	}
+	return strings.ToLower(hex.EncodeToString(d.hash.Sum(nil))), nil
+}
+
+// loadDownload takes the partial download of the firmware persisted by the device. A new download is started if the device
+// was downloading a different firmware. The download is owned by the caller until it is kept again
+func loadDownload(controller templates.Controller, fw FirmwareInfo, keepData bool) *firmwareDownload {
+	state, ok := controller.TakeState(PARTIAL_DOWNLOAD)
+	download, _ := state.(*firmwareDownload)
+	if !ok || download == nil || download.title != fw.Title || download.version != fw.Version {
+		download = newFirmwareDownload(fw, keepData, controller.GetDownloadFault())
+	}
+	return download
+}
@@ -0,0 +1,72 @@
+package thingsboard
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func TestFirmwareDownload(t *testing.T) {
+	firmware := testFirmware(100000)
+	algs := []ChecksumAlg{SHA256, SHA348, SHA512, MD5, MURMUR3_32, MURMUR3_128, CRC32}
+
+	for _, alg := range algs {
+		for _, keepData := range []bool{true, false} {
+			want, err := Checksum(alg, firmware)
+			if err != nil {
+				t.Fatalf("Checksum %s: %s", alg, err)
+			}
+
+			// the firmware is streamed by small pieces, as received from the network
+			download := newFirmwareDownload(FirmwareInfo{ChecksumAlg: alg, Size: float64(len(firmware))}, keepData, nil)
+			if _, err := io.CopyBuffer(download, bytes.NewReader(firmware), make([]byte, 1000)); err != nil {
+				t.Fatalf("%s: Copy: %s", alg, err)
+			}
+			if got, err := download.checksum(); err != nil || got != want {
+				t.Errorf("%s: got checksum %s (error %v), want %s", alg, got, err, want)
+			}
+			if download.size != int64(len(firmware)) {
+				t.Errorf("%s: got size %d, want %d", alg, download.size, len(firmware))
+			}
+			if keepData && !bytes.Equal(download.data, firmware) {
+				t.Errorf("%s: got %d bytes kept, want the %d bytes of the firmware", alg, len(download.data), len(firmware))
+			}
+			if !keepData && download.data != nil {
+				t.Errorf("%s: got %d bytes kept, want the bytes discarded", alg, len(download.data))
+			}
+		}
+	}
+}
+
+func TestFirmwareDownloadReset(t *testing.T) {
+	firmware := testFirmware(3000)
+	download := newFirmwareDownload(FirmwareInfo{ChecksumAlg: SHA256}, true, nil)
+	download.Write([]byte("partial firmware"))
+	download.nextChunk = 3
+
+	download.reset()
+	if download.size != 0 || download.data != nil || download.nextChunk != 0 {
+		t.Errorf("got size %d, %d bytes kept and next chunk %d after the reset, want an empty download",
+			download.size, len(download.data), download.nextChunk)
+	}
+	download.Write(firmware)
+	sum := sha256.Sum256(firmware)
+	if got, _ := download.checksum(); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("got checksum %s, want the checksum of the firmware only %x", got, sum)
+	}
+}
+
+func TestFirmwareDownloadUnknownAlg(t *testing.T) {
+	download := newFirmwareDownload(FirmwareInfo{ChecksumAlg: "SHA1024"}, false, nil)
+	if _, err := download.Write(testFirmware(100)); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if download.size != 100 {
+		t.Errorf("got size %d, want 100", download.size)
+	}
+	if _, err := download.checksum(); err == nil {
+		t.Error("checksum: got no error, want the unrecognized algorithm")
+	}
+}
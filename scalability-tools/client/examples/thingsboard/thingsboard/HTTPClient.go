@@ -42,19 +42,20 @@ type HTTPClient struct {
 }
 
 // NewHTTPClient creates an instance of HTTP Client
-func NewHTTPClient(controller templates.Controller, endpoint string, pollDelay int, useHTTPPool bool) *HTTPClient {
-	api := newHTTPService(endpoint, controller.GetIdentifier(), useHTTPPool)
+func NewHTTPClient(controller templates.Controller, endpoint string, pollDelay int, useHTTPPool bool, download DownloadConfig, discardFirmware bool) *HTTPClient {
+	api := newHTTPService(controller, endpoint, controller.GetIdentifier(), useHTTPPool, download)
 	c := &HTTPClient{
 		controller:  controller,
 		HTTPService: api,
 		pollDelay:   time.Duration(pollDelay),
 	}
-	c.UpdateModule = newUpdateManager(c)
+	c.UpdateModule = newUpdateManager(controller, api, discardFirmware)
 	return c
 }
 
 // Start implements Device.Start
 func (c *HTTPClient) Start(ctx context.Context) (err error) {
+	c.ctx = ctx
 	err = c.ReportCurrState()
 	c.controller.Connect(err == nil)
 	if err != nil {
@@ -96,7 +97,7 @@ func (c *HTTPClient) poll() (err error) {
 
 	c.controller.StartTask()
 	c.controller.GetScheduler().Submit(func() {
-		err = c.StartUpdate(*fwInfo)
+		err := c.StartUpdate(*fwInfo)
 		if err != nil {
 			c.controller.GetLogger().Err(err).Send()
 		}
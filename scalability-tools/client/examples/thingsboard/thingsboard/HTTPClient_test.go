@@ -0,0 +1,132 @@
+package thingsboard_test
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"hitachienergy/scalability-test-client/examples/thingsboard/tbmock"
+	"hitachienergy/scalability-test-client/examples/thingsboard/thingsboard"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates/templatestest"
+)
+
+// taskTimeout bounds the time needed by a device to finish its task, the devices polling every second
+const taskTimeout = 10 * time.Second
+
+// firmwareSize is not a multiple of the chunk size, so that the last chunk is partial
+const firmwareSize = 50000
+
+// updatePhases are the phases reached by a device during a successful update
+var updatePhases = []string{"DOWNLOADING", "DOWNLOADED", "VERIFIED", "UPDATING", "UPDATED"}
+
+// startTBServer starts the mock ThingsBoard server on HTTP
+func startTBServer(t *testing.T, config tbmock.TBServerConfig) (*tbmock.TBServer, string) {
+	config.FirmwareSize = firmwareSize
+	server, err := tbmock.NewTBServer(config)
+	if err != nil {
+		t.Fatalf("NewTBServer: %s", err)
+	}
+	return server, templatestest.StartHTTPServer(t, server)
+}
+
+// startHTTPDevice creates a ThingsBoard HTTP device with a fake controller and starts polling the server
+func startHTTPDevice(t *testing.T, endpoint string, token string, download thingsboard.DownloadConfig, outcome fault.UpdateOutcome) (*templatestest.Controller, error) {
+	controller := templatestest.NewController(token, 0, outcome)
+	client := thingsboard.NewHTTPClient(controller, endpoint, 1, false, download, true)
+	return controller, templatestest.StartDevice(t, controller, client.Start)
+}
+
+func TestHTTPUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		download    thingsboard.DownloadConfig
+		checksumAlg thingsboard.ChecksumAlg
+		requests    int // firmware requests per device
+	}{
+		{"single request", thingsboard.DownloadConfig{}, thingsboard.SHA256, 1},
+		{"chunked", thingsboard.DownloadConfig{ChunkSize: 4096}, thingsboard.MD5, 13},
+		{"chunked with progress", thingsboard.DownloadConfig{ChunkSize: 4096, ProgressPeriod: 4}, thingsboard.CRC32, 13},
+		{"single chunk", thingsboard.DownloadConfig{ChunkSize: 2 * firmwareSize}, thingsboard.MURMUR3_128, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, endpoint := startTBServer(t, tbmock.TBServerConfig{Seed: 1, ChecksumAlg: test.checksumAlg})
+
+			controllers := map[string]*templatestest.Controller{}
+			for i := 0; i < 3; i++ {
+				token := fmt.Sprintf("http%d", i)
+				controller, err := startHTTPDevice(t, endpoint, token, test.download, fault.UpdateOutcome{})
+				if err != nil {
+					t.Fatalf("%s: Start: %s", token, err)
+				}
+				controllers[token] = controller
+			}
+
+			for token, controller := range controllers {
+				templatestest.WaitTask(t, controller, taskTimeout)
+
+				if success, _ := controller.Result(); !success {
+					t.Errorf("%s: task failed. Phases: %v", token, controller.Phases())
+				}
+				if phases := controller.Phases(); !reflect.DeepEqual(phases, updatePhases) {
+					t.Errorf("%s: got phases %v, want %v", token, phases, updatePhases)
+				}
+				device := server.Device(token)
+				if device.DownloadedBytes != firmwareSize || device.FirmwareRequests != test.requests {
+					t.Errorf("%s: got %d bytes in %d requests, want %d bytes in %d requests",
+						token, device.DownloadedBytes, device.FirmwareRequests, firmwareSize, test.requests)
+				}
+			}
+
+			if failures := server.VerifyAll(); len(failures) > 0 {
+				t.Errorf("VerifyAll: %v", failures)
+			}
+		})
+	}
+}
+
+func TestHTTPInjectedErrors(t *testing.T) {
+	server, endpoint := startTBServer(t, tbmock.TBServerConfig{Seed: 2, ErrorRate: 0.1})
+	// the chunks are requested again after an injected error, so that the downloads succeed
+	download := thingsboard.DownloadConfig{ChunkSize: 4096, ChunkRetries: 10}
+
+	controllers := map[string]*templatestest.Controller{}
+	connected := map[string]*templatestest.Controller{}
+	for i := 0; i < 10; i++ {
+		token := fmt.Sprintf("http%d", i)
+		controller, err := startHTTPDevice(t, endpoint, token, download, fault.UpdateOutcome{})
+		controllers[token] = controller
+		if err != nil {
+			// the report of the current state failed, the device is not connected
+			if got := controller.Connects(); !reflect.DeepEqual(got, []bool{false}) {
+				t.Errorf("%s: got connects %v after %s, want [false]", token, got, err)
+			}
+			continue
+		}
+		connected[token] = controller
+	}
+	if len(connected) == 0 {
+		t.Fatal("no device connected")
+	}
+
+	for token, controller := range connected {
+		templatestest.WaitTask(t, controller, taskTimeout)
+
+		if success, _ := controller.Result(); !success {
+			t.Errorf("%s: task failed. Phases: %v", token, controller.Phases())
+		}
+		// the failed requests are not recorded by the server, so every byte is downloaded once
+		if device := server.Device(token); device.DownloadedBytes != firmwareSize {
+			t.Errorf("%s: got %d downloaded bytes, want %d", token, device.DownloadedBytes, firmwareSize)
+		}
+	}
+
+	endpoints := []string{"tb/attributes", "tb/firmware", "tb/telemetry"}
+	if templatestest.CountStatus(controllers, endpoints, http.StatusServiceUnavailable) == 0 {
+		t.Error("no injected error reported by the devices")
+	}
+}
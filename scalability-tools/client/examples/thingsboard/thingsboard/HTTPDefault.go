@@ -0,0 +1,87 @@
+package thingsboard
+
+import (
+	"hitachienergy/scalability-test-client/examples/httppool"
+	"hitachienergy/scalability-test-client/registry"
+	"hitachienergy/scalability-test-client/templates"
+
+	"golang.org/x/xerrors"
+)
+
+// ------------------------------------ Client Factory -----------------------------------
+
+func init() {
+	registry.Register("TBHTTPDefaultFactory", HTTPDefaultClientFactory{})
+}
+
+type HTTPDefaultClientFactory struct {
+	templates.DeviceFactory
+	Config ThingsBoardConfig
+}
+
+func (d HTTPDefaultClientFactory) ParseConfig(data []byte) (templates.DeviceFactory, error) {
+	configs, err := ParseConfig(data)
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid config structure for devices simulation")
+	}
+	d.Config = *configs
+
+	err = httpCheckAndSetInputs(d.Config.Client.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+func (d HTTPDefaultClientFactory) NewDevice(controller templates.Controller) (client templates.Device, err error) {
+	params := d.Config.Client.Args
+	address := d.Config.Server.DevicesEndpoint
+
+	httpPoolSize := params["httpPoolSize"].(int)
+	if httpPoolSize > 0 {
+		httppool.Pool.Init(httpPoolSize)
+	}
+
+	download := DownloadConfig{
+		ChunkSize:      params["chunkSize"].(int),
+		ChunkRetries:   params["chunkRetries"].(int),
+		ProgressPeriod: params["progressReportPeriod"].(int),
+	}
+	c := NewHTTPClient(controller, address, params["pollDelay"].(int), httpPoolSize > 0, download, params["discardFirmware"].(bool))
+	// c.UpdateModule = &defaultHTTPUM{UpdateManager: newUpdateManager(c.HTTPService), ctr: controller}
+
+	return c, nil
+}
+
+func httpCheckAndSetInputs(params map[string]interface{}) (err error) {
+	if _, ok := params["pollDelay"]; !ok {
+		params["pollDelay"] = 30 // default poll delay: 30s
+	} else if _, ok := params["pollDelay"].(int); !ok {
+		return xerrors.Errorf("Invalid input (pollDelay). Expected: int")
+	}
+	if _, ok := params["httpPoolSize"].(int); !ok {
+		params["httpPoolSize"] = 0 // default: not use HTTPPool (no limit on HTTP Connections)
+	}
+	if _, ok := params["chunkSize"]; !ok {
+		params["chunkSize"] = 0 // default: download the firmware with a single request
+	} else if _, ok := params["chunkSize"].(int); !ok {
+		return xerrors.Errorf("Invalid input (chunkSize). Expected: int")
+	}
+	if _, ok := params["chunkRetries"]; !ok {
+		params["chunkRetries"] = 3 // default: request a chunk up to 4 times
+	} else if _, ok := params["chunkRetries"].(int); !ok {
+		return xerrors.Errorf("Invalid input (chunkRetries). Expected: int")
+	}
+	if _, ok := params["progressReportPeriod"]; !ok {
+		params["progressReportPeriod"] = 0 // default: do not report the download progress to the server
+	} else if _, ok := params["progressReportPeriod"].(int); !ok {
+		return xerrors.Errorf("Invalid input (progressReportPeriod). Expected: int")
+	}
+	if _, ok := params["discardFirmware"]; !ok {
+		params["discardFirmware"] = false // default: keep the downloaded firmware in memory
+	} else if _, ok := params["discardFirmware"].(bool); !ok {
+		return xerrors.Errorf("Invalid input (discardFirmware). Expected: bool")
+	}
+
+	return nil
+}
@@ -2,43 +2,64 @@ package thingsboard
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"hitachienergy/scalability-test-client/examples/httppool"
+	"hitachienergy/scalability-test-client/templates"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"golang.org/x/xerrors"
 )
 
+// CHUNK_RETRY_DELAY is the delay before requesting again a firmware chunk after a transient error
+const CHUNK_RETRY_DELAY = time.Second
+
+// DownloadConfig represents how the firmware is downloaded
+type DownloadConfig struct {
+	ChunkSize      int // size in bytes of the firmware chunks, 0 to download the firmware with a single request
+	ChunkRetries   int // number of times a chunk is requested again after a transient error
+	ProgressPeriod int // number of chunks between two progress reports to the server, 0 to disable them
+}
+
 type HTTPService struct {
+	controller     templates.Controller
+	ctx            context.Context
 	baseEndpoint   string
 	accessToken    string
 	secureDownload bool
+	download       DownloadConfig
 
 	useHTTPPool bool
 }
 
 // newHTTPService creates a new HTTPService
-func newHTTPService(baseEndpoint string, accessToken string, useHTTPPool bool) *HTTPService {
+func newHTTPService(controller templates.Controller, baseEndpoint string, accessToken string, useHTTPPool bool, download DownloadConfig) *HTTPService {
 	_, port, err := net.SplitHostPort(baseEndpoint)
 	secureDownload := (err == nil && port == "443")
 	s := &HTTPService{
+		controller:     controller,
+		ctx:            context.Background(),
 		baseEndpoint:   baseEndpoint,
 		accessToken:    accessToken,
 		secureDownload: secureDownload,
+		download:       download,
 		useHTTPPool:    useHTTPPool,
 	}
 
 	return s
 }
 
-// getID returns the access token of the device
-// func (s *HTTPService) getID() string {
-// 	return s.accessToken
-// }
+// GetID implements CommunicationService.GetID. It returns the access token of the device
+func (s *HTTPService) GetID() string {
+	return s.accessToken
+}
 
 // getFirmwareInfo returns the firmware info pulled from the server
 func (s *HTTPService) getFirmwareInfo() (info *FirmwareInfo, err error) {
@@ -49,11 +70,11 @@ func (s *HTTPService) getFirmwareInfo() (info *FirmwareInfo, err error) {
 	params := url.Values{}
 	params.Add("sharedKeys", FIRMWARE_SHARED_KEYS)
 	myurl.RawQuery = params.Encode()
-	req, err := http.NewRequest("GET", myurl.String(), nil)
+	req, err := http.NewRequestWithContext(s.ctx, "GET", myurl.String(), nil)
 	if err != nil {
 		return nil, err
 	}
-	res, err := s.send(req)
+	res, err := s.send("tb/attributes", req)
 	if err != nil {
 		return nil, err
 	}
@@ -79,98 +100,122 @@ func (s *HTTPService) getFirmwareInfo() (info *FirmwareInfo, err error) {
 	return &data.Shared, nil
 }
 
-// getFirmware downloads the firmware from the server
-func (s *HTTPService) getFirmware(fwinfo FirmwareInfo) (data []byte, err error) {
+// GetFirmware implements CommunicationService.GetFirmware. It downloads the firmware from the server,
+// either with a single request or chunk by chunk. An interrupted chunked download is resumed from the last received chunk
+func (s *HTTPService) GetFirmware(fwinfo FirmwareInfo, download *firmwareDownload) (err error) {
+	if s.download.ChunkSize <= 0 {
+		download.reset()
+		return s.getFirmwareChunk(fwinfo, url.Values{}, download)
+	}
+
+	if download.nextChunk > 0 {
+		s.controller.GetLogger().Info().Msgf("Resuming firmware download from chunk %d", download.nextChunk)
+	}
+
+	chunkCount := int(math.Ceil(fwinfo.Size / float64(s.download.ChunkSize)))
+	for chunk := download.nextChunk; chunkCount == 0 || chunk < chunkCount; chunk++ {
+		dataChunk, err := s.getFirmwareChunkWithRetries(fwinfo, chunk)
+		if err != nil {
+			return err
+		}
+		download.Write(dataChunk)
+		download.nextChunk = chunk + 1
+		s.reportProgress(download, chunkCount)
+
+		if len(dataChunk) < s.download.ChunkSize {
+			break
+		}
+	}
+
+	return nil
+}
+
+// getFirmwareChunkWithRetries downloads a chunk of the firmware. The chunk is requested again after transient errors.
+// The chunk is buffered, so that a failed attempt does not leave partial data in the download
+func (s *HTTPService) getFirmwareChunkWithRetries(fwinfo FirmwareInfo, chunk int) (data []byte, err error) {
+	params := url.Values{}
+	params.Add("chunk", strconv.Itoa(chunk))
+	params.Add("size", strconv.Itoa(s.download.ChunkSize))
+
+	for attempt := 0; ; attempt++ {
+		buffer := bytes.NewBuffer(make([]byte, 0, s.download.ChunkSize))
+		err = s.getFirmwareChunk(fwinfo, params, buffer)
+		if err == nil || attempt >= s.download.ChunkRetries {
+			return buffer.Bytes(), err
+		}
+
+		s.controller.GetLogger().Debug().Msgf("Fail to get firmware chunk %d (attempt %d): %s", chunk, attempt+1, err)
+		select {
+		case <-s.ctx.Done():
+			return nil, err
+		case <-time.After(CHUNK_RETRY_DELAY):
+		}
+	}
+}
+
+// getFirmwareChunk downloads the firmware, or the chunk selected by the additional parameters. The body is streamed to the writer
+func (s *HTTPService) getFirmwareChunk(fwinfo FirmwareInfo, params url.Values, w io.Writer) (err error) {
 	httpsIndicator := ""
 	if s.secureDownload {
 		httpsIndicator = "s"
 	}
 	myurl, err := url.Parse(fmt.Sprintf("http%s://%s/api/v1/%s/firmware", httpsIndicator, s.baseEndpoint, s.accessToken))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// TODO: do we need to support chunk-by-chunk downloading?
-	params := url.Values{}
-	params.Add("title", fwinfo.Title)
-	params.Add("version", fwinfo.Version)
+	params.Set("title", fwinfo.Title)
+	params.Set("version", fwinfo.Version)
 	myurl.RawQuery = params.Encode()
-	req, err := http.NewRequest("GET", myurl.String(), nil)
+	req, err := http.NewRequestWithContext(s.ctx, "GET", myurl.String(), nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	res, err := s.send(req)
+	res, err := s.send("tb/firmware", req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode > 299 {
-		return nil, xerrors.Errorf("Fail to get firmware. Status code: %d (%s)", res.StatusCode, res.Status)
+		return xerrors.Errorf("Fail to get firmware. Status code: %d (%s)", res.StatusCode, res.Status)
 	}
 
-	data, err = io.ReadAll(res.Body)
-	return data, err
+	_, err = io.Copy(w, res.Body)
+	return err
 }
 
-// func (s *HTTPService) getFirmware(fwinfo FirmwareInfo) (data []byte, err error) {
-// 	httpsIndicator := ""
-// 	if s.secureDownload {
-// 		httpsIndicator = "s"
-// 	}
-
-// 	if CHUNK_SIZE <= 0 {
-// 		CHUNK_SIZE = int(fwinfo.Size)
-// 	}
-
-// 	num_chunks := int(math.Ceil(fwinfo.Size / float64(CHUNK_SIZE)))
-// 	for i := 0; i < num_chunks; i++ {
-// 		// log.Info().Msgf("Loading chunk %d / %d", i+1, num_chunks)
-
-// 		myurl, err := url.Parse(fmt.Sprintf("http%s://%s/api/v1/%s/firmware", httpsIndicator, s.baseEndpoint, s.accessToken))
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		params := url.Values{}
-// 		params.Add("title", fwinfo.Title)
-// 		params.Add("version", fwinfo.Version)
-// 		params.Add("chunk", fmt.Sprintf("%d", i))
-// 		params.Add("size", fmt.Sprintf("%d", CHUNK_SIZE))
-
-// 		myurl.RawQuery = params.Encode()
-
-// 		req, err := http.NewRequest("GET", myurl.String(), nil)
-// 		if err != nil {
-// 			return nil, err
-// 		}
-
-// 		res, err := s.send(req)
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		defer res.Body.Close()
-// 		if res.StatusCode > 299 {
-// 			return nil, xerrors.Errorf("Fail to get firmware. Status code: %d (%s)", res.StatusCode, res.Status)
-// 		}
-
-// 		data_chunk, err := io.ReadAll(res.Body)
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		data = append(data, data_chunk...)
-// 		// log.Info().Msgf("Loaded chunk %d / %d", i+1, num_chunks)
-// 	}
-// 	return data, err
-// }
-
-// reportUpdateState reports the update state the the server
-func (s *HTTPService) reportUpdateState(state FWUpdateState) (err error) {
-	jsonPayload, err := json.Marshal(state)
+// reportProgress logs the progress of a chunked download and, periodically, reports it to the server as telemetry
+func (s *HTTPService) reportProgress(download *firmwareDownload, chunkCount int) {
+	if chunkCount == 0 {
+		s.controller.GetLogger().Debug().Msgf("Loaded chunk %d", download.nextChunk)
+		return
+	}
+
+	progress := 100 * float64(download.nextChunk) / float64(chunkCount)
+	s.controller.GetLogger().Debug().Msgf("Loaded chunk %d / %d (%.1f%%)", download.nextChunk, chunkCount, progress)
+	if s.download.ProgressPeriod <= 0 || (download.nextChunk%s.download.ProgressPeriod != 0 && download.nextChunk != chunkCount) {
+		return
+	}
+	err := s.postTelemetry(FWDownloadProgress{Progress: progress})
+	if err != nil {
+		s.controller.GetLogger().Err(err).Send()
+	}
+}
+
+// ReportUpdateState implements CommunicationService.ReportUpdateState. It reports the update state the the server
+func (s *HTTPService) ReportUpdateState(state FWUpdateState) (err error) {
+	return s.postTelemetry(state)
+}
+
+// postTelemetry posts the telemetry data to the server
+func (s *HTTPService) postTelemetry(data interface{}) (err error) {
+	jsonPayload, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST",
+	req, err := http.NewRequestWithContext(s.ctx, "POST",
 		fmt.Sprintf("http://%s/api/v1/%s/telemetry", s.baseEndpoint, s.accessToken),
 		bytes.NewBuffer(jsonPayload))
 	if err != nil {
@@ -178,7 +223,7 @@ func (s *HTTPService) reportUpdateState(state FWUpdateState) (err error) {
 	}
 	req.Header.Add("Content-Type", "application/json;charset=UTF-8")
 
-	res, err := s.send(req)
+	res, err := s.send("tb/telemetry", req)
 	if err != nil {
 		return err
 	}
@@ -191,14 +236,13 @@ func (s *HTTPService) reportUpdateState(state FWUpdateState) (err error) {
 	return nil
 }
 
-// send sends an HTTP requests using either a shared http client or the http pool based on the configuration
-func (s *HTTPService) send(request *http.Request) (*http.Response, error) {
+// send sends an HTTP request with the client of the device (see httppool.Do).
+// The result of the request is reported to the controller under the given endpoint name
+func (s *HTTPService) send(endpoint string, request *http.Request) (res *http.Response, err error) {
 	request.Close = true
+	defer func() {
+		s.controller.ReportRequest(endpoint, statusCode(res), err)
+	}()
 
-	if !s.useHTTPPool {
-		return httppool.Client.Do(request)
-	}
-	client := httppool.Pool.Get()
-	defer httppool.Pool.Put(client)
-	return client.Do(request)
+	return httppool.Do(s.controller.GetNetwork(), s.useHTTPPool, request)
 }
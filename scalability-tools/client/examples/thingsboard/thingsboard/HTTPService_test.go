@@ -0,0 +1,156 @@
+package thingsboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates/templatestest"
+)
+
+// firmwareServer serves a firmware by chunks as ThingsBoard does, and fails the selected requests
+type firmwareServer struct {
+	firmware []byte
+	fail     func(n int) bool // the nth firmware request (from 0) fails
+
+	sync.Mutex
+	chunks   []int     // chunks requested by the device, in order
+	progress []float64 // download progress reported by the device
+}
+
+// startFirmwareServer serves the firmware on a local port until the end of the test
+func startFirmwareServer(t *testing.T, firmware []byte) (*firmwareServer, string) {
+	server := &firmwareServer{firmware: firmware}
+	return server, templatestest.StartHTTPServer(t, server)
+}
+
+func (s *firmwareServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/telemetry") {
+		var progress FWDownloadProgress
+		json.NewDecoder(r.Body).Decode(&progress)
+		s.Lock()
+		s.progress = append(s.progress, progress.Progress)
+		s.Unlock()
+		return
+	}
+
+	query := r.URL.Query()
+	chunk, _ := strconv.Atoi(query.Get("chunk"))
+	size, err := strconv.Atoi(query.Get("size"))
+	if err != nil {
+		chunk, size = 0, len(s.firmware) // the whole firmware
+	}
+	s.Lock()
+	n := len(s.chunks)
+	s.chunks = append(s.chunks, chunk)
+	s.Unlock()
+	if s.fail != nil && s.fail(n) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	start, end := chunk*size, (chunk+1)*size
+	if start > len(s.firmware) {
+		start = len(s.firmware)
+	}
+	if end > len(s.firmware) {
+		end = len(s.firmware)
+	}
+	w.Write(s.firmware[start:end])
+}
+
+// requests returns the chunks requested by the device and the progress it reported
+func (s *firmwareServer) requests() ([]int, []float64) {
+	s.Lock()
+	defer s.Unlock()
+	return append([]int{}, s.chunks...), append([]float64(nil), s.progress...)
+}
+
+// newTestHTTPService creates the HTTP service of a device downloading from the endpoint
+func newTestHTTPService(t *testing.T, endpoint string, download DownloadConfig) *HTTPService {
+	controller := templatestest.NewController("http0", 0, fault.UpdateOutcome{})
+	t.Cleanup(controller.Release)
+	return newHTTPService(controller, endpoint, "http0", false, download)
+}
+
+func TestHTTPGetFirmware(t *testing.T) {
+	tests := []struct {
+		name     string
+		download DownloadConfig
+		size     int // size announced in the firmware info, 0 if unknown
+		fail     func(n int) bool
+		chunks   []int
+		progress []float64
+	}{
+		{"single request", DownloadConfig{}, 4000, nil, []int{0}, nil},
+		{"chunked", DownloadConfig{ChunkSize: 1024}, 4000, nil, []int{0, 1, 2, 3}, nil},
+		{"unknown size", DownloadConfig{ChunkSize: 1000}, 0, nil, []int{0, 1, 2, 3, 4}, nil}, // the empty chunk ends the download
+		{"progress", DownloadConfig{ChunkSize: 1024, ProgressPeriod: 3}, 4000, nil, []int{0, 1, 2, 3}, []float64{75, 100}},
+		{"retried chunk", DownloadConfig{ChunkSize: 1024, ChunkRetries: 1}, 4000, func(n int) bool { return n == 1 }, []int{0, 1, 1, 2, 3}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, endpoint := startFirmwareServer(t, testFirmware(4000))
+			server.fail = test.fail
+			service := newTestHTTPService(t, endpoint, test.download)
+
+			info := FirmwareInfo{Title: "firmware", Version: "1.0.0", Size: float64(test.size)}
+			download := newFirmwareDownload(info, true, nil)
+			if err := service.GetFirmware(info, download); err != nil {
+				t.Fatalf("GetFirmware: %s", err)
+			}
+			if !bytes.Equal(download.data, server.firmware) {
+				t.Errorf("got %d bytes, want the %d bytes of the firmware", len(download.data), len(server.firmware))
+			}
+			chunks, progress := server.requests()
+			if !reflect.DeepEqual(chunks, test.chunks) {
+				t.Errorf("got requested chunks %v, want %v", chunks, test.chunks)
+			}
+			if !reflect.DeepEqual(progress, test.progress) {
+				t.Errorf("got progress %v, want %v", progress, test.progress)
+			}
+		})
+	}
+}
+
+func TestHTTPGetFirmwareResume(t *testing.T) {
+	server, endpoint := startFirmwareServer(t, testFirmware(4000))
+	server.fail = func(n int) bool { return n == 2 } // the first request of chunk 2 fails, without retry
+	service := newTestHTTPService(t, endpoint, DownloadConfig{ChunkSize: 1024})
+
+	info := FirmwareInfo{Title: "firmware", Version: "1.0.0", Size: 4000}
+	download := newFirmwareDownload(info, true, nil)
+	if err := service.GetFirmware(info, download); err == nil {
+		t.Fatal("GetFirmware: got no error, want the failure of chunk 2")
+	}
+	if download.size != 2048 || download.nextChunk != 2 {
+		t.Errorf("got %d bytes and next chunk %d after the failure, want 2048 bytes and next chunk 2", download.size, download.nextChunk)
+	}
+
+	// the download resumes from the failed chunk
+	if err := service.GetFirmware(info, download); err != nil {
+		t.Fatalf("GetFirmware after the failure: %s", err)
+	}
+	if !bytes.Equal(download.data, server.firmware) {
+		t.Errorf("got %d bytes, want the %d bytes of the firmware", len(download.data), len(server.firmware))
+	}
+	if chunks, _ := server.requests(); !reflect.DeepEqual(chunks, []int{0, 1, 2, 2, 3}) {
+		t.Errorf("got requested chunks %v, want [0 1 2 2 3]", chunks)
+	}
+
+	// a single request download cannot be resumed, it starts over
+	service.download = DownloadConfig{}
+	if err := service.GetFirmware(info, download); err != nil {
+		t.Fatalf("GetFirmware with a single request: %s", err)
+	}
+	if !bytes.Equal(download.data, server.firmware) {
+		t.Errorf("got %d bytes, want the %d bytes of the firmware once", len(download.data), len(server.firmware))
+	}
+}
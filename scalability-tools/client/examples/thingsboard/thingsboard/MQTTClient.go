@@ -0,0 +1,77 @@
+package thingsboard
+
+import (
+	"context"
+	"hitachienergy/scalability-test-client/templates"
+	"time"
+)
+
+// MQTTClient is a ThingsBoard device using the MQTT device API.
+// Unlike HTTPClient, it does not poll the server: firmware updates are pushed through the shared attributes
+type MQTTClient struct {
+	*MQTTService
+	controller templates.Controller
+	UpdateModule
+}
+
+// NewMQTTClient creates an instance of MQTT Client
+func NewMQTTClient(controller templates.Controller, endpoint string, chunkSize int, qos byte, timeout int, discardFirmware bool) *MQTTClient {
+	service := newMQTTService(controller, endpoint, controller.GetIdentifier(), chunkSize, qos, time.Duration(timeout)*time.Second)
+	c := &MQTTClient{
+		controller:  controller,
+		MQTTService: service,
+	}
+	c.UpdateModule = newUpdateManager(controller, service, discardFirmware)
+	return c
+}
+
+// Start implements Device.Start
+func (c *MQTTClient) Start(ctx context.Context) (err error) {
+	err = c.connect(c.handleFirmwareInfo)
+	if err != nil {
+		c.controller.Connect(false)
+		return err
+	}
+	err = c.ReportCurrState()
+	c.controller.Connect(err == nil)
+	if err != nil {
+		c.disconnect()
+		return err
+	}
+
+	go func() {
+		// the firmware may have been assigned before the device subscribed to the shared attributes
+		fwInfo, err := c.getFirmwareInfo()
+		if err != nil {
+			c.controller.GetLogger().Err(err).Send()
+		} else {
+			c.handleFirmwareInfo(*fwInfo)
+		}
+
+		<-ctx.Done()
+		c.disconnect()
+	}()
+
+	return nil
+}
+
+// Stop implements device.Stop
+func (c *MQTTClient) Stop() error {
+	c.disconnect()
+	return nil
+}
+
+// handleFirmwareInfo starts the update if the server assigned a new firmware
+func (c *MQTTClient) handleFirmwareInfo(fwInfo FirmwareInfo) {
+	if !c.CheckFw(fwInfo) {
+		return
+	}
+
+	c.controller.StartTask()
+	c.controller.GetScheduler().Submit(func() {
+		err := c.StartUpdate(fwInfo)
+		if err != nil {
+			c.controller.GetLogger().Err(err).Send()
+		}
+	})
+}
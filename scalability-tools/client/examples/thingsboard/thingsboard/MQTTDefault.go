@@ -0,0 +1,68 @@
+package thingsboard
+
+import (
+	"hitachienergy/scalability-test-client/registry"
+	"hitachienergy/scalability-test-client/templates"
+
+	"golang.org/x/xerrors"
+)
+
+// ------------------------------------ Client Factory -----------------------------------
+
+func init() {
+	registry.Register("TBMQTTDefaultFactory", MQTTDefaultClientFactory{})
+}
+
+type MQTTDefaultClientFactory struct {
+	templates.DeviceFactory
+	Config ThingsBoardConfig
+}
+
+func (d MQTTDefaultClientFactory) ParseConfig(data []byte) (templates.DeviceFactory, error) {
+	configs, err := ParseConfig(data)
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid config structure for devices simulation")
+	}
+	d.Config = *configs
+
+	err = mqttCheckAndSetInputs(d.Config.Client.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d MQTTDefaultClientFactory) NewDevice(controller templates.Controller) (client templates.Device, err error) {
+	params := d.Config.Client.Args
+	address := d.Config.Server.DevicesEndpoint
+
+	c := NewMQTTClient(controller, address, params["chunkSize"].(int), byte(params["qos"].(int)), params["requestTimeout"].(int), params["discardFirmware"].(bool))
+
+	return c, nil
+}
+
+func mqttCheckAndSetInputs(params map[string]interface{}) (err error) {
+	if _, ok := params["chunkSize"]; !ok {
+		params["chunkSize"] = 64 * 1024 // default chunk size: 64KB
+	} else if chunkSize, ok := params["chunkSize"].(int); !ok || chunkSize <= 0 {
+		return xerrors.Errorf("Invalid input (chunkSize). Expected: positive int")
+	}
+	if _, ok := params["qos"]; !ok {
+		params["qos"] = 1 // default: at least once
+	} else if qos, ok := params["qos"].(int); !ok || qos < 0 || qos > 2 {
+		return xerrors.Errorf("Invalid input (qos). Expected: 0, 1 or 2")
+	}
+	if _, ok := params["requestTimeout"]; !ok {
+		params["requestTimeout"] = 60 // default request timeout: 60s
+	} else if _, ok := params["requestTimeout"].(int); !ok {
+		return xerrors.Errorf("Invalid input (requestTimeout). Expected: int")
+	}
+	if _, ok := params["discardFirmware"]; !ok {
+		params["discardFirmware"] = false // default: keep the downloaded firmware in memory
+	} else if _, ok := params["discardFirmware"].(bool); !ok {
+		return xerrors.Errorf("Invalid input (discardFirmware). Expected: bool")
+	}
+
+	return nil
+}
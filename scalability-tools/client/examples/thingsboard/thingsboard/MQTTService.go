@@ -0,0 +1,279 @@
+package thingsboard
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"hitachienergy/scalability-test-client/templates"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"golang.org/x/xerrors"
+)
+
+const (
+	MQTT_TOPIC_ATTRIBUTES          = "v1/devices/me/attributes"
+	MQTT_TOPIC_ATTRIBUTES_REQUEST  = "v1/devices/me/attributes/request/%d"
+	MQTT_TOPIC_ATTRIBUTES_RESPONSE = "v1/devices/me/attributes/response/"
+	MQTT_TOPIC_TELEMETRY           = "v1/devices/me/telemetry"
+	MQTT_TOPIC_FIRMWARE_REQUEST    = "v2/fw/request/%d/chunk/%d"
+	MQTT_TOPIC_FIRMWARE_RESPONSE   = "v2/fw/response/"
+)
+
+// FirmwareInfoHandler handles the firmware info pushed by the server
+type FirmwareInfoHandler func(fw FirmwareInfo)
+
+type MQTTService struct {
+	controller     templates.Controller
+	brokerEndpoint string
+	accessToken    string
+	chunkSize      int
+	qos            byte
+	timeout        time.Duration
+
+	client mqtt.Client
+
+	*sync.Mutex
+	requestID int
+	pending   map[string]chan []byte // response topic -> waiting request
+}
+
+// newMQTTService creates a new MQTTService
+func newMQTTService(controller templates.Controller, brokerEndpoint string, accessToken string, chunkSize int, qos byte, timeout time.Duration) *MQTTService {
+	return &MQTTService{
+		controller:     controller,
+		brokerEndpoint: brokerEndpoint,
+		accessToken:    accessToken,
+		chunkSize:      chunkSize,
+		qos:            qos,
+		timeout:        timeout,
+		Mutex:          &sync.Mutex{},
+		pending:        map[string]chan []byte{},
+	}
+}
+
+// GetID implements CommunicationService.GetID. It returns the access token of the device
+func (s *MQTTService) GetID() string {
+	return s.accessToken
+}
+
+// connect connects the device to the broker and subscribes to the shared attributes and to the responses of the requests.
+// The subscriptions are renewed on every reconnection
+func (s *MQTTService) connect(onFirmwareInfo FirmwareInfoHandler) (err error) {
+	defer func() {
+		s.controller.ReportRequest("tb/mqtt/connect", 0, err)
+	}()
+
+	scheme := "tcp"
+	_, port, splitErr := net.SplitHostPort(s.brokerEndpoint)
+	if splitErr == nil && port == "8883" {
+		scheme = "ssl"
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(fmt.Sprintf("%s://%s", scheme, s.brokerEndpoint)).
+		SetClientID(s.accessToken).
+		SetUsername(s.accessToken).
+		SetTLSConfig(&tls.Config{InsecureSkipVerify: true}).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectTimeout(s.timeout).
+		SetOrderMatters(false)
+	if shaper := s.controller.GetNetwork(); shaper.Enabled() {
+		opts.SetCustomOpenConnectionFn(s.openShapedConnection)
+	}
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		err := s.subscribe(client, onFirmwareInfo)
+		if err != nil {
+			s.controller.GetLogger().Err(err).Send()
+		}
+	})
+
+	s.client = mqtt.NewClient(opts)
+	token := s.client.Connect()
+	if !token.WaitTimeout(s.timeout) {
+		return xerrors.Errorf("Fail to connect to the MQTT broker %s: timeout", s.brokerEndpoint)
+	}
+	if token.Error() != nil {
+		return xerrors.Errorf("Fail to connect to the MQTT broker %s: %w", s.brokerEndpoint, token.Error())
+	}
+	return nil
+}
+
+// openShapedConnection opens the connection to the broker through the shaped link of the device
+func (s *MQTTService) openShapedConnection(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+	conn, err := s.controller.GetNetwork().Dial("tcp", uri.Host)
+	if err != nil || uri.Scheme != "ssl" {
+		return conn, err
+	}
+
+	tlsConn := tls.Client(conn, options.TLSConfig)
+	err = tlsConn.Handshake()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// subscribe subscribes to all the topics used by the device
+func (s *MQTTService) subscribe(client mqtt.Client, onFirmwareInfo FirmwareInfoHandler) error {
+	filters := map[string]byte{
+		MQTT_TOPIC_ATTRIBUTES:                      s.qos,
+		MQTT_TOPIC_ATTRIBUTES_RESPONSE + "+":       s.qos,
+		MQTT_TOPIC_FIRMWARE_RESPONSE + "+/chunk/+": s.qos,
+	}
+	token := client.SubscribeMultiple(filters, func(client mqtt.Client, message mqtt.Message) {
+		if message.Topic() != MQTT_TOPIC_ATTRIBUTES {
+			s.deliverResponse(message.Topic(), message.Payload())
+			return
+		}
+
+		var fw FirmwareInfo
+		err := json.Unmarshal(message.Payload(), &fw)
+		if err != nil {
+			s.controller.GetLogger().Err(err).Send()
+			return
+		}
+		onFirmwareInfo(fw)
+	})
+	if !token.WaitTimeout(s.timeout) {
+		return xerrors.Errorf("Fail to subscribe to the device topics: timeout")
+	}
+	return token.Error()
+}
+
+// disconnect disconnects the device from the broker
+func (s *MQTTService) disconnect() {
+	if s.client != nil && s.client.IsConnected() {
+		s.client.Disconnect(250)
+	}
+}
+
+// deliverResponse hands the payload of a response over to the request waiting for it
+func (s *MQTTService) deliverResponse(topic string, payload []byte) {
+	s.Lock()
+	responseChann, ok := s.pending[topic]
+	delete(s.pending, topic)
+	s.Unlock()
+
+	if ok {
+		responseChann <- payload
+	}
+}
+
+// request publishes a request and waits for the message published by the server on the response topic
+func (s *MQTTService) request(endpoint string, requestTopic string, responseTopic string, payload []byte) (response []byte, err error) {
+	defer func() {
+		s.controller.ReportRequest(endpoint, 0, err)
+	}()
+
+	responseChann := make(chan []byte, 1)
+	s.Lock()
+	s.pending[responseTopic] = responseChann
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.pending, responseTopic)
+		s.Unlock()
+	}()
+
+	err = s.publish(requestTopic, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case response = <-responseChann:
+		return response, nil
+	case <-time.After(s.timeout):
+		return nil, xerrors.Errorf("No response received on %s", responseTopic)
+	}
+}
+
+// publish publishes a message and waits for its delivery to the broker
+func (s *MQTTService) publish(topic string, payload []byte) error {
+	token := s.client.Publish(topic, s.qos, false, payload)
+	if !token.WaitTimeout(s.timeout) {
+		return xerrors.Errorf("Fail to publish to %s: timeout", topic)
+	}
+	return token.Error()
+}
+
+// nextRequestID returns a new identifier for a request of the device
+func (s *MQTTService) nextRequestID() int {
+	s.Lock()
+	defer s.Unlock()
+
+	s.requestID += 1
+	return s.requestID
+}
+
+// getFirmwareInfo requests the firmware info to the server
+func (s *MQTTService) getFirmwareInfo() (info *FirmwareInfo, err error) {
+	payload, err := json.Marshal(map[string]string{"sharedKeys": FIRMWARE_SHARED_KEYS})
+	if err != nil {
+		return nil, err
+	}
+
+	id := s.nextRequestID()
+	response, err := s.request("tb/mqtt/attributes",
+		fmt.Sprintf(MQTT_TOPIC_ATTRIBUTES_REQUEST, id),
+		MQTT_TOPIC_ATTRIBUTES_RESPONSE+strconv.Itoa(id),
+		payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var data HTTPAttributes
+	err = json.Unmarshal(response, &data)
+	if err != nil {
+		return nil, err
+	}
+	return &data.Shared, nil
+}
+
+// GetFirmware implements CommunicationService.GetFirmware. It downloads the firmware chunk by chunk, from the last received chunk.
+// The download ends with the expected size, or with the first chunk shorter than the chunk size if the size is unknown
+func (s *MQTTService) GetFirmware(fwinfo FirmwareInfo, download *firmwareDownload) (err error) {
+	id := s.nextRequestID()
+	size := int64(fwinfo.Size)
+	chunkSize := []byte(strconv.Itoa(s.chunkSize))
+
+	for chunk := download.nextChunk; size <= 0 || download.size < size; chunk++ {
+		response, err := s.request("tb/mqtt/firmware",
+			fmt.Sprintf(MQTT_TOPIC_FIRMWARE_REQUEST, id, chunk),
+			fmt.Sprintf("%s%d/chunk/%d", MQTT_TOPIC_FIRMWARE_RESPONSE, id, chunk),
+			chunkSize)
+		if err != nil {
+			return err
+		}
+		download.Write(response)
+		download.nextChunk = chunk + 1
+		if len(response) < s.chunkSize {
+			break
+		}
+	}
+
+	if size > 0 && download.size != size {
+		return xerrors.Errorf("Fail to get firmware. Received %d bytes (Expected: %d)", download.size, size)
+	}
+	return nil
+}
+
+// ReportUpdateState implements CommunicationService.ReportUpdateState. It publishes the update state as telemetry
+func (s *MQTTService) ReportUpdateState(state FWUpdateState) (err error) {
+	defer func() {
+		s.controller.ReportRequest("tb/mqtt/telemetry", 0, err)
+	}()
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.publish(MQTT_TOPIC_TELEMETRY, payload)
+}
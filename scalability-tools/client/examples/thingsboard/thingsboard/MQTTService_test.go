@@ -0,0 +1,272 @@
+package thingsboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates/templatestest"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// mqttTimeout is the timeout of the MQTT requests of the device, short enough to test the lost responses
+const mqttTimeout = 300 * time.Millisecond
+
+// mqttBroker is a minimal in-process MQTT broker answering the device as ThingsBoard does: the attributes and firmware
+// chunk requests are answered on their response topics, without topic matching as it serves a single device
+type mqttBroker struct {
+	listener net.Listener
+	firmware []byte
+	info     FirmwareInfo
+	stray    bool             // a response to another request is published before every firmware chunk
+	drop     func(n int) bool // the nth chunk request (from 0) is not answered
+
+	sync.Mutex
+	chunks []int // chunks requested by the device, in order
+}
+
+// startMQTTBroker serves the firmware on a local port until the end of the test. The firmware info announces size bytes
+func startMQTTBroker(t *testing.T, firmware []byte, size int) *mqttBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	checksum, _ := Checksum(SHA256, firmware)
+	broker := &mqttBroker{
+		listener: listener,
+		firmware: firmware,
+		info:     FirmwareInfo{Title: "firmware", Version: "1.0.0", ChecksumAlg: SHA256, Checksum: checksum, Size: float64(size)},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn)
+		}
+	}()
+	return broker
+}
+
+// requestedChunks returns the chunks requested by the device, in order
+func (b *mqttBroker) requestedChunks() []int {
+	b.Lock()
+	defer b.Unlock()
+	return append([]int{}, b.chunks...)
+}
+
+// serve handles the packets of a client until it disconnects
+func (b *mqttBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			err = packets.NewControlPacket(packets.Connack).Write(conn)
+		case *packets.SubscribePacket:
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = p.MessageID
+			suback.ReturnCodes = p.Qoss
+			err = suback.Write(conn)
+		case *packets.PingreqPacket:
+			err = packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.PublishPacket:
+			if p.Qos > 0 {
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				err = puback.Write(conn)
+			}
+			if err == nil {
+				err = b.handleRequest(conn, p.TopicName, p.Payload)
+			}
+		case *packets.DisconnectPacket:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handleRequest answers the attributes and firmware chunk requests. The telemetry is ignored
+func (b *mqttBroker) handleRequest(conn net.Conn, topic string, payload []byte) error {
+	if id, ok := strings.CutPrefix(topic, "v1/devices/me/attributes/request/"); ok {
+		response, _ := json.Marshal(HTTPAttributes{Shared: b.info})
+		return publishMQTT(conn, MQTT_TOPIC_ATTRIBUTES_RESPONSE+id, response)
+	}
+
+	var id, chunk int
+	if _, err := fmt.Sscanf(topic, MQTT_TOPIC_FIRMWARE_REQUEST, &id, &chunk); err != nil {
+		return nil
+	}
+	chunkSize, _ := strconv.Atoi(string(payload))
+	b.Lock()
+	n := len(b.chunks)
+	b.chunks = append(b.chunks, chunk)
+	b.Unlock()
+	if b.drop != nil && b.drop(n) {
+		return nil
+	}
+
+	if b.stray {
+		// the garbage fails the checksum if it is taken for the requested chunk
+		err := publishMQTT(conn, fmt.Sprintf("%s%d/chunk/%d", MQTT_TOPIC_FIRMWARE_RESPONSE, id+1, chunk), []byte("garbage"))
+		if err != nil {
+			return err
+		}
+	}
+	start, end := chunk*chunkSize, (chunk+1)*chunkSize
+	if start > len(b.firmware) {
+		start = len(b.firmware)
+	}
+	if end > len(b.firmware) {
+		end = len(b.firmware)
+	}
+	return publishMQTT(conn, fmt.Sprintf("%s%d/chunk/%d", MQTT_TOPIC_FIRMWARE_RESPONSE, id, chunk), b.firmware[start:end])
+}
+
+// publishMQTT publishes a message to the client with QoS 0
+func publishMQTT(conn net.Conn, topic string, payload []byte) error {
+	publish := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	publish.TopicName = topic
+	publish.Payload = payload
+	return publish.Write(conn)
+}
+
+// connectMQTTService connects a device to the broker with the given chunk size
+func connectMQTTService(t *testing.T, broker *mqttBroker, chunkSize int) *MQTTService {
+	controller := templatestest.NewController("mqtt0", 0, fault.UpdateOutcome{})
+	service := newMQTTService(controller, broker.listener.Addr().String(), "mqtt0", chunkSize, 1, mqttTimeout)
+	if err := service.connect(func(FirmwareInfo) {}); err != nil {
+		t.Fatalf("connect: %s", err)
+	}
+	t.Cleanup(func() {
+		service.disconnect()
+		controller.Release()
+	})
+	return service
+}
+
+// testFirmware returns a firmware of the given size
+func testFirmware(size int) []byte {
+	firmware := make([]byte, size)
+	for i := range firmware {
+		firmware[i] = byte(i % 251)
+	}
+	return firmware
+}
+
+// checkFirmware checks that the whole firmware was received
+func checkFirmware(t *testing.T, broker *mqttBroker, download *firmwareDownload) {
+	t.Helper()
+	if !bytes.Equal(download.data, broker.firmware) {
+		t.Errorf("got %d bytes, want the %d bytes of the firmware", len(download.data), len(broker.firmware))
+	}
+	if checksum, _ := download.checksum(); checksum != broker.info.Checksum {
+		t.Errorf("got checksum %s, want %s", checksum, broker.info.Checksum)
+	}
+}
+
+func TestMQTTGetFirmware(t *testing.T) {
+	tests := []struct {
+		name     string
+		firmware int
+		size     int // size announced in the firmware info, 0 if unknown
+		stray    bool
+		chunks   []int
+	}{
+		{"size bound", 4096, 4096, false, []int{0, 1, 2, 3}}, // no request for an empty chunk
+		{"partial last chunk", 4000, 4000, false, []int{0, 1, 2, 3}},
+		{"unknown size", 4096, 0, false, []int{0, 1, 2, 3, 4}}, // the empty chunk ends the download
+		{"unknown size and partial last chunk", 4000, 0, false, []int{0, 1, 2, 3}},
+		{"responses to other requests", 4000, 4000, true, []int{0, 1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := startMQTTBroker(t, testFirmware(test.firmware), test.size)
+			broker.stray = test.stray
+			service := connectMQTTService(t, broker, 1024)
+
+			info, err := service.getFirmwareInfo()
+			if err != nil {
+				t.Fatalf("getFirmwareInfo: %s", err)
+			}
+			if *info != broker.info {
+				t.Errorf("got firmware info %+v, want %+v", *info, broker.info)
+			}
+
+			download := newFirmwareDownload(*info, true, nil)
+			if err := service.GetFirmware(*info, download); err != nil {
+				t.Fatalf("GetFirmware: %s", err)
+			}
+			checkFirmware(t, broker, download)
+			if chunks := broker.requestedChunks(); !reflect.DeepEqual(chunks, test.chunks) {
+				t.Errorf("got requested chunks %v, want %v", chunks, test.chunks)
+			}
+			if download.nextChunk != len(test.chunks) {
+				t.Errorf("got next chunk %d, want %d", download.nextChunk, len(test.chunks))
+			}
+			service.Lock()
+			pending := len(service.pending)
+			service.Unlock()
+			if pending != 0 {
+				t.Errorf("got %d pending requests after the download, want 0", pending)
+			}
+		})
+	}
+}
+
+func TestMQTTGetFirmwareResume(t *testing.T) {
+	broker := startMQTTBroker(t, testFirmware(4000), 4000)
+	broker.drop = func(n int) bool { return n == 2 } // the first request of chunk 2 is lost
+	service := connectMQTTService(t, broker, 1024)
+
+	download := newFirmwareDownload(broker.info, true, nil)
+	if err := service.GetFirmware(broker.info, download); err == nil {
+		t.Fatal("GetFirmware: got no error, want the timeout of chunk 2")
+	}
+	if download.size != 2048 || download.nextChunk != 2 {
+		t.Errorf("got %d bytes and next chunk %d after the timeout, want 2048 bytes and next chunk 2", download.size, download.nextChunk)
+	}
+
+	// the download resumes from the missing chunk
+	if err := service.GetFirmware(broker.info, download); err != nil {
+		t.Fatalf("GetFirmware after the timeout: %s", err)
+	}
+	checkFirmware(t, broker, download)
+	if chunks := broker.requestedChunks(); !reflect.DeepEqual(chunks, []int{0, 1, 2, 2, 3}) {
+		t.Errorf("got requested chunks %v, want [0 1 2 2 3]", chunks)
+	}
+}
+
+func TestMQTTGetFirmwareTruncated(t *testing.T) {
+	// the server has fewer bytes than announced: the short chunk ends the download before the expected size
+	broker := startMQTTBroker(t, testFirmware(3000), 4096)
+	service := connectMQTTService(t, broker, 1024)
+
+	download := newFirmwareDownload(broker.info, true, nil)
+	err := service.GetFirmware(broker.info, download)
+	if err == nil || !strings.Contains(err.Error(), "Received 3000 bytes (Expected: 4096)") {
+		t.Errorf("GetFirmware: got error %v, want the size mismatch", err)
+	}
+	if chunks := broker.requestedChunks(); !reflect.DeepEqual(chunks, []int{0, 1, 2}) {
+		t.Errorf("got requested chunks %v, want [0 1 2]", chunks)
+	}
+}
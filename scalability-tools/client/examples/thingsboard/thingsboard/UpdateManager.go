@@ -5,17 +5,20 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
-	"fmt"
+	"hash"
 	"hash/crc32"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/spaolacci/murmur3"
 	"golang.org/x/xerrors"
 )
 
 type CommunicationService interface {
-	GetFirmware(fwinfo FirmwareInfo) (data []byte, err error)
+	GetFirmware(fwinfo FirmwareInfo, download *firmwareDownload) (err error)
 	ReportUpdateState(state FWUpdateState) (err error)
 	GetID() string
 }
@@ -28,18 +31,23 @@ type UpdateModule interface {
 
 type UpdateManager struct {
 	UpdateModule
-	*HTTPClient
+	CommunicationService
+	controller templates.Controller
 	*sync.RWMutex
 
-	currFW     FWUpdateState
-	isUpdating bool
+	currFW       FWUpdateState
+	isUpdating   bool
+	keepFirmware bool
 }
 
-// newUpdateManager creates an instance of updatemanager
-func newUpdateManager(c *HTTPClient) *UpdateManager {
+// newUpdateManager creates an instance of updatemanager on top of the transport specific communication service.
+// The downloaded firmwares are only hashed and counted if they are discarded
+func newUpdateManager(controller templates.Controller, service CommunicationService, discardFirmware bool) *UpdateManager {
 	return &UpdateManager{
-		HTTPClient: c,
-		RWMutex:    &sync.RWMutex{},
+		CommunicationService: service,
+		controller:           controller,
+		RWMutex:              &sync.RWMutex{},
+		keepFirmware:         !discardFirmware,
 	}
 }
 
@@ -69,52 +77,73 @@ func (u *UpdateManager) ReportCurrState() error {
 	state := u.currFW
 	u.RUnlock()
 
-	return u.reportUpdateState(state)
+	return u.ReportUpdateState(state)
 }
 
 // StartUpdate implements UpdateModule.StartUpdate
 func (u *UpdateManager) StartUpdate(fw FirmwareInfo) (err error) {
 	var updateFw FWUpdateState
 
-	u.HTTPClient.controller.GetLogger().Debug().Msg("Start downloading")
-
 	updateFw = FWUpdateState{
 		Title:   fw.Title,
 		Version: fw.Version,
-		State:   UPDATE_DOWNLOADING,
 	}
-	u.reportUpdateState(updateFw)
+	outcome := u.controller.GetUpdateOutcome()
+	if outcome.Result == fault.OUTCOME_DENIED {
+		// ThingsBoard has no denied state, the device fails the update without downloading it
+		updateFw.Error = "Update denied by the device"
+		u.failUpdate(updateFw)
+		return xerrors.Errorf(updateFw.Error)
+	}
+
+	u.controller.GetLogger().Debug().Msg("Start downloading")
+
+	updateFw.State = UPDATE_DOWNLOADING
+	u.reportPhase(updateFw)
 
-	data, err := u.getFirmware(fw)
+	download := loadDownload(u.controller, fw, u.keepFirmware)
+	err = u.GetFirmware(fw, download)
 	if err != nil {
-		updateFw.State = UPDATE_FAILED
-		u.reportUpdateState(updateFw)
+		// a crashed device resumes the download after its reboot, otherwise the partial download is cleared with the failed task
+		u.controller.KeepState(PARTIAL_DOWNLOAD, download)
+		u.failUpdate(updateFw)
 		return err
 	}
 	updateFw.State = UPDATE_DOWNLOADED
-	u.HTTPClient.controller.GetLogger().Debug().Msg("Finished downloading")
-	u.reportUpdateState(updateFw)
+	u.controller.GetLogger().Debug().Msg("Finished downloading")
+	u.reportPhase(updateFw)
 
-	u.HTTPClient.controller.GetLogger().Debug().Msg("Verify checksum")
+	u.controller.GetLogger().Debug().Msg("Verify checksum")
 
-	err = u.verifyChecksum(fw, data)
+	err = u.verifyChecksum(fw, download)
 	if err != nil {
-		updateFw.State = UPDATE_FAILED
-		u.reportUpdateState(updateFw)
+		u.failUpdate(updateFw)
 		return err
 	}
 	updateFw.State = UPDATE_VERIFIED
-	u.reportUpdateState(updateFw)
+	u.reportPhase(updateFw)
 
-	u.HTTPClient.controller.GetLogger().Debug().Msg("Update")
+	u.controller.GetLogger().Debug().Msg("Update")
 
 	updateFw.State = UPDATE_UPDATING
-	u.reportUpdateState(updateFw)
+	u.reportPhase(updateFw)
 
-	u.HTTPClient.controller.GetLogger().Debug().Msg("Updated")
+	time.Sleep(outcome.InstallDuration)
+	if outcome.Result == fault.OUTCOME_FAILURE {
+		updateFw.Error = "Simulated installation failure"
+		u.failUpdate(updateFw)
+		return xerrors.Errorf(updateFw.Error)
+	}
+	if outcome.Result == fault.OUTCOME_WARNING {
+		// ThingsBoard has no warning state, the update succeeds
+		u.controller.GetLogger().Warn().Msg("Simulated installation warning")
+	}
+	time.Sleep(outcome.RebootDuration)
+
+	u.controller.GetLogger().Debug().Msg("Updated")
 
 	updateFw.State = UPDATE_UPDATED
-	u.reportUpdateState(updateFw)
+	u.reportPhase(updateFw)
 
 	u.Lock()
 	if err == nil {
@@ -128,11 +157,33 @@ func (u *UpdateManager) StartUpdate(fw FirmwareInfo) (err error) {
 	return nil
 }
 
+// failUpdate reports the failure of the update to the server and completes the task as failed
+func (u *UpdateManager) failUpdate(state FWUpdateState) {
+	state.State = UPDATE_FAILED
+	u.reportPhase(state)
+
+	u.Lock()
+	u.isUpdating = false
+	u.Unlock()
+
+	u.controller.CompleteTask(false)
+}
+
+// reportPhase reports the update state to the server and marks the related phase of the task
+func (u *UpdateManager) reportPhase(state FWUpdateState) error {
+	err := u.ReportUpdateState(state)
+	u.controller.MarkPhase(string(state.State))
+	return err
+}
+
 // verifyChecksum verifies the integrity of firmware based on the firmware info
-func (u *UpdateManager) verifyChecksum(fw FirmwareInfo, data []byte) error {
-	if len(data) == 0 {
+func (u *UpdateManager) verifyChecksum(fw FirmwareInfo, download *firmwareDownload) error {
+	if download.size == 0 {
 		return xerrors.Errorf("Empty Firmware data")
 	}
+	if fw.Size > 0 && download.size != int64(fw.Size) {
+		return xerrors.Errorf("Firmware has wrong size (Expected: %d, Got %d)", int64(fw.Size), download.size)
+	}
 	if len(fw.Checksum) == 0 {
 		// if len(fw.ChecksumAlg) == 0 {
 		u.controller.GetLogger().Warn().Msg("No checksum provided")
@@ -141,41 +192,44 @@ func (u *UpdateManager) verifyChecksum(fw FirmwareInfo, data []byte) error {
 		// return xerrors.Errorf("No checksum provided")
 	}
 
-	var hashString string
-	switch fw.ChecksumAlg {
+	hashString, err := download.checksum()
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(hashString, fw.Checksum) {
+		return xerrors.Errorf("Checksume unmatched. Checksum Algo: %s", fw.ChecksumAlg)
+	}
+	return nil
+}
+
+// newChecksumHash creates the hash function of the checksum algorithm
+func newChecksumHash(alg ChecksumAlg) (hash.Hash, error) {
+	switch alg {
 	case SHA256:
-		myhash := sha256.New()
-		myhash.Write(data)
-		hashString = strings.ToLower(hex.EncodeToString(myhash.Sum(nil)))
+		return sha256.New(), nil
 	case SHA348:
-		myhash := sha512.New384()
-		myhash.Write(data)
-		hashString = strings.ToLower(hex.EncodeToString(myhash.Sum(nil)))
+		return sha512.New384(), nil
 	case SHA512:
-		myhash := sha512.New()
-		myhash.Write(data)
-		hashString = strings.ToLower(hex.EncodeToString(myhash.Sum(nil)))
+		return sha512.New(), nil
 	case MD5:
-		myhash := md5.New()
-		myhash.Write(data)
-		hashString = hex.EncodeToString(myhash.Sum(nil))
+		return md5.New(), nil
 	case MURMUR3_32:
 		// TODO: check whether this output matches python mmh3
-		myhash := murmur3.New32()
-		myhash.Write(data)
-		hashString = hex.EncodeToString(myhash.Sum(nil))
+		return murmur3.New32(), nil
 	case MURMUR3_128:
-		myhash := murmur3.New128()
-		myhash.Write(data)
-		hashString = hex.EncodeToString(myhash.Sum(nil))
+		return murmur3.New128(), nil
 	case CRC32:
-		checksum := crc32.ChecksumIEEE(data)
-		hashString = fmt.Sprintf("%08X", checksum)
-	default:
-		return xerrors.Errorf("Unrecognized checksum algorithm: %s", fw.ChecksumAlg)
+		return crc32.NewIEEE(), nil
 	}
-	if !strings.EqualFold(hashString, fw.Checksum) {
-		return xerrors.Errorf("Checksume unmatched. Checksum Algo: %s", fw.ChecksumAlg)
+	return nil, xerrors.Errorf("Unrecognized checksum algorithm: %s", alg)
+}
+
+// Checksum computes the checksum of the data as hexadecimal string, as ThingsBoard expects it in the firmware info
+func Checksum(alg ChecksumAlg, data []byte) (string, error) {
+	myhash, err := newChecksumHash(alg)
+	if err != nil {
+		return "", err
 	}
-	return nil
+	myhash.Write(data)
+	return strings.ToLower(hex.EncodeToString(myhash.Sum(nil))), nil
 }
@@ -0,0 +1,88 @@
+package thingsboard_test
+
+import (
+	"reflect"
+	"testing"
+
+	"hitachienergy/scalability-test-client/examples/thingsboard/tbmock"
+	"hitachienergy/scalability-test-client/examples/thingsboard/thingsboard"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/templates/templatestest"
+)
+
+func TestHTTPUpdateOutcome(t *testing.T) {
+	tests := []struct {
+		name       string
+		outcome    fault.UpdateResult
+		success    bool
+		phases     []string
+		downloaded int64
+	}{
+		{"warning", fault.OUTCOME_WARNING, true, updatePhases, firmwareSize}, // ThingsBoard has no warning state
+		{"failure", fault.OUTCOME_FAILURE, false, []string{"DOWNLOADING", "DOWNLOADED", "VERIFIED", "UPDATING", "FAILED"}, firmwareSize},
+		{"denied", fault.OUTCOME_DENIED, false, []string{"FAILED"}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, endpoint := startTBServer(t, tbmock.TBServerConfig{Seed: 1})
+			controller, err := startHTTPDevice(t, endpoint, "http0", thingsboard.DownloadConfig{}, fault.UpdateOutcome{Result: test.outcome})
+			if err != nil {
+				t.Fatalf("Start: %s", err)
+			}
+			templatestest.WaitTask(t, controller, taskTimeout)
+
+			if success, _ := controller.Result(); success != test.success {
+				t.Errorf("got success %t, want %t", success, test.success)
+			}
+			if phases := controller.Phases(); !reflect.DeepEqual(phases, test.phases) {
+				t.Errorf("got phases %v, want %v", phases, test.phases)
+			}
+			if device := server.Device("http0"); device.DownloadedBytes != test.downloaded {
+				t.Errorf("got %d downloaded bytes, want %d", device.DownloadedBytes, test.downloaded)
+			}
+			// the failed devices do not reach the UPDATED state
+			if failures := server.VerifyAll(); (len(failures) == 0) != test.success {
+				t.Errorf("VerifyAll: got %v, want failures %t", failures, !test.success)
+			}
+		})
+	}
+}
+
+func TestCoAPUpdateOutcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcome  fault.UpdateResult
+		success  bool
+		phases   []string
+		requests bool // the firmware is requested
+	}{
+		{"warning", fault.OUTCOME_WARNING, true, updatePhases, true},
+		{"failure", fault.OUTCOME_FAILURE, false, []string{"DOWNLOADING", "DOWNLOADED", "VERIFIED", "UPDATING", "FAILED"}, true},
+		{"denied", fault.OUTCOME_DENIED, false, []string{"FAILED"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, endpoint := startCoAPServer(t, tbmock.TBServerConfig{Seed: 1})
+			controller, err := startCoAPDevice(t, endpoint, "coap0", 1024, fault.UpdateOutcome{Result: test.outcome})
+			if err != nil {
+				t.Fatalf("Start: %s", err)
+			}
+			templatestest.WaitTask(t, controller, taskTimeout)
+
+			if success, _ := controller.Result(); success != test.success {
+				t.Errorf("got success %t, want %t", success, test.success)
+			}
+			if phases := controller.Phases(); !reflect.DeepEqual(phases, test.phases) {
+				t.Errorf("got phases %v, want %v", phases, test.phases)
+			}
+			if device := server.Device("coap0"); (device.FirmwareRequests > 0) != test.requests {
+				t.Errorf("got %d firmware requests, want requested %t", device.FirmwareRequests, test.requests)
+			}
+			if failures := server.VerifyAll(); (len(failures) == 0) != test.success {
+				t.Errorf("VerifyAll: got %v, want failures %t", failures, !test.success)
+			}
+		})
+	}
+}
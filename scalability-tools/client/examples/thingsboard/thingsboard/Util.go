@@ -1,6 +1,9 @@
 package thingsboard
 
-import "strings"
+import (
+	"net/http"
+	"strings"
+)
 
 var FIRMWARE_SHARED_KEYS = strings.Join([]string{
 	"fw_checksum_algorithm",
@@ -44,6 +47,11 @@ type FWUpdateState struct {
 	Title   string      `json:"current_fw_title"`
 	Version string      `json:"current_fw_version"`
 	State   UpdateState `json:"fw_state"`
+	Error   string      `json:"fw_error,omitempty"`
+}
+
+type FWDownloadProgress struct {
+	Progress float64 `json:"fw_download_progress"`
 }
 
 // ---------------------- HTTP ----------------------
@@ -52,3 +60,11 @@ type HTTPAttributes struct {
 	Client map[string]interface{} `json:"client"`
 	Shared FirmwareInfo           `json:"shared"`
 }
+
+// statusCode returns the status code of the response, or 0 if no response was received
+func statusCode(res *http.Response) int {
+	if res == nil {
+		return 0
+	}
+	return res.StatusCode
+}
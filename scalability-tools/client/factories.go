@@ -0,0 +1,8 @@
+package main
+
+// Device factories statically linked in the simulator. They register themselves in the factory registry.
+// Factories that are not listed here can still be loaded as a Go plugin through ".client.template"
+import (
+	_ "hitachienergy/scalability-test-client/examples/hawkbit/hawkbit"
+	_ "hitachienergy/scalability-test-client/examples/thingsboard/thingsboard"
+)
@@ -0,0 +1,57 @@
+package fault
+
+/*
+A Download fault alters the bytes received by a device, so that the integrity checks of the update fail
+and the device reports the failure to the platform. The fault is applied at the middle of the expected file,
+whatever the way the file is downloaded (single request, chunks, resumed download).
+*/
+
+type DownloadMode string
+
+const (
+	CORRUPT  DownloadMode = "corrupt"  // a byte of the file is altered, the size is right but the hash is wrong
+	TRUNCATE DownloadMode = "truncate" // the second half of the file is lost
+)
+
+// Download is the download fault of a device. A nil Download does not alter anything
+type Download struct {
+	Mode DownloadMode
+}
+
+// NewDownload creates a new download fault
+func NewDownload(mode DownloadMode) *Download {
+	return &Download{Mode: mode}
+}
+
+// Enabled checks whether the downloads of the device are altered
+func (d *Download) Enabled() bool {
+	return d != nil && len(d.Mode) > 0
+}
+
+// Apply alters the bytes p received at the given offset of a file of the given size. It returns the bytes to keep.
+// p itself is never modified
+func (d *Download) Apply(p []byte, offset int64, size int64) []byte {
+	if !d.Enabled() || size <= 0 {
+		return p
+	}
+
+	cut := size / 2
+	end := offset + int64(len(p))
+	switch d.Mode {
+	case CORRUPT:
+		if offset <= cut && cut < end {
+			corrupted := make([]byte, len(p))
+			copy(corrupted, p)
+			corrupted[cut-offset] ^= 0xFF
+			return corrupted
+		}
+	case TRUNCATE:
+		if offset >= cut {
+			return p[:0]
+		}
+		if end > cut {
+			return p[:cut-offset]
+		}
+	}
+	return p
+}
@@ -0,0 +1,69 @@
+package fault
+
+import (
+	"bytes"
+	"testing"
+)
+
+// applyByPieces streams a file of the given size through the fault, by pieces of the given length
+func applyByPieces(d *Download, file []byte, piece int) []byte {
+	received := []byte{}
+	for offset := 0; offset < len(file); offset += piece {
+		end := offset + piece
+		if end > len(file) {
+			end = len(file)
+		}
+		received = append(received, d.Apply(file[offset:end], int64(offset), int64(len(file)))...)
+	}
+	return received
+}
+
+func TestDownloadApply(t *testing.T) {
+	file := make([]byte, 1000)
+	for i := range file {
+		file[i] = byte(i)
+	}
+	corrupted := append([]byte{}, file...)
+	corrupted[500] ^= 0xFF
+
+	tests := []struct {
+		name  string
+		fault *Download
+		piece int
+		want  []byte
+	}{
+		{"no fault", nil, 100, file},
+		{"no mode", NewDownload(""), 100, file},
+		{"corrupt single piece", NewDownload(CORRUPT), 1000, corrupted},
+		{"corrupt at piece start", NewDownload(CORRUPT), 100, corrupted},
+		{"corrupt at piece end", NewDownload(CORRUPT), 167, corrupted}, // the byte 500 ends the third piece
+		{"corrupt within a piece", NewDownload(CORRUPT), 300, corrupted},
+		{"truncate single piece", NewDownload(TRUNCATE), 1000, file[:500]},
+		{"truncate at piece start", NewDownload(TRUNCATE), 100, file[:500]},
+		{"truncate within a piece", NewDownload(TRUNCATE), 300, file[:500]},
+		{"truncate by bytes", NewDownload(TRUNCATE), 1, file[:500]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := append([]byte{}, file...)
+			got := applyByPieces(test.fault, file, test.piece)
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("got %d bytes, want %d bytes altered at the middle of the file", len(got), len(test.want))
+			}
+			if !bytes.Equal(file, original) {
+				t.Error("got the received bytes modified, want them unchanged")
+			}
+		})
+	}
+}
+
+func TestDownloadApplyUnknownSize(t *testing.T) {
+	// without the expected size, the middle of the file is unknown: nothing is altered
+	p := []byte("firmware")
+	for _, mode := range []DownloadMode{CORRUPT, TRUNCATE} {
+		if got := NewDownload(mode).Apply(p, 0, 0); !bytes.Equal(got, p) {
+			t.Errorf("%s: got %q, want %q", mode, got, p)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package fault
+
+import "time"
+
+type UpdateResult string
+
+const (
+	OUTCOME_SUCCESS UpdateResult = ""        // the update is installed
+	OUTCOME_WARNING UpdateResult = "warning" // the update is installed, but the device reports a warning
+	OUTCOME_FAILURE UpdateResult = "failure" // the installation fails after the download
+	OUTCOME_DENIED  UpdateResult = "denied"  // the device denies the update before downloading it
+)
+
+// UpdateOutcome is how an update ends on a device, and how long the device needs to install it and reboot.
+// When the platform asks for the consent of the user, the device confirms or denies the update after the confirmation delay.
+// The zero value is a successful update without installation time
+type UpdateOutcome struct {
+	Result            UpdateResult
+	InstallDuration   time.Duration
+	RebootDuration    time.Duration
+	ConfirmationDelay time.Duration
+	DenyConfirmation  bool // the user denies the update when asked for consent
+}
+
+// String returns the name of the result of the update
+func (r UpdateResult) String() string {
+	if r == OUTCOME_SUCCESS {
+		return "success"
+	}
+	return string(r)
+}
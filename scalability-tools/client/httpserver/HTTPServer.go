@@ -11,8 +11,8 @@ import (
 	"github.com/rs/zerolog"
 )
 
-// MainHttp starts the HTTP Server
-func MainHttp(port uint, logger *zerolog.Logger, simulator *simulation.Simulator, connectChan chan struct{}, stopChan chan struct{}) *http.Server {
+// MainHttp starts the HTTP Server. finalChan is notified once the final statistics of the simulation are read
+func MainHttp(port uint, logger *zerolog.Logger, simulator *simulation.Simulator, connectChan chan struct{}, stopChan chan struct{}, finalChan chan struct{}) *http.Server {
 	mux := http.NewServeMux()
 	mux.Handle("/", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
@@ -22,7 +22,9 @@ func MainHttp(port uint, logger *zerolog.Logger, simulator *simulation.Simulator
 	mux.Handle("/ready", getReadyStateHandler(simulator))
 	mux.Handle("/start", startDevicesHandler(connectChan))
 	mux.Handle("/connected", getConnectedStateHandler(simulator))
-	mux.Handle("/stats", getSimulationProcessHandler(simulator))
+	mux.Handle("/stats", getSimulationProcessHandler(simulator, finalChan))
+	mux.Handle("/stats/connect", getConnectStatsHandler(simulator))
+	mux.Handle("/metrics", getMetricsHandler(simulator))
 	mux.Handle("/stop", stopHandler(stopChan))
 
 	server := &http.Server{
@@ -39,15 +41,52 @@ func MainHttp(port uint, logger *zerolog.Logger, simulator *simulation.Simulator
 	return server
 }
 
-// getSimulationProcessHandler is a url handler that returns the in-time statistics of the simulation process
-func getSimulationProcessHandler(simulator *simulation.Simulator) http.HandlerFunc {
+// getSimulationProcessHandler is a url handler that returns the in-time statistics of the simulation process.
+// Once the assertions are evaluated, the statistics are final and their delivery is notified to finalChan
+func getSimulationProcessHandler(simulator *simulation.Simulator, finalChan chan struct{}) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !simulator.IsReady() {
+			w.WriteHeader(503)
+			return
+		}
+		final := simulator.IsEvaluated()
 		stats := simulator.GetProcess()
 		json, _ := json.Marshal(stats)
+		_, err := w.Write(json)
+		if final && err == nil {
+			select {
+			case finalChan <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// getConnectStatsHandler is a url handler that returns the in-time statistics of the devices connection
+func getConnectStatsHandler(simulator *simulation.Simulator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !simulator.IsReady() {
+			w.WriteHeader(503)
+			return
+		}
+		stats := simulator.GetConnectStats()
+		json, _ := json.Marshal(stats)
 		w.Write(json)
 	}
 }
 
+// getMetricsHandler is a url handler that returns the in-time statistics of the simulation in the OpenMetrics text format
+func getMetricsHandler(simulator *simulation.Simulator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !simulator.IsReady() {
+			w.WriteHeader(503)
+			return
+		}
+		w.Header().Set("Content-Type", simulation.MetricsContentType)
+		simulator.WriteMetrics(w)
+	}
+}
+
 // getReadyStateHandler is a url handler that will only return '200 OK' after all devices are reigstered to the server
 func getReadyStateHandler(simulator *simulation.Simulator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
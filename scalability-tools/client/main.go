@@ -19,10 +19,24 @@ import (
 )
 
 const ANALYSIS_FILENAME = "simulator_analysis.txt"
+const CONNECT_ANALYSIS_FILENAME = "simulator_connect_analysis.txt"
 const DEFAULT_OUTPUT_FOLDER = "device-simulator"
+const ASSERTIONS_FAILED_EXIT_CODE = 2
+const DEFAULT_GRACE_PERIOD = 5 // seconds, below the timeout of the devices manager to stop the containers
 
 func main() {
 
+	/* ------ run mock platforms if requested ------ */
+
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+		log := zerolog.New(output).With().Timestamp().Str("object", "mock").Logger()
+		if !runMockCommand(os.Args[1], os.Args[2:], &log) {
+			log.Fatal().Msgf("Unknown command %s", os.Args[1])
+		}
+		return
+	}
+
 	/* ------ parse input parameters ------ */
 
 	var configData string
@@ -39,6 +53,8 @@ func main() {
 	flag.StringVar(&influence, "influence", "{}", "simulation influnce range (optional)")
 	var serverPort int
 	flag.IntVar(&serverPort, "serverport", 8086, "overwritten port of the simulator's status server (optional)")
+	var gracePeriod int
+	flag.IntVar(&gracePeriod, "graceperiod", DEFAULT_GRACE_PERIOD, "seconds the status server waits for the final stats to be read (optional)")
 	flag.Parse()
 
 	/* ------ setup simulation variables ------ */
@@ -87,7 +103,7 @@ func main() {
 	if err != nil {
 		mainlog.Fatal().Err(err)
 	}
-	mainlog.Info().Msgf("Set Simulation Influence Constraints: {dummyWork: %d, crash: %d}", influnceRange.DummyWork, influnceRange.Crash)
+	mainlog.Info().Msgf("Set Simulation Influence Constraints: {dummyWork: %d, crash: %d, disconnect: %d}", influnceRange.DummyWork, influnceRange.Crash, influnceRange.Disconnect)
 
 	/* ------ start simulation ------ */
 
@@ -96,10 +112,11 @@ func main() {
 	simulator := simulation.NewSimulator(simulationConfig, data, log)
 	connectChan := make(chan struct{}, 1)
 	stopChann := make(chan struct{}, 1)
+	finalChann := make(chan struct{}, 1)
 
 	// start HTTP server
 	mainlog.Info().Msgf("Starting Status Server on port: %d", serverPort)
-	server := httpserver.MainHttp(uint(serverPort), &mainlog, simulator, connectChan, stopChann)
+	server := httpserver.MainHttp(uint(serverPort), &mainlog, simulator, connectChan, stopChann, finalChann)
 
 	// create all the elements for devices simulation
 	finishChann := make(chan struct{}, 1)
@@ -113,6 +130,10 @@ func main() {
 	<-connectChan // wait for connection start event sent by the FIST Simulator Manger via HTTP endpoint
 
 	err = simulator.StartDevices()
+	errConnect := simulator.SaveConnectResult(filepath.Join(simulationConfig.Output.Path, CONNECT_ANALYSIS_FILENAME))
+	if errConnect != nil {
+		mainlog.Error().Msgf("Fail to save connection analysis to disk: %s", errConnect)
+	}
 	if err != nil {
 		mainlog.Error().Msgf("Fail to start and connect devices: %s", err)
 		err = simulator.StopDevices()
@@ -122,7 +143,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	mainlog.Info().Msg("All devices registered successfully.")
+	mainlog.Info().Msg("Devices registration completed.")
 
 	/* ------ wait simulation to end ------ */
 
@@ -133,15 +154,28 @@ func main() {
 	case <-stopSignal:
 		mainlog.Info().Msg("System signal detected.")
 	case <-finishChann:
-		mainlog.Info().Msg("Simulation is finished. Saving results to disk...")
-		err := simulator.SaveResult(filepath.Join(simulationConfig.Output.Path, ANALYSIS_FILENAME))
-		if err != nil {
-			mainlog.Error().Msgf("Fail to save analysis to disk: %s", err)
-		}
+		mainlog.Info().Msg("Simulation is finished.")
 	case <-stopChann:
 		mainlog.Info().Msg("Simulation stop event detected.")
 	}
 
+	// unfinished devices count as failed, so that an interrupted run does not pass the assertions
+	passed := simulator.EvaluateAssertions()
+	mainlog.Info().Msg("Saving results to disk...")
+	err = simulator.SaveResult(filepath.Join(simulationConfig.Output.Path, ANALYSIS_FILENAME))
+	if err != nil {
+		mainlog.Error().Msgf("Fail to save analysis to disk: %s", err)
+	}
+
+	// keep serving the final stats and assertions until they are read, or until the devices manager stops the simulator
+	mainlog.Info().Msgf("Waiting for the final stats to be read (at most %ds)...", gracePeriod)
+	select {
+	case <-finalChann:
+	case <-stopSignal:
+	case <-stopChann:
+	case <-time.After(time.Duration(gracePeriod) * time.Second):
+	}
+
 	mainlog.Info().Msg("Stopping simulation...")
 
 	ctxShutDown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -161,5 +195,10 @@ func main() {
 
 	<-time.After(time.Second)
 
+	if !passed {
+		mainlog.Error().Msg("Simulation assertions failed.")
+		os.Exit(ASSERTIONS_FAILED_EXIT_CODE)
+	}
+
 	mainlog.Info().Msg("Bye bye.")
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hitachienergy/scalability-test-client/examples/hawkbit/ddimock"
+	"hitachienergy/scalability-test-client/examples/hawkbit/hawkbit"
+	"hitachienergy/scalability-test-client/examples/thingsboard/tbmock"
+	"hitachienergy/scalability-test-client/examples/thingsboard/thingsboard"
+
+	"github.com/rs/zerolog"
+)
+
+// runMockCommand starts the built-in mock platform matching the subcommand. It returns false if the subcommand is unknown
+func runMockCommand(command string, args []string, log *zerolog.Logger) bool {
+	switch command {
+	case "mock-ddi":
+		runMockDDI(args, log)
+	case "mock-tb":
+		runMockTB(args, log)
+	default:
+		return false
+	}
+	return true
+}
+
+// runMockDDI starts a fake hawkBit DDI server, e.g. to run the simulator on a laptop
+func runMockDDI(args []string, log *zerolog.Logger) {
+	flags := flag.NewFlagSet("mock-ddi", flag.ExitOnError)
+	port := flags.Int("port", 8080, "port of the mock server")
+	var config ddimock.DDIServerConfig
+	flags.StringVar(&config.Tenant, "tenant", "", "tenant served by the mock (all tenants if empty)")
+	flags.Int64Var(&config.ArtifactSize, "artifactSize", 1024*1024, "size of the deployed artifact in bytes")
+	flags.StringVar(&config.PollingSleep, "sleep", "00:00:30", "polling interval advertised to the devices (HH:MM:SS)")
+	flags.DurationVar(&config.Latency, "latency", 0, "delay added to every response")
+	flags.Float64Var(&config.ErrorRate, "errorRate", 0, "probability (0-1) of answering a request with an error")
+	flags.IntVar(&config.ErrorCode, "errorCode", 503, "status code of the injected errors")
+	flags.Int64Var(&config.Seed, "seed", 0, "seed of the artifact generation and errors injection")
+	flags.BoolVar(&config.Confirmation, "confirmation", false, "actions wait for the consent of the devices (user consent flow)")
+	flags.Float64Var(&config.CancelRate, "cancelRate", 0, "probability (0-1) that the action of a device is cancelled")
+	flags.DurationVar(&config.CancelAfter, "cancelAfter", 0, "delay between the first poll of a device and the cancellation of its action")
+	flags.StringVar(&config.Download, "download", "forced", "download handling of the deployments (skip, attempt or forced)")
+	flags.StringVar(&config.Update, "update", "forced", "update handling of the deployments (skip, attempt or forced)")
+	flags.DurationVar(&config.WindowPeriod, "windowPeriod", 0, "period of the maintenance window (no maintenance window if 0)")
+	flags.DurationVar(&config.WindowLength, "windowLength", 0, "time during which the maintenance window is available in each period")
+	flags.StringVar(&config.GatewayToken, "gatewayToken", "", "accepted gateway token (no authentication if neither gatewayToken nor targetTokens)")
+	targetTokens := flags.String("targetTokens", "", "file of the accepted target tokens, one controllerId,token per line")
+	flags.BoolVar(&config.Anonymous, "anonymous", false, "accept requests without credentials")
+	flags.BoolVar(&config.AnonymousDownload, "anonymousDownload", false, "accept artifact downloads without credentials")
+	flags.Parse(args)
+
+	if len(*targetTokens) > 0 {
+		tokens, err := hawkbit.LoadTargetTokens(*targetTokens)
+		if err != nil {
+			log.Fatal().Msgf("Cannot load the target tokens: %s", err)
+		}
+		config.TargetTokens = tokens
+	}
+
+	log.Info().Msgf("Starting mock hawkBit DDI server on port %d (artifact: %d bytes, latency: %s, error rate: %.2f, confirmation: %t)",
+		*port, config.ArtifactSize, config.Latency, config.ErrorRate, config.Confirmation)
+	err := ddimock.NewDDIServer(config).ListenAndServe(fmt.Sprintf(":%d", *port))
+	if err != nil {
+		log.Fatal().Msgf("Mock server stopped: %s", err)
+	}
+}
+
+// runMockTB starts a fake ThingsBoard device HTTP API server, e.g. to run the simulator on a laptop
+func runMockTB(args []string, log *zerolog.Logger) {
+	flags := flag.NewFlagSet("mock-tb", flag.ExitOnError)
+	port := flags.Int("port", 8080, "port of the mock server")
+	coapPort := flags.Int("coapPort", 0, "UDP port of the CoAP device API (disabled if 0)")
+	var config tbmock.TBServerConfig
+	var checksumAlg string
+	flags.StringVar(&config.Title, "title", "simulated-firmware", "firmware title shared with the devices")
+	flags.StringVar(&config.Version, "version", "1.0.0", "firmware version shared with the devices")
+	flags.Int64Var(&config.FirmwareSize, "firmwareSize", 1024*1024, "size of the firmware in bytes")
+	flags.StringVar(&checksumAlg, "checksumAlg", string(thingsboard.SHA256), "checksum algorithm shared with the devices")
+	flags.DurationVar(&config.Latency, "latency", 0, "delay added to every response")
+	flags.Float64Var(&config.ErrorRate, "errorRate", 0, "probability (0-1) of answering a request with an error")
+	flags.IntVar(&config.ErrorCode, "errorCode", 503, "status code of the injected errors")
+	flags.Int64Var(&config.Seed, "seed", 0, "seed of the firmware generation and errors injection")
+	flags.Parse(args)
+	config.ChecksumAlg = thingsboard.ChecksumAlg(checksumAlg)
+
+	server, err := tbmock.NewTBServer(config)
+	if err != nil {
+		log.Fatal().Msgf("Cannot create mock server: %s", err)
+	}
+
+	if *coapPort > 0 {
+		log.Info().Msgf("Starting mock ThingsBoard CoAP API on UDP port %d", *coapPort)
+		go func() {
+			err := server.ListenAndServeCoAP(fmt.Sprintf(":%d", *coapPort))
+			if err != nil {
+				log.Fatal().Msgf("Mock CoAP server stopped: %s", err)
+			}
+		}()
+	}
+
+	log.Info().Msgf("Starting mock ThingsBoard server on port %d (firmware: %d bytes, latency: %s, error rate: %.2f)",
+		*port, config.FirmwareSize, config.Latency, config.ErrorRate)
+	err = server.ListenAndServe(fmt.Sprintf(":%d", *port))
+	if err != nil {
+		log.Fatal().Msgf("Mock server stopped: %s", err)
+	}
+}
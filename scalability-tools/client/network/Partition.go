@@ -0,0 +1,42 @@
+package network
+
+import (
+	"errors"
+)
+
+// ErrDisconnected is returned by the connections of a disconnected device
+var ErrDisconnected = errors.New("device disconnected from the network")
+
+// AllowDisconnection wraps all the connections of the device, even without bandwidth and latency limits,
+// so that they can be dropped by Disconnect. It must be called before the device opens any connection
+func (s *Shaper) AllowDisconnection() {
+	s.faults = true
+}
+
+// Connected checks whether the device has network connectivity. A nil Shaper is always connected
+func (s *Shaper) Connected() bool {
+	return s == nil || !s.disconnected.Load()
+}
+
+// Disconnect cuts the link of the device: the open connections are dropped and new ones are refused until Reconnect
+func (s *Shaper) Disconnect() {
+	if s.disconnected.Swap(true) {
+		return
+	}
+
+	s.connsLock.Lock()
+	conns := make([]*shapedConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.connsLock.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// Reconnect restores the link of the device
+func (s *Shaper) Reconnect() {
+	s.disconnected.Store(false)
+}
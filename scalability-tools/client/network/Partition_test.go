@@ -0,0 +1,105 @@
+package network
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startEchoServer accepts connections and echoes what they receive
+func startEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// echo sends a message on the connection and reads it back
+func echo(conn net.Conn) error {
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := io.ReadFull(conn, make([]byte, 4))
+	return err
+}
+
+func TestShaperDisconnect(t *testing.T) {
+	addr := startEchoServer(t)
+	shaper := NewShaper(Profile{})
+	shaper.AllowDisconnection()
+	if !shaper.Enabled() {
+		t.Fatal("a device that may be disconnected must wrap its connections")
+	}
+
+	conn, err := shaper.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial: %s", err)
+	}
+	defer conn.Close()
+	if err := echo(conn); err != nil {
+		t.Fatalf("echo before the disconnection: %s", err)
+	}
+
+	// a read pending during the disconnection fails as the connection is dropped
+	pending := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		pending <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	shaper.Disconnect()
+	select {
+	case err := <-pending:
+		if err == nil {
+			t.Error("pending read: got no error after the disconnection")
+		}
+	case <-time.After(time.Second):
+		t.Error("pending read not interrupted by the disconnection")
+	}
+
+	if shaper.Connected() {
+		t.Error("shaper connected after Disconnect")
+	}
+	if err := echo(conn); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("echo on a dropped connection: got %v, want %s", err, ErrDisconnected)
+	}
+	if _, err := shaper.Dial("tcp", addr); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("Dial while disconnected: got %v, want %s", err, ErrDisconnected)
+	}
+	shaper.connsLock.Lock()
+	open := len(shaper.conns)
+	shaper.connsLock.Unlock()
+	if open != 0 {
+		t.Errorf("got %d open connections after Disconnect, want 0", open)
+	}
+
+	shaper.Reconnect()
+	if !shaper.Connected() {
+		t.Error("shaper disconnected after Reconnect")
+	}
+	conn, err = shaper.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial after Reconnect: %s", err)
+	}
+	defer conn.Close()
+	if err := echo(conn); err != nil {
+		t.Errorf("echo after Reconnect: %s", err)
+	}
+}
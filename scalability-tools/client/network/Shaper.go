@@ -0,0 +1,188 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Network shaping through docker-tc applies to a whole container, so all the devices of a simulator share the same link.
+A Shaper limits the link of a single device instead: every connection opened by the device is wrapped,
+and the bandwidth is shared by all the connections of the device through token buckets.
+Only connection-oriented transports (HTTP, AMQP, MQTT) can be shaped.
+
+A Shaper also simulates the network partitions of the device: while disconnected, the open connections are dropped
+and new ones are refused. Connectionless transports (CoAP) must check Connected before sending a message.
+*/
+
+// DIAL_TIMEOUT is the timeout of the connection establishment of a shaped connection
+const DIAL_TIMEOUT = 30 * time.Second
+
+// Profile represents the link of a device. Zero values mean no limit
+type Profile struct {
+	Downlink float64       // bytes per second received by the device
+	Uplink   float64       // bytes per second sent by the device
+	Latency  time.Duration // round trip time added to the connection establishment and to every response
+}
+
+// Shaper applies the network profile of a device to its connections. A nil Shaper does not shape anything
+type Shaper struct {
+	profile  Profile
+	downlink *tokenBucket
+	uplink   *tokenBucket
+
+	httpClientOnce sync.Once
+	httpClient     *http.Client
+
+	faults       bool // the device may be disconnected, all its connections are wrapped
+	disconnected atomic.Bool
+	connsLock    sync.Mutex
+	conns        map[*shapedConn]struct{}
+}
+
+// NewShaper creates a new Shaper for a single device
+func NewShaper(profile Profile) *Shaper {
+	return &Shaper{
+		profile:  profile,
+		downlink: newTokenBucket(profile.Downlink),
+		uplink:   newTokenBucket(profile.Uplink),
+		conns:    map[*shapedConn]struct{}{},
+	}
+}
+
+// Enabled checks whether the profile limits the link of the device, or whether the device may be disconnected
+func (s *Shaper) Enabled() bool {
+	return s != nil && (s.profile.Downlink > 0 || s.profile.Uplink > 0 || s.profile.Latency > 0 || s.faults)
+}
+
+// Profile returns the network profile of the device
+func (s *Shaper) Profile() Profile {
+	if s == nil {
+		return Profile{}
+	}
+	return s.profile
+}
+
+// Wrap shapes an established connection
+func (s *Shaper) Wrap(conn net.Conn) net.Conn {
+	if !s.Enabled() {
+		return conn
+	}
+	shaped := &shapedConn{Conn: conn, shaper: s}
+	s.connsLock.Lock()
+	s.conns[shaped] = struct{}{}
+	s.connsLock.Unlock()
+	return shaped
+}
+
+// DialContext opens a shaped connection. It can be used as dial function of an http.Transport
+func (s *Shaper) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	if !s.Connected() {
+		return nil, ErrDisconnected
+	}
+	dialer := &net.Dialer{Timeout: DIAL_TIMEOUT}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.Enabled() && s.profile.Latency > 0 {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(s.profile.Latency):
+		}
+	}
+	return s.Wrap(conn), nil
+}
+
+// Dial opens a shaped connection. It can be used as dial function of an AMQP connection
+func (s *Shaper) Dial(network string, addr string) (net.Conn, error) {
+	return s.DialContext(context.Background(), network, addr)
+}
+
+// HTTPClient returns the HTTP client of the device. All its connections are shaped
+func (s *Shaper) HTTPClient() *http.Client {
+	s.httpClientOnce.Do(func() {
+		s.httpClient = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				DialContext:     s.DialContext,
+			},
+		}
+	})
+	return s.httpClient
+}
+
+// shapedConn is a connection limited by the network profile of a device.
+// The first read following a write waits for the latency, as the device waits for the response of its request
+type shapedConn struct {
+	net.Conn
+	shaper *Shaper
+
+	lock            sync.Mutex
+	awaitingLatency bool
+}
+
+// Read implements net.Conn.Read
+func (c *shapedConn) Read(p []byte) (n int, err error) {
+	if !c.shaper.Connected() {
+		return 0, ErrDisconnected
+	}
+	if burst := c.shaper.downlink.burst; burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+	n, err = c.Conn.Read(p)
+
+	// the read may have been pending before the request was written (e.g. HTTP transport), so the latency is applied on arrival
+	c.lock.Lock()
+	awaitingLatency := c.awaitingLatency
+	c.awaitingLatency = false
+	c.lock.Unlock()
+	if awaitingLatency && n > 0 {
+		time.Sleep(c.shaper.profile.Latency)
+	}
+
+	time.Sleep(c.shaper.downlink.take(n))
+	return n, err
+}
+
+// Write implements net.Conn.Write
+func (c *shapedConn) Write(p []byte) (n int, err error) {
+	if !c.shaper.Connected() {
+		return 0, ErrDisconnected
+	}
+	if c.shaper.profile.Latency > 0 {
+		c.lock.Lock()
+		c.awaitingLatency = true
+		c.lock.Unlock()
+	}
+
+	for len(p) > 0 {
+		size := len(p)
+		if burst := c.shaper.uplink.burst; burst > 0 && size > burst {
+			size = burst
+		}
+		time.Sleep(c.shaper.uplink.take(size))
+		written, err := c.Conn.Write(p[:size])
+		n += written
+		if err != nil {
+			return n, err
+		}
+		p = p[size:]
+	}
+	return n, nil
+}
+
+// Close implements net.Conn.Close
+func (c *shapedConn) Close() error {
+	c.shaper.connsLock.Lock()
+	delete(c.shaper.conns, c)
+	c.shaper.connsLock.Unlock()
+	return c.Conn.Close()
+}
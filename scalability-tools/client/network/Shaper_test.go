@@ -0,0 +1,111 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// startFileServer serves a file of the given size
+func startFileServer(t *testing.T, size int) *httptest.Server {
+	data := bytes.Repeat([]byte{'x'}, size)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			io.Copy(io.Discard, r.Body)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// timeRequest sends a request with the HTTP client of the shaper and returns how long it took
+func timeRequest(t *testing.T, shaper *Shaper, request *http.Request) time.Duration {
+	t.Helper()
+	start := time.Now()
+	res, err := shaper.HTTPClient().Do(request)
+	if err != nil {
+		t.Fatalf("request: %s", err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	return time.Since(start)
+}
+
+func TestShaperNil(t *testing.T) {
+	var shaper *Shaper
+	if shaper.Enabled() || !shaper.Connected() || shaper.Profile() != (Profile{}) {
+		t.Error("a nil shaper must be disabled and connected")
+	}
+	conn, _ := net.Pipe()
+	defer conn.Close()
+	if shaper.Wrap(conn) != conn {
+		t.Error("a nil shaper must not wrap the connections")
+	}
+}
+
+func TestShaperEnabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		enabled bool
+	}{
+		{"no limit", Profile{}, false},
+		{"downlink", Profile{Downlink: 1000}, true},
+		{"uplink", Profile{Uplink: 1000}, true},
+		{"latency", Profile{Latency: time.Millisecond}, true},
+	}
+
+	for _, test := range tests {
+		shaper := NewShaper(test.profile)
+		if shaper.Enabled() != test.enabled {
+			t.Errorf("%s: got enabled %t, want %t", test.name, shaper.Enabled(), test.enabled)
+		}
+		conn, _ := net.Pipe()
+		if wrapped := shaper.Wrap(conn) != conn; wrapped != test.enabled {
+			t.Errorf("%s: got wrapped %t, want %t", test.name, wrapped, test.enabled)
+		}
+		conn.Close()
+	}
+}
+
+func TestShaperDownlink(t *testing.T) {
+	// the first 10000 bytes (burst) are received at once, the next 30000 bytes at 100000 bytes/s
+	server := startFileServer(t, 40000)
+	shaper := NewShaper(Profile{Downlink: 100000})
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+
+	if elapsed := timeRequest(t, shaper, request); elapsed < 250*time.Millisecond {
+		t.Errorf("got download time %s, want at least 300ms", elapsed)
+	}
+}
+
+func TestShaperUplink(t *testing.T) {
+	server := startFileServer(t, 0)
+	shaper := NewShaper(Profile{Uplink: 100000})
+	request, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(make([]byte, 40000)))
+
+	if elapsed := timeRequest(t, shaper, request); elapsed < 250*time.Millisecond {
+		t.Errorf("got upload time %s, want at least 300ms", elapsed)
+	}
+}
+
+func TestShaperLatency(t *testing.T) {
+	server := startFileServer(t, 100)
+	shaper := NewShaper(Profile{Latency: 100 * time.Millisecond})
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+
+	// the connection establishment, then the response
+	if elapsed := timeRequest(t, shaper, request); elapsed < 200*time.Millisecond {
+		t.Errorf("got first request time %s, want at least 200ms", elapsed)
+	}
+	// the connection is kept alive, only the response is delayed
+	if elapsed := timeRequest(t, shaper, request); elapsed < 100*time.Millisecond || elapsed >= 200*time.Millisecond {
+		t.Errorf("got second request time %s, want between 100ms and 200ms", elapsed)
+	}
+}
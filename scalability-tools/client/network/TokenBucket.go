@@ -0,0 +1,60 @@
+package network
+
+import (
+	"sync"
+	"time"
+)
+
+// MIN_BURST is the minimum size in bytes of a token bucket, so that a slow link still transfers full TCP segments
+const MIN_BURST = 1500
+
+// tokenBucket limits the throughput of a link. Taking more tokens than available is allowed:
+// the caller waits until the debt is paid back at the bucket rate
+type tokenBucket struct {
+	rate  float64 // tokens (bytes) per second, 0 for no limit
+	burst int     // maximum number of tokens stored in the bucket
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full token bucket. The bucket holds 100ms of traffic
+func newTokenBucket(rate float64) *tokenBucket {
+	if rate <= 0 {
+		return &tokenBucket{}
+	}
+	burst := int(rate / 10)
+	if burst < MIN_BURST {
+		burst = MIN_BURST
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// take removes n tokens from the bucket and returns how long the caller must wait before using them
+func (b *tokenBucket) take(n int) time.Duration {
+	if b.rate <= 0 || n <= 0 {
+		return 0
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,64 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTokenBucket(t *testing.T) {
+	tests := []struct {
+		rate  float64
+		burst int
+	}{
+		{0, 0},            // no limit
+		{-1, 0},           // no limit
+		{1000, MIN_BURST}, // 100ms of traffic is below a TCP segment
+		{1000000, 100000}, // 100ms of traffic
+	}
+
+	for _, test := range tests {
+		bucket := newTokenBucket(test.rate)
+		if bucket.burst != test.burst {
+			t.Errorf("rate %v: got burst %d, want %d", test.rate, bucket.burst, test.burst)
+		}
+		if bucket.tokens != float64(test.burst) {
+			t.Errorf("rate %v: got %v tokens, want a full bucket", test.rate, bucket.tokens)
+		}
+	}
+}
+
+func TestTokenBucketTake(t *testing.T) {
+	if wait := newTokenBucket(0).take(1 << 30); wait != 0 {
+		t.Errorf("unlimited bucket: got wait %s, want 0", wait)
+	}
+
+	bucket := newTokenBucket(10000) // burst of 1500 bytes
+	if wait := bucket.take(0); wait != 0 {
+		t.Errorf("take(0): got wait %s, want 0", wait)
+	}
+	if wait := bucket.take(1500); wait != 0 {
+		t.Errorf("take(burst): got wait %s, want 0 with a full bucket", wait)
+	}
+	// the debt of 1000 bytes is paid back in 100ms at 10000 bytes/s
+	wait := bucket.take(1000)
+	if wait < 95*time.Millisecond || wait > 100*time.Millisecond {
+		t.Errorf("take(1000) from an empty bucket: got wait %s, want about 100ms", wait)
+	}
+	// the next caller waits for the previous debt too
+	if next := bucket.take(1000); next < wait+95*time.Millisecond {
+		t.Errorf("take(1000) after a debt: got wait %s, want more than %s", next, wait+95*time.Millisecond)
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	bucket := newTokenBucket(10000)
+	bucket.take(1500)
+	time.Sleep(200 * time.Millisecond) // more than the 150ms needed to fill the bucket
+	if wait := bucket.take(1500); wait != 0 {
+		t.Errorf("got wait %s, want 0 with a refilled bucket", wait)
+	}
+	// the bucket does not store more than its burst
+	if wait := bucket.take(100); wait == 0 {
+		t.Error("got no wait, want the bucket capped to its burst")
+	}
+}
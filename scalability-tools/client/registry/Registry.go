@@ -0,0 +1,54 @@
+package registry
+
+import (
+	"hitachienergy/scalability-test-client/templates"
+	"sort"
+	"sync"
+)
+
+/*
+Device factories register themselves by name, usually from the init function of their package.
+The simulator resolves ".client.factory" against this registry, so that a factory only needs to be imported by the main package
+to be statically linked in the simulator binary.
+*/
+
+var (
+	lock      sync.RWMutex
+	factories = map[string]templates.DeviceFactory{}
+)
+
+// Register makes a device factory available under the given name. It panics if the name is already used
+func Register(name string, factory templates.DeviceFactory) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if factory == nil {
+		panic("registry: Register factory is nil")
+	}
+	if _, ok := factories[name]; ok {
+		panic("registry: Register called twice for factory " + name)
+	}
+	factories[name] = factory
+}
+
+// Get returns the device factory registered under the given name
+func Get(name string) (factory templates.DeviceFactory, ok bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	factory, ok = factories[name]
+	return factory, ok
+}
+
+// Names returns the sorted names of all the registered device factories
+func Names() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	"hitachienergy/scalability-test-client/templates"
+)
+
+type testFactory struct{}
+
+func (f testFactory) ParseConfig(data []byte) (templates.DeviceFactory, error) {
+	return f, nil
+}
+
+func (testFactory) NewDevice(controller templates.Controller) (templates.Device, error) {
+	return nil, nil
+}
+
+// expectPanic checks that the function panics
+func expectPanic(t *testing.T, name string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s: got no panic", name)
+		}
+	}()
+	f()
+}
+
+func TestRegistry(t *testing.T) {
+	Register("RegistryTestB", testFactory{})
+	Register("RegistryTestA", testFactory{})
+
+	if factory, ok := Get("RegistryTestA"); !ok || factory != (testFactory{}) {
+		t.Errorf("got factory %v and found %t, want the registered factory", factory, ok)
+	}
+	if _, ok := Get("RegistryTestC"); ok {
+		t.Error("found a factory that was never registered")
+	}
+	if names := Names(); !reflect.DeepEqual(names, []string{"RegistryTestA", "RegistryTestB"}) {
+		t.Errorf("got names %v, want the sorted registered names", names)
+	}
+
+	expectPanic(t, "duplicate name", func() { Register("RegistryTestA", testFactory{}) })
+	expectPanic(t, "nil factory", func() { Register("RegistryTestC", nil) })
+}
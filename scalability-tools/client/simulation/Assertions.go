@@ -0,0 +1,64 @@
+package simulation
+
+import (
+	"hitachienergy/scalability-test-client/config"
+	"time"
+)
+
+// AssertionResult is the outcome of a service level objective checked at the end of the simulation
+type AssertionResult struct {
+	Name      string  `json:"Name"`
+	Operator  string  `json:"Operator"`
+	Threshold float64 `json:"Threshold"`
+	Actual    float64 `json:"Actual"`
+	Passed    bool    `json:"Passed"`
+}
+
+// evaluateAssertions checks the configured objectives against the task and connection statistics.
+// Devices that did not finish their task count as failed
+func evaluateAssertions(assertions config.AssertionsDetails, taskStats SimulationStats, connectStats ConnectStats) []AssertionResult {
+	results := []AssertionResult{}
+
+	if assertions.MinSuccessRate != nil {
+		results = append(results, atLeast("success-rate", float64(*assertions.MinSuccessRate),
+			ratio(taskStats.SuccessCount, taskStats.Total)))
+	}
+	if assertions.MaxP95TaskTime != nil {
+		results = append(results, atMost("p95-task-time", time.Duration(*assertions.MaxP95TaskTime).Seconds(),
+			taskStats.P95))
+	}
+	if assertions.MaxConnectFailureRate != nil {
+		results = append(results, atMost("connect-failure-rate", float64(*assertions.MaxConnectFailureRate),
+			ratio(connectStats.FailureCount, connectStats.Total)))
+	}
+
+	return results
+}
+
+// assertionsPassed checks that all the assertions passed
+func assertionsPassed(results []AssertionResult) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// atLeast creates the result of a lower bound objective
+func atLeast(name string, threshold float64, actual float64) AssertionResult {
+	return AssertionResult{Name: name, Operator: ">=", Threshold: threshold, Actual: actual, Passed: actual >= threshold}
+}
+
+// atMost creates the result of an upper bound objective
+func atMost(name string, threshold float64, actual float64) AssertionResult {
+	return AssertionResult{Name: name, Operator: "<=", Threshold: threshold, Actual: actual, Passed: actual <= threshold}
+}
+
+// ratio returns count/total, or 0 if total is not positive
+func ratio(count int32, total int32) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(count) / float64(total)
+}
@@ -0,0 +1,77 @@
+package simulation
+
+import (
+	"hitachienergy/scalability-test-client/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvaluateAssertions(t *testing.T) {
+	successRate := config.Percentage(0.9)
+	p95 := config.TimeDuration(10 * time.Second)
+	connectFailureRate := config.Percentage(0.05)
+	all := config.AssertionsDetails{MinSuccessRate: &successRate, MaxP95TaskTime: &p95, MaxConnectFailureRate: &connectFailureRate}
+
+	tests := []struct {
+		name         string
+		assertions   config.AssertionsDetails
+		taskStats    SimulationStats
+		connectStats ConnectStats
+		want         []AssertionResult
+	}{
+		{
+			name:         "unset",
+			assertions:   config.AssertionsDetails{},
+			taskStats:    SimulationStats{SuccessCount: 0, Total: 10},
+			connectStats: ConnectStats{FailureCount: 10, Total: 10},
+			want:         []AssertionResult{},
+		},
+		{
+			name:         "passed at the thresholds",
+			assertions:   all,
+			taskStats:    SimulationStats{SuccessCount: 18, Total: 20, P95: 10},
+			connectStats: ConnectStats{FailureCount: 1, Total: 20},
+			want: []AssertionResult{
+				{Name: "success-rate", Operator: ">=", Threshold: 0.9, Actual: 0.9, Passed: true},
+				{Name: "p95-task-time", Operator: "<=", Threshold: 10, Actual: 10, Passed: true},
+				{Name: "connect-failure-rate", Operator: "<=", Threshold: 0.05, Actual: 0.05, Passed: true},
+			},
+		},
+		{
+			// the devices which did not finish their task count as failed
+			name:         "failed",
+			assertions:   all,
+			taskStats:    SimulationStats{SuccessCount: 17, FinishCount: 17, Total: 20, P95: 10.5},
+			connectStats: ConnectStats{FailureCount: 2, Total: 20},
+			want: []AssertionResult{
+				{Name: "success-rate", Operator: ">=", Threshold: 0.9, Actual: 0.85, Passed: false},
+				{Name: "p95-task-time", Operator: "<=", Threshold: 10, Actual: 10.5, Passed: false},
+				{Name: "connect-failure-rate", Operator: "<=", Threshold: 0.05, Actual: 0.1, Passed: false},
+			},
+		},
+		{
+			name:         "no device",
+			assertions:   config.AssertionsDetails{MinSuccessRate: &successRate},
+			taskStats:    SimulationStats{},
+			connectStats: ConnectStats{},
+			want:         []AssertionResult{{Name: "success-rate", Operator: ">=", Threshold: 0.9, Actual: 0, Passed: false}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := evaluateAssertions(test.assertions, test.taskStats, test.connectStats)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+			passed := true
+			for _, result := range test.want {
+				passed = passed && result.Passed
+			}
+			if assertionsPassed(got) != passed {
+				t.Errorf("assertionsPassed: got %t, want %t", !passed, passed)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package simulation
+
+import (
+	"hitachienergy/scalability-test-client/config"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// classStore holds the statistics of the devices of a single class, in addition to the statistics of the whole fleet
+type classStore struct {
+	taskStats    *dataStore
+	connectStats *connectStore
+}
+
+// newClassStore creates the storage of a device class
+func newClassStore(total int) *classStore {
+	return &classStore{
+		taskStats:    newDataStore(total),
+		connectStats: newConnectStore(total),
+	}
+}
+
+// ClassResult is the summary of the simulation results of a device class
+type ClassResult struct {
+	Class   string            `json:"Class"`
+	Factory string            `json:"Factory"`
+	Summary SimulationSummary `json:"Summary"`
+}
+
+// classRawConfig builds the configuration given to the factory of a device class:
+// the client block describes the class, so that the factories parse their arguments as for a homogeneous fleet
+func classRawConfig(rawConfig []byte, class config.DeviceClass) ([]byte, error) {
+	var data map[string]interface{}
+	err := yaml.Unmarshal(rawConfig, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	client, ok := data["client"].(map[string]interface{})
+	if !ok {
+		return nil, xerrors.Errorf("Invalid client block for device class %s", class.Name)
+	}
+	delete(client, "classes")
+	client["factory"] = class.Factory
+	client["template"] = class.Template
+	client["numberOfDevices"] = class.Number
+	client["namePrefix"] = class.NamePrefix
+	args := class.Args
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	client["args"] = args
+
+	return yaml.Marshal(data)
+}
+
+// factoryNames returns the names of the factories used by the simulation, in the order of the device classes
+func (s *Simulator) factoryNames() string {
+	if !s.config.Client.HasClasses() {
+		return s.config.Client.Factory
+	}
+
+	names := []string{}
+	for _, class := range s.config.Client.Classes {
+		names = append(names, class.Factory)
+	}
+	return strings.Join(names, ",")
+}
+
+// addClassResults adds the summary of each device class to the report, and the class of each device
+func (s *Simulator) addClassResults(report *SimulationReport) {
+	classes, _ := s.config.Client.DeviceClasses(s.config.Simulation)
+	for _, class := range classes {
+		store, ok := s.classStats[class.Name]
+		if !ok {
+			continue
+		}
+		classReport := store.taskStats.report(report.Metadata)
+		report.Classes = append(report.Classes, ClassResult{Class: class.Name, Factory: class.Factory, Summary: classReport.Summary})
+	}
+
+	for i := range report.Devices {
+		report.Devices[i].Class = s.deviceClasses[report.Devices[i].ID]
+	}
+}
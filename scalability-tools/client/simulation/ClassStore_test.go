@@ -0,0 +1,61 @@
+package simulation
+
+import (
+	"reflect"
+	"testing"
+
+	"hitachienergy/scalability-test-client/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestClassRawConfig(t *testing.T) {
+	rawConfig := []byte(`
+simulation:
+  seed: 5
+client:
+  factory: ddi
+  numberOfDevices: 10
+  namePrefix: fleet
+  args:
+    pollingTime: 1s
+  classes:
+    - factory: dmf
+      numberOfDevices: 2
+      namePrefix: dmf
+`)
+	class := config.DeviceClass{Name: "dmf", Template: "hawkbit", Factory: "dmf", Number: 2, NamePrefix: "dmf",
+		Args: map[string]interface{}{"amqpHost": "localhost"}}
+
+	data, err := classRawConfig(rawConfig, class)
+	if err != nil {
+		t.Fatalf("classRawConfig: %s", err)
+	}
+	var got map[string]interface{}
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+
+	// the client block describes the class only, the other blocks are unchanged
+	wantClient := map[string]interface{}{"factory": "dmf", "template": "hawkbit", "numberOfDevices": 2, "namePrefix": "dmf",
+		"args": map[string]interface{}{"amqpHost": "localhost"}}
+	if !reflect.DeepEqual(got["client"], wantClient) {
+		t.Errorf("got client block %v, want %v", got["client"], wantClient)
+	}
+	if !reflect.DeepEqual(got["simulation"], map[string]interface{}{"seed": 5}) {
+		t.Errorf("got simulation block %v, want it unchanged", got["simulation"])
+	}
+
+	// a class without arguments does not inherit the arguments of the client block
+	class.Args = nil
+	data, _ = classRawConfig(rawConfig, class)
+	got = nil
+	yaml.Unmarshal(data, &got)
+	if args := got["client"].(map[string]interface{})["args"]; !reflect.DeepEqual(args, map[string]interface{}{}) {
+		t.Errorf("got args %v, want none", args)
+	}
+
+	if _, err := classRawConfig([]byte("client: ddi"), class); err == nil {
+		t.Error("got no error for an invalid client block, want an error")
+	}
+}
@@ -0,0 +1,117 @@
+package simulation
+
+import (
+	"sync"
+	"time"
+)
+
+type ConnectStats struct {
+	ExecutionTime  float64         `json:"Execution-Time"`
+	SuccessCount   int32           `json:"Success"`
+	FailureCount   int32           `json:"Failure"`
+	Total          int32           `json:"Total"`
+	Latency        DurationSummary `json:"Connect-Time"`
+	FailureLatency DurationSummary `json:"Failed-Connect-Time"`
+
+	Classes map[string]ConnectStats `json:"Classes,omitempty"` // per device class
+}
+
+// connectStore is a thread-safe central storage of the devices connection results
+type connectStore struct {
+	*sync.Mutex // same as dataStore: heavy write (devices) but single read (httpserver)
+
+	startAt time.Time
+	endAt   time.Time
+
+	successCount int32
+	failureCount int32
+	total        int32
+
+	latency        *durationStats // successful connections
+	failureLatency *durationStats // failed connections
+
+	details map[string]SimulationResult
+}
+
+// newConnectStore creates a new instance of the connection storage
+func newConnectStore(total int) *connectStore {
+	return &connectStore{
+		Mutex:          &sync.Mutex{},
+		details:        map[string]SimulationResult{},
+		latency:        newDurationStats(),
+		failureLatency: newDurationStats(),
+		total:          int32(total),
+	}
+}
+
+// storeState stores the connection result of a device
+func (s *connectStore) storeState(id string, start time.Time, elapse time.Duration, success bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.details[id]; ok {
+		return
+	}
+
+	if len(s.details) == 0 || start.Before(s.startAt) {
+		s.startAt = start
+	}
+	if end := start.Add(elapse); end.After(s.endAt) {
+		s.endAt = end
+	}
+
+	s.details[id] = SimulationResult{StartAt: start, Duration: elapse.Seconds(), Success: success}
+	if success {
+		s.successCount += 1
+		s.latency.add(elapse)
+	} else {
+		s.failureCount += 1
+		s.failureLatency.add(elapse)
+	}
+}
+
+// getStatistics get the in-time statistics of the devices connection
+func (s *connectStore) getStatistics() ConnectStats {
+	s.Lock()
+	defer s.Unlock()
+
+	execTime := 0.0
+	if len(s.details) > 0 {
+		execTime = s.endAt.Sub(s.startAt).Seconds()
+	}
+
+	return ConnectStats{
+		ExecutionTime:  execTime,
+		SuccessCount:   s.successCount,
+		FailureCount:   s.failureCount,
+		Total:          s.total,
+		Latency:        s.latency.summary(),
+		FailureLatency: s.failureLatency.summary(),
+	}
+}
+
+// report takes a snapshot of the connection results for the result writers
+func (s *connectStore) report(metadata SimulationMetadata) *ConnectReport {
+	s.Lock()
+	defer s.Unlock()
+
+	devices := make([]DeviceResult, 0, len(s.details))
+	for device, data := range s.details {
+		devices = append(devices, DeviceResult{ID: device, SimulationResult: data})
+	}
+	sortDeviceResults(devices)
+
+	return &ConnectReport{
+		Metadata: metadata,
+		Summary: ConnectSummary{
+			Total:          s.total,
+			SuccessCount:   s.successCount,
+			FailureCount:   s.failureCount,
+			StartAt:        s.startAt,
+			Duration:       s.endAt.Sub(s.startAt).Seconds(),
+			Latency:        s.latency.summary(),
+			FailureLatency: s.failureLatency.summary(),
+		},
+		Devices: devices,
+	}
+}
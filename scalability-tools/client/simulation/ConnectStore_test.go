@@ -0,0 +1,53 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectStore(t *testing.T) {
+	store := newConnectStore(4)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.storeState("device2", start.Add(time.Second), 2*time.Second, true)
+	store.storeState("device1", start, 500*time.Millisecond, true)
+	store.storeState("device3", start.Add(time.Second), 4*time.Second, false)
+	store.storeState("device1", start, time.Hour, false) // a device connects once
+
+	stats := store.getStatistics()
+	if stats.Total != 4 || stats.SuccessCount != 2 || stats.FailureCount != 1 {
+		t.Errorf("got %d connected and %d failed devices out of %d, want 2 and 1 out of 4", stats.SuccessCount, stats.FailureCount, stats.Total)
+	}
+	// from the first connection attempt to the end of the last one
+	if stats.ExecutionTime != 5 {
+		t.Errorf("got execution time %v, want 5", stats.ExecutionTime)
+	}
+	if stats.Latency.Count != 2 || stats.Latency.Min != 0.5 || stats.Latency.Max != 2 || stats.Latency.Avg != 1.25 {
+		t.Errorf("got connect time %+v, want 2 connections from 0.5s to 2s", stats.Latency)
+	}
+	if stats.FailureLatency.Count != 1 || stats.FailureLatency.Max != 4 {
+		t.Errorf("got failed connect time %+v, want a single 4s failure", stats.FailureLatency)
+	}
+
+	report := store.report(SimulationMetadata{Seed: 1})
+	if report.Summary.StartAt != start || report.Summary.Duration != 5 || report.Summary.FailureCount != 1 {
+		t.Errorf("got summary %+v, want the statistics of the store", report.Summary)
+	}
+	// sorted by start time, then by identifier
+	ids := []string{}
+	for _, device := range report.Devices {
+		ids = append(ids, device.ID)
+	}
+	if len(ids) != 3 || ids[0] != "device1" || ids[1] != "device2" || ids[2] != "device3" {
+		t.Errorf("got devices %v, want [device1 device2 device3]", ids)
+	}
+	if report.Devices[0].Duration != 0.5 || !report.Devices[0].Success || report.Devices[2].Success {
+		t.Errorf("got device results %+v", report.Devices)
+	}
+}
+
+func TestConnectStoreEmpty(t *testing.T) {
+	stats := newConnectStore(2).getStatistics()
+	if stats.ExecutionTime != 0 || stats.Latency != (DurationSummary{}) || stats.FailureLatency != (DurationSummary{}) {
+		t.Errorf("got %+v, want empty statistics", stats)
+	}
+}
@@ -1,17 +1,17 @@
 package simulation
 
 import (
-	"fmt"
 	"math"
-	"os"
 	"sync"
 	"time"
 )
 
 type SimulationResult struct {
-	StartAt  time.Time
-	Duration float64
-	Success  bool
+	StartAt   time.Time
+	Duration  float64
+	Success   bool
+	Reboots   int  `json:"Reboots,omitempty"`
+	Cancelled bool `json:"Cancelled,omitempty"`
 }
 
 type SimulationStats struct {
@@ -22,6 +22,22 @@ type SimulationStats struct {
 	Min           float64 `json:"Device-Min-Time"`
 	Max           float64 `json:"Device-Max-Time"`
 	Avg           float64 `json:"Device-Avg-Time"`
+	P50           float64 `json:"Device-P50-Time"`
+	P90           float64 `json:"Device-P90-Time"`
+	P95           float64 `json:"Device-P95-Time"`
+	P99           float64 `json:"Device-P99-Time"`
+	P999          float64 `json:"Device-P99.9-Time"`
+
+	Reboots         int32 `json:"Reboots,omitempty"`
+	RebootedDevices int32 `json:"Rebooted-Devices,omitempty"`
+	RebootedSuccess int32 `json:"Rebooted-Success,omitempty"` // rebooted devices which eventually completed their task
+
+	CancelCount int32 `json:"Cancelled,omitempty"` // tasks cancelled by the platform, counted as unsuccessful
+	RejectCount int32 `json:"Rejected,omitempty"`  // devices that failed to register, counted as unsuccessful
+
+	Phases     map[string]DurationSummary `json:"Phases"`
+	Assertions []AssertionResult          `json:"Assertions,omitempty"`
+	Classes    map[string]SimulationStats `json:"Classes,omitempty"` // per device class
 }
 
 // dataStore is a thread-safe central storage of simulation results
@@ -31,24 +47,37 @@ type dataStore struct {
 	startAt time.Time
 	endAt   time.Time
 
-	min          float64
-	max          float64
-	sum          float64
+	*durationStats // durations of the finished tasks, its count is the number of finished tasks
+
+	started      map[string]bool // devices which started their task, a task may finish without being started
+	inFlight     int32           // tasks started but not finished yet
 	successCount int32
-	finishCount  int32
 	total        int32
 
+	phases     map[string]*durationStats
+	phaseOrder []string // phases in order of first appearance, to keep the analysis file readable
+
+	reboots      int32
+	deviceReboot map[string]int
+
+	cancelled map[string]bool
+	rejected  map[string]bool // devices that failed to register, they never start their task
+
 	details map[string]SimulationResult
 }
 
 // newDataStore creates a new instance of the data storage
 func newDataStore(total int) *dataStore {
 	return &dataStore{
-		Mutex:   &sync.Mutex{},
-		details: map[string]SimulationResult{},
-		min:     math.MaxFloat64,
-		max:     -1,
-		total:   int32(total),
+		Mutex:         &sync.Mutex{},
+		details:       map[string]SimulationResult{},
+		deviceReboot:  map[string]int{},
+		cancelled:     map[string]bool{},
+		rejected:      map[string]bool{},
+		started:       map[string]bool{},
+		durationStats: newDurationStats(),
+		phases:        map[string]*durationStats{},
+		total:         int32(total),
 	}
 }
 
@@ -58,30 +87,100 @@ func (s *dataStore) storeState(id string, start time.Time, elapse time.Duration,
 	defer s.Unlock()
 
 	if _, ok := s.details[id]; ok {
-		return s.finishCount == s.total
+		return s.finished()
+	}
+	if s.rejected[id] {
+		return false
 	}
 
-	if s.finishCount == 0 {
+	if s.count == 0 {
 		s.startAt = start
 	}
 
 	duration := float64(elapse.Nanoseconds()) / float64(time.Second)
 
-	s.details[id] = SimulationResult{StartAt: start, Duration: duration, Success: success}
+	s.details[id] = SimulationResult{StartAt: start, Duration: duration, Success: success, Reboots: s.deviceReboot[id], Cancelled: s.cancelled[id]}
 	s.endAt = start.Add(elapse)
-	s.sum += duration
-	s.finishCount += 1
+	s.add(elapse)
+	if s.started[id] {
+		s.inFlight -= 1
+	}
 	if success {
 		s.successCount += 1
 	}
-	if duration > s.max {
-		s.max = duration
+
+	return s.finished()
+}
+
+// storeReject stores that a device failed to register to the platform. The device is done with the simulation,
+// but it is not part of the task durations
+func (s *dataStore) storeReject(id string) (finish bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.details[id]; ok || s.rejected[id] {
+		return false
 	}
-	if duration < s.min {
-		s.min = duration
+	s.rejected[id] = true
+	return s.finished()
+}
+
+// finished checks if all the devices either finished their task or failed to register. The caller must hold the lock
+func (s *dataStore) finished() bool {
+	return s.count+int32(len(s.rejected)) == s.total
+}
+
+// storeStart stores that a device started its task
+func (s *dataStore) storeStart(id string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.details[id]; ok || s.started[id] {
+		return
 	}
+	s.started[id] = true
+	s.inFlight += 1
+}
+
+// storeReboot stores that a device crashed and is rebooting
+func (s *dataStore) storeReboot(id string) {
+	s.Lock()
+	defer s.Unlock()
 
-	return s.finishCount == s.total
+	s.reboots += 1
+	s.deviceReboot[id] += 1
+}
+
+// storeCancel stores that the task of a device was cancelled by the platform. It must be stored before the task finishes
+func (s *dataStore) storeCancel(id string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.cancelled[id] = true
+}
+
+// rebootedSuccess counts the rebooted devices which completed their task successfully. The caller must hold the lock
+func (s *dataStore) rebootedSuccess() (count int32) {
+	for id := range s.deviceReboot {
+		if s.details[id].Success {
+			count += 1
+		}
+	}
+	return count
+}
+
+// storePhase stores the time a device needed to reach a phase of its task
+func (s *dataStore) storePhase(phase string, elapse time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	stats, ok := s.phases[phase]
+	if !ok {
+		stats = newDurationStats()
+		s.phases[phase] = stats
+		s.phaseOrder = append(s.phaseOrder, phase)
+	}
+	stats.add(elapse)
 }
 
 // getStatistics get the in-time statistics of the simulation
@@ -90,57 +189,92 @@ func (s *dataStore) getStatistics() (stats SimulationStats) {
 	defer s.Unlock()
 
 	execTime := 0.0
-	avg := 0.0
-	max := 0.0
-	min := 0.0
-	if s.finishCount > 0 {
+	if s.count > 0 {
 		execTime = float64(time.Since(s.startAt).Nanoseconds()) / float64(time.Second)
-		avg = s.sum / float64(s.finishCount)
-		max = s.max
-		min = s.min
 	}
+	durations := s.summary()
 
 	return SimulationStats{
 		ExecutionTime: execTime,
-		Min:           min,
-		Max:           max,
-		Avg:           avg,
+		Min:           durations.Min,
+		Max:           durations.Max,
+		Avg:           durations.Avg,
+		P50:           durations.P50,
+		P90:           durations.P90,
+		P95:           durations.P95,
+		P99:           durations.P99,
+		P999:          durations.P999,
 		SuccessCount:  s.successCount,
-		FinishCount:   s.finishCount,
+		FinishCount:   s.count,
 		Total:         s.total,
+		Phases:        s.phaseSummaries(),
+
+		Reboots:         s.reboots,
+		RebootedDevices: int32(len(s.deviceReboot)),
+		RebootedSuccess: s.rebootedSuccess(),
+
+		CancelCount: int32(len(s.cancelled)),
+		RejectCount: int32(len(s.rejected)),
 	}
 }
 
-// saveToDisk is called after the whole simulation finishes. It stores the analysis to the target path
-func (s *dataStore) saveToDisk(opth string) error {
+// phaseSummaries returns the summaries of all the phases reported so far. The caller must hold the lock
+func (s *dataStore) phaseSummaries() map[string]DurationSummary {
+	phases := make(map[string]DurationSummary, len(s.phases))
+	for phase, stats := range s.phases {
+		phases[phase] = stats.summary()
+	}
+	return phases
+}
+
+// report builds a snapshot of the simulation results. Devices are sorted by their task start time
+func (s *dataStore) report(metadata SimulationMetadata) *SimulationReport {
 	s.Lock()
 	defer s.Unlock()
 
-	detailsBuffer := []byte("Device StartAt Duration(s) Success\n")
-	mean := s.sum / float64(s.finishCount)
+	durations := s.summary()
 	std := 0.0
+	devices := make([]DeviceResult, 0, len(s.details))
 	for device, data := range s.details {
-		std += math.Pow(data.Duration-mean, 2)
-		detailsBuffer = append(detailsBuffer,
-			[]byte(fmt.Sprintf("%s %d %.9f %t\n", device, data.StartAt.Unix(), data.Duration, data.Success))...)
-	}
-	std = math.Sqrt(std / float64(s.finishCount))
-
-	buffer := []byte{}
-	buffer = append(buffer,
-		[]byte(fmt.Sprintf("Total: %d\n"+
-			"Success: %d\n"+
-			"StartAt: %d\n"+
-			"Duration: %fs\n"+
-			"Avg Execution Time per Device: %.9fs\n"+
-			"Max Execution Time per Device: %.9fs\n"+
-			"Min Execution Time per Device:: %.9fs\n"+
-			"Std: %.9f\n\n",
-			s.total, s.successCount,
-			s.startAt.Unix(), float64(s.endAt.Sub(s.startAt).Nanoseconds())/float64(time.Second),
-			mean, s.max, s.min, std))...)
-	buffer = append(buffer, detailsBuffer...)
-
-	err := os.WriteFile(opth, buffer, 0644)
-	return err
+		std += math.Pow(data.Duration-durations.Avg, 2)
+		devices = append(devices, DeviceResult{ID: device, SimulationResult: data})
+	}
+	if s.count > 0 {
+		std = math.Sqrt(std / float64(s.count))
+	}
+	sortDeviceResults(devices)
+
+	phases := make([]PhaseResult, 0, len(s.phaseOrder))
+	for _, phase := range s.phaseOrder {
+		phases = append(phases, PhaseResult{Phase: phase, DurationSummary: s.phases[phase].summary()})
+	}
+
+	return &SimulationReport{
+		Metadata: metadata,
+		Summary: SimulationSummary{
+			Total:        s.total,
+			SuccessCount: s.successCount,
+			FinishCount:  s.count,
+			StartAt:      s.startAt,
+			Duration:     s.endAt.Sub(s.startAt).Seconds(),
+			Avg:          durations.Avg,
+			Max:          durations.Max,
+			Min:          durations.Min,
+			Std:          std,
+			P50:          durations.P50,
+			P90:          durations.P90,
+			P95:          durations.P95,
+			P99:          durations.P99,
+			P999:         durations.P999,
+
+			Reboots:         s.reboots,
+			RebootedDevices: int32(len(s.deviceReboot)),
+			RebootedSuccess: s.rebootedSuccess(),
+
+			CancelCount: int32(len(s.cancelled)),
+			RejectCount: int32(len(s.rejected)),
+		},
+		Phases:  phases,
+		Devices: devices,
+	}
 }
@@ -0,0 +1,74 @@
+package simulation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDataStoreDurations(t *testing.T) {
+	store := newDataStore(4)
+	start := time.Now()
+	store.storeState("device0", start, 1*time.Second, true)
+	store.storeState("device1", start, 2*time.Second, false)
+	store.storeState("device2", start, 3*time.Second, true)
+	store.storeState("device2", start, time.Hour, true) // a task finishes once
+
+	stats := store.getStatistics()
+	if stats.FinishCount != 3 || stats.SuccessCount != 2 {
+		t.Errorf("got %d finished and %d successful tasks, want 3 and 2", stats.FinishCount, stats.SuccessCount)
+	}
+	if stats.Min != 1 || stats.Max != 3 || stats.Avg != 2 {
+		t.Errorf("got min %v, max %v and avg %v, want 1, 3 and 2", stats.Min, stats.Max, stats.Avg)
+	}
+	summary := store.summary()
+	if stats.P50 != summary.P50 || stats.P999 != summary.P999 {
+		t.Errorf("got percentiles %v and %v, want those of the task durations %+v", stats.P50, stats.P999, summary)
+	}
+
+	report := store.report(SimulationMetadata{})
+	if report.Summary.Min != 1 || report.Summary.Max != 3 || report.Summary.Avg != 2 || report.Summary.FinishCount != 3 {
+		t.Errorf("got report summary %+v, want the statistics of the store", report.Summary)
+	}
+	if want := 0.816496580927726; report.Summary.Std != want { // sqrt(2/3)
+		t.Errorf("got standard deviation %v, want %v", report.Summary.Std, want)
+	}
+	if store.finished() {
+		t.Error("store finished with a task missing")
+	}
+}
+
+func TestDataStoreEmpty(t *testing.T) {
+	stats := newDataStore(1).getStatistics()
+	if stats.ExecutionTime != 0 || stats.Min != 0 || stats.Max != 0 || stats.Avg != 0 || stats.P99 != 0 {
+		t.Errorf("got %+v, want empty statistics", stats)
+	}
+}
+
+func TestDataStorePhases(t *testing.T) {
+	store := newDataStore(2)
+	store.storePhase("DOWNLOADING", 1*time.Second)
+	store.storePhase("DOWNLOADED", 4*time.Second)
+	store.storePhase("DOWNLOADING", 3*time.Second)
+
+	phases := store.getStatistics().Phases
+	if len(phases) != 2 {
+		t.Fatalf("got phases %v, want DOWNLOADING and DOWNLOADED", phases)
+	}
+	if downloading := phases["DOWNLOADING"]; downloading.Count != 2 || downloading.Min != 1 || downloading.Max != 3 || downloading.Avg != 2 {
+		t.Errorf("got DOWNLOADING %+v, want 2 durations from 1s to 3s", downloading)
+	}
+
+	// the report keeps the phases in order of first appearance
+	report := store.report(SimulationMetadata{})
+	order := []string{}
+	for _, phase := range report.Phases {
+		order = append(order, phase.Phase)
+	}
+	if want := []string{"DOWNLOADING", "DOWNLOADED"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got report phases %v, want %v", order, want)
+	}
+	if report.Phases[1].Count != 1 || report.Phases[1].Avg != 4 {
+		t.Errorf("got DOWNLOADED %+v, want a single duration of 4s", report.Phases[1])
+	}
+}
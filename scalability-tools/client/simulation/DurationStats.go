@@ -0,0 +1,69 @@
+package simulation
+
+import (
+	"math"
+	"time"
+)
+
+// DurationSummary is the in-time summary of a set of durations (in seconds)
+type DurationSummary struct {
+	Count int32   `json:"Count"`
+	Min   float64 `json:"Min-Time"`
+	Max   float64 `json:"Max-Time"`
+	Avg   float64 `json:"Avg-Time"`
+	P50   float64 `json:"P50-Time"`
+	P90   float64 `json:"P90-Time"`
+	P95   float64 `json:"P95-Time"`
+	P99   float64 `json:"P99-Time"`
+	P999  float64 `json:"P99.9-Time"`
+}
+
+// durationStats aggregates durations of the same kind with a bounded memory footprint. It is not thread-safe
+type durationStats struct {
+	count     int32
+	sum       float64
+	min       float64
+	max       float64
+	durations *histogram
+}
+
+// newDurationStats creates a new empty aggregation
+func newDurationStats() *durationStats {
+	return &durationStats{
+		min:       math.MaxFloat64,
+		max:       -1,
+		durations: newHistogram(),
+	}
+}
+
+// add records a new duration
+func (d *durationStats) add(elapse time.Duration) {
+	duration := elapse.Seconds()
+	d.count += 1
+	d.sum += duration
+	if duration > d.max {
+		d.max = duration
+	}
+	if duration < d.min {
+		d.min = duration
+	}
+	d.durations.record(elapse)
+}
+
+// summary returns the summary of all the recorded durations
+func (d *durationStats) summary() DurationSummary {
+	if d.count == 0 {
+		return DurationSummary{}
+	}
+	return DurationSummary{
+		Count: d.count,
+		Min:   d.min,
+		Max:   d.max,
+		Avg:   d.sum / float64(d.count),
+		P50:   d.durations.percentile(50),
+		P90:   d.durations.percentile(90),
+		P95:   d.durations.percentile(95),
+		P99:   d.durations.percentile(99),
+		P999:  d.durations.percentile(99.9),
+	}
+}
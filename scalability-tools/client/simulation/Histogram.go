@@ -0,0 +1,128 @@
+package simulation
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// histogramPrecision is the number of bits used for the linear sub-buckets of each power of two.
+// 7 bits give 64 sub-buckets per power of two, i.e. a relative error below 1.6%
+const histogramPrecision = 7
+
+// histogramResolution is the smallest duration the histogram can distinguish
+const histogramResolution = time.Microsecond
+
+// histogram is a log-linear (HDR-like) histogram of durations.
+// Its memory footprint is fixed and does not depend on the number of recorded values. It is not thread-safe
+type histogram struct {
+	counts []int64
+	total  int64
+	min    int64
+	max    int64
+}
+
+// newHistogram creates a new empty histogram
+func newHistogram() *histogram {
+	halfCount := 1 << (histogramPrecision - 1)
+	return &histogram{
+		counts: make([]int64, (64-histogramPrecision+2)*halfCount),
+		min:    math.MaxInt64,
+		max:    -1,
+	}
+}
+
+// record adds a new duration to the histogram
+func (h *histogram) record(d time.Duration) {
+	value := int64(d / histogramResolution)
+	if value < 0 {
+		value = 0
+	}
+
+	h.counts[bucketIndex(value)] += 1
+	h.total += 1
+	if value < h.min {
+		h.min = value
+	}
+	if value > h.max {
+		h.max = value
+	}
+}
+
+// percentile returns the duration (in seconds) below which the given percentage (0-100) of the recorded values fall
+func (h *histogram) percentile(q float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+
+	target := int64(math.Ceil(q / 100 * float64(h.total)))
+	if target < 1 {
+		target = 1
+	}
+
+	var cumulative int64
+	for idx, count := range h.counts {
+		cumulative += count
+		if cumulative >= target {
+			return toSeconds(h.bucketValue(idx))
+		}
+	}
+	return toSeconds(h.max)
+}
+
+// countAtOrBelow returns the number of recorded values that are lower or equal to the given duration (in seconds).
+// Values sharing the bucket of the bound are counted only if the whole bucket is below the bound
+func (h *histogram) countAtOrBelow(seconds float64) int64 {
+	bound := int64(math.Round(seconds / histogramResolution.Seconds()))
+	var count int64
+	for idx, c := range h.counts {
+		_, upper := bucketRange(idx)
+		if upper > bound {
+			break
+		}
+		count += c
+	}
+	return count
+}
+
+// bucketValue returns a representative value of the bucket, i.e. its middle point clamped to the recorded range
+func (h *histogram) bucketValue(idx int) int64 {
+	lower, upper := bucketRange(idx)
+	value := lower + (upper-lower)/2
+	if value < h.min {
+		value = h.min
+	}
+	if value > h.max {
+		value = h.max
+	}
+	return value
+}
+
+// bucketIndex maps a value to its bucket. Values smaller than 2^precision have their own bucket,
+// bigger values are grouped in 2^(precision-1) linear sub-buckets per power of two
+func bucketIndex(value int64) int {
+	subBucketCount := int64(1) << histogramPrecision
+	if value < subBucketCount {
+		return int(value)
+	}
+	shift := bits.Len64(uint64(value)) - histogramPrecision
+	halfCount := 1 << (histogramPrecision - 1)
+	return shift*halfCount + int(value>>shift)
+}
+
+// bucketRange returns the inclusive range of values stored in a bucket
+func bucketRange(idx int) (lower int64, upper int64) {
+	subBucketCount := 1 << histogramPrecision
+	if idx < subBucketCount {
+		return int64(idx), int64(idx)
+	}
+	halfCount := 1 << (histogramPrecision - 1)
+	shift := idx/halfCount - 1
+	sub := int64(idx - shift*halfCount)
+	return sub << shift, (sub+1)<<shift - 1
+}
+
+// toSeconds converts a histogram value to seconds
+func toSeconds(value int64) float64 {
+	return float64(value) * histogramResolution.Seconds()
+}
@@ -0,0 +1,172 @@
+package simulation
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// histogramError is the relative error of a bucket value, i.e. half the width of the widest sub-bucket
+const histogramError = 1.0 / (1 << histogramPrecision)
+
+func TestHistogramSize(t *testing.T) {
+	h := newHistogram()
+	if len(h.counts) != 3776 {
+		t.Errorf("got %d buckets, want 3776", len(h.counts))
+	}
+	if idx := bucketIndex(math.MaxInt64); idx >= len(h.counts) {
+		t.Errorf("bucket of the biggest value: got %d, want below %d", idx, len(h.counts))
+	}
+}
+
+func TestBucketIndex(t *testing.T) {
+	tests := []struct {
+		value int64
+		idx   int
+		lower int64
+		upper int64
+	}{
+		{0, 0, 0, 0},
+		{1, 1, 1, 1},
+		{127, 127, 127, 127},    // last exact bucket
+		{128, 128, 128, 129},    // first linear sub-bucket, 2 values wide
+		{129, 128, 128, 129},    // same sub-bucket
+		{130, 129, 130, 131},    // next sub-bucket
+		{255, 191, 254, 255},    // last sub-bucket of [128, 256)
+		{256, 192, 256, 259},    // first sub-bucket of [256, 512), 4 values wide
+		{1000, 317, 1000, 1007}, // 1ms
+		{1 << 20, 960, 1 << 20, 1<<20 + 1<<14 - 1},
+		{math.MaxInt64, 3711, math.MaxInt64 - 1<<56 + 1, math.MaxInt64},
+	}
+
+	for _, test := range tests {
+		idx := bucketIndex(test.value)
+		if idx != test.idx {
+			t.Errorf("bucketIndex(%d): got %d, want %d", test.value, idx, test.idx)
+			continue
+		}
+		lower, upper := bucketRange(idx)
+		if lower != test.lower || upper != test.upper {
+			t.Errorf("bucketRange(%d): got [%d, %d], want [%d, %d]", idx, lower, upper, test.lower, test.upper)
+		}
+	}
+}
+
+func TestBucketRangeContiguous(t *testing.T) {
+	last := bucketIndex(math.MaxInt64)
+	for idx := 1; idx <= last; idx++ {
+		lower, upper := bucketRange(idx)
+		_, previous := bucketRange(idx - 1)
+		if lower != previous+1 {
+			t.Fatalf("bucket %d starts at %d, want %d", idx, lower, previous+1)
+		}
+		if bucketIndex(lower) != idx || bucketIndex(upper) != idx {
+			t.Fatalf("bucket %d: [%d, %d] mapped to buckets %d and %d", idx, lower, upper, bucketIndex(lower), bucketIndex(upper))
+		}
+	}
+}
+
+func TestHistogramEdges(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		want      float64 // every percentile, in seconds
+	}{
+		{"empty", nil, 0},
+		{"negative", []time.Duration{-time.Second}, 0},
+		{"below resolution", []time.Duration{time.Nanosecond, 999 * time.Nanosecond}, 0},
+		{"single value", []time.Duration{1234567 * time.Microsecond}, 1.234567}, // clamped to min and max
+		{"same values", []time.Duration{time.Second, time.Second, time.Second}, 1},
+		{"biggest duration", []time.Duration{math.MaxInt64}, toSeconds(int64(time.Duration(math.MaxInt64) / histogramResolution))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newHistogram()
+			for _, d := range test.durations {
+				h.record(d)
+			}
+			for _, q := range []float64{0, 50, 99.9, 100} {
+				if got := h.percentile(q); got != test.want {
+					t.Errorf("percentile(%v): got %v, want %v", q, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHistogramMinMax(t *testing.T) {
+	h := newHistogram()
+	// 1007µs is the upper bound of the [1000, 1007] bucket and 2^24µs the lower bound of the [2^24, 2^24 + 2^18) bucket
+	for _, d := range []time.Duration{300 * time.Millisecond, 1007 * time.Microsecond, 1 << 24 * time.Microsecond} {
+		h.record(d)
+	}
+
+	if h.min != 1007 || h.max != 1<<24 {
+		t.Errorf("got min %d and max %d, want 1007 and %d", h.min, h.max, 1<<24)
+	}
+	// the middle points of the extreme buckets are out of the recorded range, so they are clamped to it
+	if got, want := h.percentile(0), toSeconds(1007); got != want {
+		t.Errorf("percentile(0): got %v, want %v", got, want)
+	}
+	if got, want := h.percentile(100), toSeconds(1<<24); got != want {
+		t.Errorf("percentile(100): got %v, want %v", got, want)
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration func(i int) time.Duration
+		n        int
+		q        float64
+		want     float64
+	}{
+		{"uniform p50", func(i int) time.Duration { return time.Duration(i) * time.Millisecond }, 10000, 50, 5},
+		{"uniform p90", func(i int) time.Duration { return time.Duration(i) * time.Millisecond }, 10000, 90, 9},
+		{"uniform p99", func(i int) time.Duration { return time.Duration(i) * time.Millisecond }, 10000, 99, 9.9},
+		{"uniform p99.9", func(i int) time.Duration { return time.Duration(i) * time.Millisecond }, 10000, 99.9, 9.99},
+		{"microseconds p50", func(i int) time.Duration { return time.Duration(i) * time.Microsecond }, 100, 50, 0.00005},
+		{"quadratic p50", func(i int) time.Duration { return time.Duration(i*i) * time.Microsecond }, 1000, 50, 0.25},
+		{"quadratic p95", func(i int) time.Duration { return time.Duration(i*i) * time.Microsecond }, 1000, 95, 0.9025},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newHistogram()
+			for i := 1; i <= test.n; i++ {
+				h.record(test.duration(i))
+			}
+			got := h.percentile(test.q)
+			if math.Abs(got-test.want) > test.want*histogramError {
+				t.Errorf("percentile(%v): got %v, want %v ± %.1f%%", test.q, got, test.want, histogramError*100)
+			}
+		})
+	}
+}
+
+func TestHistogramCountAtOrBelow(t *testing.T) {
+	h := newHistogram()
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Microsecond)
+	}
+	h.record(time.Second)
+
+	tests := []struct {
+		seconds float64
+		want    int64
+	}{
+		{0, 0},
+		{0.000050, 50},  // exact buckets below 2^precision
+		{0.000127, 100}, // all the microsecond values
+		{0.5, 100},
+		{0.999999, 100}, // the bucket of 1s is not wholly below the bound
+		{2, 101},
+	}
+
+	for _, test := range tests {
+		if got := h.countAtOrBelow(test.seconds); got != test.want {
+			t.Errorf("countAtOrBelow(%v): got %d, want %d", test.seconds, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const MetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// metricsBuckets are the upper bounds (in seconds) of the exported duration histograms
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// metricsWriter formats metric families in the OpenMetrics text format
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+// family writes the metadata of a metric family
+func (m *metricsWriter) family(name string, metricType string, unit string, help string) {
+	fmt.Fprintf(m, "# TYPE %s %s\n", name, metricType)
+	if len(unit) > 0 {
+		fmt.Fprintf(m, "# UNIT %s %s\n", name, unit)
+	}
+	fmt.Fprintf(m, "# HELP %s %s\n", name, help)
+}
+
+// gauge writes a gauge without labels
+func (m *metricsWriter) gauge(name string, help string, value int64) {
+	m.family(name, "gauge", "", help)
+	fmt.Fprintf(m, "%s %d\n", name, value)
+}
+
+// counter writes a counter without labels
+func (m *metricsWriter) counter(name string, help string, value int64) {
+	m.family(name, "counter", "", help)
+	fmt.Fprintf(m, "%s_total %d\n", name, value)
+}
+
+// histogram writes the samples of a duration histogram. labels must be empty or end with a comma
+func (m *metricsWriter) histogram(name string, labels string, stats *durationStats) {
+	for _, bound := range metricsBuckets {
+		fmt.Fprintf(m, "%s_bucket{%sle=\"%s\"} %d\n", name, labels,
+			strconv.FormatFloat(bound, 'f', -1, 64), stats.durations.countAtOrBelow(bound))
+	}
+	fmt.Fprintf(m, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, stats.count)
+	labels = strings.TrimSuffix(labels, ",")
+	if len(labels) > 0 {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(m, "%s_count%s %d\n", name, labels, stats.count)
+	fmt.Fprintf(m, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(stats.sum, 'f', -1, 64))
+}
+
+// escapeLabel escapes a label value according to the OpenMetrics text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeMetrics writes all the simulation metrics in the OpenMetrics text format
+func writeMetrics(w io.Writer, taskStats *dataStore, connectStats *connectStore, requestStats *requestStore, classStats map[string]*classStore) error {
+	m := &metricsWriter{}
+
+	connectStats.Lock()
+	m.gauge("fist_devices", "Number of simulated devices.", int64(connectStats.total))
+	// devices are not tracked once connected (crash, disconnection, stop), so the successful connections are counted
+	m.counter("fist_device_connects", "Number of devices that connected successfully to the platform.", int64(connectStats.successCount))
+	m.counter("fist_device_connect_failures", "Number of devices that failed to connect to the platform.", int64(connectStats.failureCount))
+	m.family("fist_device_connect_duration_seconds", "histogram", "seconds", "Time needed by the devices to connect to the platform.")
+	m.histogram("fist_device_connect_duration_seconds", "", connectStats.latency)
+	connectStats.Unlock()
+
+	taskStats.Lock()
+	m.gauge("fist_tasks_in_flight", "Number of tasks started but not finished yet.", int64(taskStats.inFlight))
+	m.counter("fist_tasks_started", "Number of tasks started by the devices.", int64(len(taskStats.started)))
+	m.counter("fist_tasks_finished", "Number of tasks finished by the devices.", int64(taskStats.count))
+	m.counter("fist_tasks_succeeded", "Number of tasks finished successfully by the devices.", int64(taskStats.successCount))
+	m.counter("fist_tasks_cancelled", "Number of tasks cancelled by the platform.", int64(len(taskStats.cancelled)))
+	m.counter("fist_device_reboots", "Number of reboots of the crashed devices.", int64(taskStats.reboots))
+	m.family("fist_task_duration_seconds", "histogram", "seconds", "Time needed by the devices to finish their task.")
+	m.histogram("fist_task_duration_seconds", "", taskStats.durationStats)
+	m.family("fist_task_phase_duration_seconds", "histogram", "seconds", "Time needed by the devices to reach a phase of their task since the previous one.")
+	for _, phase := range taskStats.phaseOrder {
+		m.histogram("fist_task_phase_duration_seconds", fmt.Sprintf("phase=\"%s\",", escapeLabel(phase)), taskStats.phases[phase])
+	}
+	taskStats.Unlock()
+
+	if len(classStats) > 0 {
+		writeClassMetrics(m, classStats)
+	}
+
+	requestStats.Lock()
+	m.family("fist_platform_requests", "counter", "", "Number of requests sent by the devices to the platform, per endpoint and status code (0 if no response was received).")
+	for _, key := range requestStats.sortedRequestKeys() {
+		fmt.Fprintf(m, "fist_platform_requests_total{endpoint=\"%s\",code=\"%d\"} %d\n", escapeLabel(key.endpoint), key.statusCode, requestStats.requests[key])
+	}
+	m.family("fist_platform_request_errors", "counter", "", "Number of failed requests sent by the devices to the platform, per endpoint.")
+	for _, endpoint := range requestStats.sortedErrorEndpoints() {
+		fmt.Fprintf(m, "fist_platform_request_errors_total{endpoint=\"%s\"} %d\n", escapeLabel(endpoint), requestStats.errors[endpoint])
+	}
+	requestStats.Unlock()
+
+	m.WriteString("# EOF\n")
+	_, err := w.Write(m.Bytes())
+	return err
+}
+
+// writeClassMetrics writes the devices and tasks counters of each device class
+func writeClassMetrics(m *metricsWriter, classStats map[string]*classStore) {
+	classes := make([]string, 0, len(classStats))
+	for class := range classStats {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	m.family("fist_class_device_connects", "counter", "", "Number of devices that connected successfully to the platform, per device class.")
+	for _, class := range classes {
+		stats := classStats[class].connectStats
+		stats.Lock()
+		fmt.Fprintf(m, "fist_class_device_connects_total{class=\"%s\"} %d\n", escapeLabel(class), stats.successCount)
+		stats.Unlock()
+	}
+	m.family("fist_class_tasks_finished", "counter", "", "Number of tasks finished by the devices, per device class.")
+	for _, class := range classes {
+		stats := classStats[class].taskStats
+		stats.Lock()
+		fmt.Fprintf(m, "fist_class_tasks_finished_total{class=\"%s\"} %d\n", escapeLabel(class), stats.count)
+		stats.Unlock()
+	}
+	m.family("fist_class_tasks_succeeded", "counter", "", "Number of tasks finished successfully by the devices, per device class.")
+	for _, class := range classes {
+		stats := classStats[class].taskStats
+		stats.Lock()
+		fmt.Fprintf(m, "fist_class_tasks_succeeded_total{class=\"%s\"} %d\n", escapeLabel(class), stats.successCount)
+		stats.Unlock()
+	}
+	m.family("fist_class_task_duration_seconds", "histogram", "seconds", "Time needed by the devices to finish their task, per device class.")
+	for _, class := range classes {
+		stats := classStats[class].taskStats
+		stats.Lock()
+		m.histogram("fist_class_task_duration_seconds", fmt.Sprintf("class=\"%s\",", escapeLabel(class)), stats.durationStats)
+		stats.Unlock()
+	}
+}
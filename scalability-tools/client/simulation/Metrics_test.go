@@ -0,0 +1,101 @@
+package simulation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	start := time.Now()
+	taskStats := newDataStore(4)
+	connectStats := newConnectStore(4)
+	requestStats := newRequestStore()
+	classStats := map[string]*classStore{"gateway": newClassStore(2)}
+
+	connectStats.storeState("device0", start, 200*time.Millisecond, true)
+	connectStats.storeState("device1", start, 2*time.Second, true)
+	connectStats.storeState("device2", start, time.Second, false)
+	taskStats.storeStart("device0")
+	taskStats.storeStart("device1")
+	taskStats.storeState("device0", start, 3*time.Second, true)
+	// the task of a device failing before it starts finishes without being started
+	taskStats.storeState("device3", start, 0, false)
+	classStats["gateway"].connectStats.storeState("device0", start, 200*time.Millisecond, true)
+	classStats["gateway"].taskStats.storeState("device0", start, 3*time.Second, true)
+	requestStats.storeRequest("ddi/controllerBase", 200, nil)
+	requestStats.storeRequest("ddi/controllerBase", 200, nil)
+	requestStats.storeRequest("ddi/controllerBase", 503, xerrors.New("unavailable"))
+	requestStats.storeRequest("ddi/download", 0, xerrors.New("timeout"))
+
+	var buffer bytes.Buffer
+	if err := writeMetrics(&buffer, taskStats, connectStats, requestStats, classStats); err != nil {
+		t.Fatalf("writeMetrics: %s", err)
+	}
+	metrics := buffer.String()
+
+	for _, line := range []string{
+		"# TYPE fist_devices gauge",
+		"fist_devices 4",
+		"# TYPE fist_device_connects counter",
+		"fist_device_connects_total 2",
+		"fist_device_connect_failures_total 1",
+		"# UNIT fist_device_connect_duration_seconds seconds",
+		`fist_device_connect_duration_seconds_bucket{le="0.25"} 1`,
+		`fist_device_connect_duration_seconds_bucket{le="2.5"} 2`,
+		`fist_device_connect_duration_seconds_bucket{le="+Inf"} 2`,
+		"fist_device_connect_duration_seconds_count 2",
+		"fist_tasks_in_flight 1",
+		"fist_tasks_started_total 2",
+		"fist_tasks_finished_total 2",
+		"fist_tasks_succeeded_total 1",
+		`fist_task_duration_seconds_bucket{le="2.5"} 1`,
+		`fist_task_duration_seconds_bucket{le="5"} 2`,
+		"fist_task_duration_seconds_sum 3",
+		`fist_class_device_connects_total{class="gateway"} 1`,
+		`fist_class_tasks_finished_total{class="gateway"} 1`,
+		`fist_class_task_duration_seconds_count{class="gateway"} 1`,
+		`fist_platform_requests_total{endpoint="ddi/controllerBase",code="200"} 2`,
+		`fist_platform_requests_total{endpoint="ddi/controllerBase",code="503"} 1`,
+		`fist_platform_requests_total{endpoint="ddi/download",code="0"} 1`,
+		`fist_platform_request_errors_total{endpoint="ddi/controllerBase"} 1`,
+		`fist_platform_request_errors_total{endpoint="ddi/download"} 1`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("missing line %q", line)
+		}
+	}
+	if !strings.HasSuffix(metrics, "# EOF\n") {
+		t.Error("metrics do not end with # EOF")
+	}
+	if t.Failed() {
+		t.Log(metrics)
+	}
+}
+
+func TestTasksInFlight(t *testing.T) {
+	taskStats := newDataStore(3)
+	start := time.Now()
+	// finished tasks which were never started, e.g. a DDI error before the deployment, are not in flight
+	taskStats.storeState("device0", start, 0, false)
+	taskStats.storeState("device1", start, 0, false)
+	taskStats.storeStart("device2")
+	taskStats.storeStart("device2")
+	if taskStats.inFlight != 1 {
+		t.Errorf("got %d tasks in flight, want 1", taskStats.inFlight)
+	}
+	taskStats.storeStart("device0") // already finished
+	taskStats.storeState("device2", start, time.Second, true)
+	if taskStats.inFlight != 0 {
+		t.Errorf("got %d tasks in flight once all finished, want 0", taskStats.inFlight)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got, want := escapeLabel("a\"b\\c\nd"), `a\"b\\c\nd`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
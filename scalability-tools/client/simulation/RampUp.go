@@ -0,0 +1,98 @@
+package simulation
+
+import (
+	"hitachienergy/scalability-test-client/config"
+	"math/rand"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// rampIntegrationStep is the resolution used to integrate the arrival rate during the ramp
+const rampIntegrationStep = time.Millisecond
+
+// rampProfile describes how the devices arrival rate evolves over time
+type rampProfile struct {
+	config.RampUpDetails
+}
+
+// newRampProfile validates the ramp configuration and creates a new ramp profile
+func newRampProfile(details config.RampUpDetails) (*rampProfile, error) {
+	switch details.Profile {
+	case "", "constant":
+		details.Profile = "constant"
+	case "linear":
+	case "step":
+		if details.Steps <= 0 {
+			return nil, xerrors.Errorf("Invalid number of ramp steps. Got %d", details.Steps)
+		}
+	default:
+		return nil, xerrors.Errorf("Unrecognized ramp profile %s", details.Profile)
+	}
+	if details.StartRate < 0 || details.EndRate <= 0 {
+		return nil, xerrors.Errorf("Invalid ramp rates (start: %f, end: %f). Rates must be non-negative and the end rate positive", details.StartRate, details.EndRate)
+	}
+	if details.Profile != "constant" && details.Duration <= 0 {
+		return nil, xerrors.Errorf("Non-positive ramp duration for profile %s", details.Profile)
+	}
+	return &rampProfile{RampUpDetails: details}, nil
+}
+
+// rate returns the target arrival rate (devices per second) at the given elapsed time
+func (p *rampProfile) rate(elapsed time.Duration) float64 {
+	duration := time.Duration(p.Duration)
+	if p.Profile == "constant" || elapsed >= duration {
+		return p.EndRate
+	}
+
+	progress := float64(elapsed) / float64(duration)
+	switch p.Profile {
+	case "linear":
+		return p.StartRate + (p.EndRate-p.StartRate)*progress
+	case "step":
+		level := int(progress * float64(p.Steps))
+		return p.StartRate + (p.EndRate-p.StartRate)*float64(level)/float64(p.Steps)
+	}
+	return p.EndRate
+}
+
+// schedule computes the arrival time (relative to the registration start) of n devices.
+// Arrivals are placed where the integrated rate reaches 1, 2, ... n-1, or at exponentially distributed increments for Poisson arrivals
+func (p *rampProfile) schedule(r *rand.Rand, n int) []time.Duration {
+	arrivals := make([]time.Duration, 0, n)
+	nextArrival := func(current float64) float64 {
+		if p.Poisson {
+			return current + r.ExpFloat64()
+		}
+		return current + 1
+	}
+
+	// the first device registers immediately
+	arrivals = append(arrivals, 0)
+	target := nextArrival(0)
+
+	duration := time.Duration(p.Duration)
+	if p.Profile == "constant" {
+		duration = 0
+	}
+
+	// integrate the rate numerically during the ramp
+	cumulative := 0.0
+	elapsed := time.Duration(0)
+	for ; elapsed < duration && len(arrivals) < n; elapsed += rampIntegrationStep {
+		cumulative += p.rate(elapsed) * rampIntegrationStep.Seconds()
+		for cumulative >= target && len(arrivals) < n {
+			arrivals = append(arrivals, elapsed+rampIntegrationStep)
+			target = nextArrival(target)
+		}
+	}
+
+	// after the ramp the rate stays constant, so the arrivals can be computed directly
+	for len(arrivals) < n {
+		seconds := (target - cumulative) / p.EndRate
+		arrivals = append(arrivals, elapsed+time.Duration(seconds*float64(time.Second)))
+		target = nextArrival(target)
+	}
+
+	return arrivals
+}
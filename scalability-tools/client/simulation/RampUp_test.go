@@ -0,0 +1,134 @@
+package simulation
+
+import (
+	"hitachienergy/scalability-test-client/config"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// scheduleTolerance covers the numerical integration of the rate during the ramp
+const scheduleTolerance = 2 * rampIntegrationStep
+
+func TestRampProfileSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		details config.RampUpDetails
+		n       int
+		arrival func(k int) time.Duration // expected arrival time of the k-th device
+	}{
+		{
+			name:    "constant",
+			details: config.RampUpDetails{Profile: "constant", EndRate: 4},
+			n:       20,
+			arrival: func(k int) time.Duration { return seconds(float64(k) / 4) },
+		},
+		{
+			// rate(t) = t, so k devices arrived once t^2 / 2 = k, then 10 devices/s after the ramp
+			name:    "linear",
+			details: config.RampUpDetails{Profile: "linear", StartRate: 0, EndRate: 10, Duration: config.TimeDuration(10 * time.Second)},
+			n:       80,
+			arrival: func(k int) time.Duration {
+				if k <= 50 {
+					return seconds(math.Sqrt(2 * float64(k)))
+				}
+				return seconds(10 + float64(k-50)/10)
+			},
+		},
+		{
+			// no device during the first step, 5 devices/s during the second one, then 10 devices/s
+			name:    "step",
+			details: config.RampUpDetails{Profile: "step", StartRate: 0, EndRate: 10, Steps: 2, Duration: config.TimeDuration(10 * time.Second)},
+			n:       40,
+			arrival: func(k int) time.Duration {
+				switch {
+				case k == 0:
+					return 0
+				case k <= 25:
+					return seconds(5 + float64(k)/5)
+				}
+				return seconds(10 + float64(k-25)/10)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile, err := newRampProfile(test.details)
+			if err != nil {
+				t.Fatalf("newRampProfile: %s", err)
+			}
+
+			arrivals := profile.schedule(rand.New(rand.NewSource(1)), test.n)
+			if len(arrivals) != test.n {
+				t.Fatalf("got %d arrivals, want %d", len(arrivals), test.n)
+			}
+			for k, arrival := range arrivals {
+				want := test.arrival(k)
+				if diff := arrival - want; diff > scheduleTolerance || diff < -scheduleTolerance {
+					t.Errorf("arrival %d: got %s, want %s", k, arrival, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRampProfileSchedulePoisson(t *testing.T) {
+	details := config.RampUpDetails{Profile: "constant", EndRate: 100, Poisson: true}
+	profile, err := newRampProfile(details)
+	if err != nil {
+		t.Fatalf("newRampProfile: %s", err)
+	}
+
+	n := 10000
+	arrivals := profile.schedule(rand.New(rand.NewSource(42)), n)
+	if len(arrivals) != n {
+		t.Fatalf("got %d arrivals, want %d", len(arrivals), n)
+	}
+	for k := 1; k < n; k++ {
+		if arrivals[k] < arrivals[k-1] {
+			t.Fatalf("arrival %d (%s) before arrival %d (%s)", k, arrivals[k], k-1, arrivals[k-1])
+		}
+	}
+
+	// the arrivals are exponentially distributed, so the mean inter-arrival time is 1/rate
+	mean := arrivals[n-1].Seconds() / float64(n-1)
+	if math.Abs(mean-0.01) > 0.0005 {
+		t.Errorf("mean inter-arrival time: got %fs, want 0.01s", mean)
+	}
+
+	// the same seed gives the same schedule, so that the scenario can be reproduced
+	again := profile.schedule(rand.New(rand.NewSource(42)), n)
+	for k := range arrivals {
+		if arrivals[k] != again[k] {
+			t.Fatalf("arrival %d: got %s then %s with the same seed", k, arrivals[k], again[k])
+		}
+	}
+}
+
+func TestNewRampProfileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		details config.RampUpDetails
+	}{
+		{"unknown profile", config.RampUpDetails{Profile: "sine", EndRate: 1}},
+		{"step without steps", config.RampUpDetails{Profile: "step", EndRate: 1, Duration: config.TimeDuration(time.Second)}},
+		{"negative start rate", config.RampUpDetails{Profile: "linear", StartRate: -1, EndRate: 1, Duration: config.TimeDuration(time.Second)}},
+		{"zero end rate", config.RampUpDetails{Profile: "constant"}},
+		{"linear without duration", config.RampUpDetails{Profile: "linear", EndRate: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newRampProfile(test.details); err == nil {
+				t.Errorf("newRampProfile(%+v) succeeded, want an error", test.details)
+			}
+		})
+	}
+}
+
+// seconds converts a number of seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,66 @@
+package simulation
+
+import (
+	"sort"
+	"sync"
+)
+
+// requestKey identifies the requests sent to the same platform endpoint with the same result
+type requestKey struct {
+	endpoint   string
+	statusCode int
+}
+
+// requestStore is a thread-safe counter of the requests sent by the devices to the platform
+type requestStore struct {
+	*sync.Mutex
+
+	requests map[requestKey]int64
+	errors   map[string]int64 // failed requests (transport error or non-2xx status code) per endpoint
+}
+
+// newRequestStore creates a new instance of the request counters
+func newRequestStore() *requestStore {
+	return &requestStore{
+		Mutex:    &sync.Mutex{},
+		requests: map[requestKey]int64{},
+		errors:   map[string]int64{},
+	}
+}
+
+// storeRequest counts a request sent to the endpoint. A zero status code means that no response was received,
+// or that the transport has no status codes (e.g. MQTT)
+func (s *requestStore) storeRequest(endpoint string, statusCode int, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.requests[requestKey{endpoint: endpoint, statusCode: statusCode}] += 1
+	if err != nil || statusCode > 299 {
+		s.errors[endpoint] += 1
+	}
+}
+
+// sortedRequestKeys returns the request keys in a stable order. The caller must hold the lock
+func (s *requestStore) sortedRequestKeys() []requestKey {
+	keys := make([]requestKey, 0, len(s.requests))
+	for key := range s.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint == keys[j].endpoint {
+			return keys[i].statusCode < keys[j].statusCode
+		}
+		return keys[i].endpoint < keys[j].endpoint
+	})
+	return keys
+}
+
+// sortedErrorEndpoints returns the endpoints with failed requests in a stable order. The caller must hold the lock
+func (s *requestStore) sortedErrorEndpoints() []string {
+	endpoints := make([]string, 0, len(s.errors))
+	for endpoint := range s.errors {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
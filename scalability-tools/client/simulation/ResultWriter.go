@@ -0,0 +1,480 @@
+package simulation
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// SimulationMetadata describes the simulation that produced the results
+type SimulationMetadata struct {
+	Target     string `json:"Target"`
+	Task       string `json:"Task"`
+	Factory    string `json:"Factory"`
+	Seed       int64  `json:"Seed"`
+	ConfigHash string `json:"Config-Hash"`
+}
+
+// SimulationSummary is the final summary of the simulation results
+type SimulationSummary struct {
+	Total        int32     `json:"Total"`
+	SuccessCount int32     `json:"Success"`
+	FinishCount  int32     `json:"Finished"`
+	StartAt      time.Time `json:"StartAt"`
+	Duration     float64   `json:"Duration"`
+	Avg          float64   `json:"Device-Avg-Time"`
+	Max          float64   `json:"Device-Max-Time"`
+	Min          float64   `json:"Device-Min-Time"`
+	Std          float64   `json:"Device-Std-Time"`
+	P50          float64   `json:"Device-P50-Time"`
+	P90          float64   `json:"Device-P90-Time"`
+	P95          float64   `json:"Device-P95-Time"`
+	P99          float64   `json:"Device-P99-Time"`
+	P999         float64   `json:"Device-P99.9-Time"`
+
+	Reboots         int32 `json:"Reboots,omitempty"`
+	RebootedDevices int32 `json:"Rebooted-Devices,omitempty"`
+	RebootedSuccess int32 `json:"Rebooted-Success,omitempty"`
+
+	CancelCount int32 `json:"Cancelled,omitempty"`
+	RejectCount int32 `json:"Rejected,omitempty"`
+}
+
+type PhaseResult struct {
+	Phase string `json:"Phase"`
+	DurationSummary
+}
+
+type DeviceResult struct {
+	ID    string `json:"Device"`
+	Class string `json:"Class,omitempty"`
+	SimulationResult
+}
+
+// SimulationReport is the snapshot of the simulation results given to the result writers
+type SimulationReport struct {
+	Metadata   SimulationMetadata `json:"Metadata"`
+	Summary    SimulationSummary  `json:"Summary"`
+	Phases     []PhaseResult      `json:"Phases"`
+	Assertions []AssertionResult  `json:"Assertions,omitempty"`
+	Classes    []ClassResult      `json:"Classes,omitempty"`
+	Devices    []DeviceResult     `json:"Devices"`
+}
+
+// ConnectSummary is the final summary of the devices connection results
+type ConnectSummary struct {
+	Total          int32           `json:"Total"`
+	SuccessCount   int32           `json:"Success"`
+	FailureCount   int32           `json:"Failure"`
+	StartAt        time.Time       `json:"StartAt"`
+	Duration       float64         `json:"Duration"`
+	Latency        DurationSummary `json:"Connect-Time"`
+	FailureLatency DurationSummary `json:"Failed-Connect-Time"`
+}
+
+// ConnectReport is the snapshot of the devices connection results given to the result writers
+type ConnectReport struct {
+	Metadata SimulationMetadata `json:"Metadata"`
+	Summary  ConnectSummary     `json:"Summary"`
+	Devices  []DeviceResult     `json:"Devices"`
+}
+
+// newSimulationMetadata creates the metadata of a simulation. The raw configuration is identified by its SHA256 hash
+func newSimulationMetadata(target string, task string, factory string, seed int64, rawConfig []byte) SimulationMetadata {
+	hash := sha256.Sum256(rawConfig)
+	return SimulationMetadata{
+		Target:     target,
+		Task:       task,
+		Factory:    factory,
+		Seed:       seed,
+		ConfigHash: hex.EncodeToString(hash[:]),
+	}
+}
+
+// resultWriter stores a simulation report to disk in a specific format
+type resultWriter interface {
+	// write stores the report. opth is the path of the analysis file, the writer is free to change its extension
+	write(report *SimulationReport, opth string) error
+	// writeConnect stores the connection report, with the same rules as write
+	writeConnect(report *ConnectReport, opth string) error
+}
+
+// newResultWriters creates the writers for the given output formats. The text format is used by default
+func newResultWriters(formats []string) (writers []resultWriter, err error) {
+	if len(formats) == 0 {
+		formats = []string{"text"}
+	}
+
+	for _, format := range formats {
+		switch format {
+		case "text":
+			writers = append(writers, textResultWriter{})
+		case "json":
+			writers = append(writers, jsonResultWriter{})
+		case "csv":
+			writers = append(writers, csvResultWriter{})
+		default:
+			return nil, xerrors.Errorf("Unrecognized output format %s", format)
+		}
+	}
+	return writers, nil
+}
+
+// writeReport stores the report to the target path with every given writer
+func writeReport(report *SimulationReport, opth string, writers []resultWriter) error {
+	for _, writer := range writers {
+		err := writer.write(report, opth)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeConnectReport stores the connection report to the target path with every given writer
+func writeConnectReport(report *ConnectReport, opth string, writers []resultWriter) error {
+	for _, writer := range writers {
+		err := writer.writeConnect(report, opth)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortDeviceResults orders the devices by start time, then by identifier, so that the results are stable between writers
+func sortDeviceResults(devices []DeviceResult) {
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].StartAt.Equal(devices[j].StartAt) {
+			return devices[i].ID < devices[j].ID
+		}
+		return devices[i].StartAt.Before(devices[j].StartAt)
+	})
+}
+
+// withExtension replaces the extension of the path
+func withExtension(opth string, extension string) string {
+	return strings.TrimSuffix(opth, filepath.Ext(opth)) + extension
+}
+
+// textResultWriter writes the historical human readable analysis file
+type textResultWriter struct{}
+
+func (textResultWriter) write(report *SimulationReport, opth string) error {
+	summary := report.Summary
+
+	buffer := []byte{}
+	buffer = append(buffer,
+		[]byte(fmt.Sprintf("Total: %d\n"+
+			"Success: %d\n"+
+			"StartAt: %d\n"+
+			"Duration: %fs\n"+
+			"Avg Execution Time per Device: %.9fs\n"+
+			"Max Execution Time per Device: %.9fs\n"+
+			"Min Execution Time per Device:: %.9fs\n"+
+			"Std: %.9f\n"+
+			"P50 Execution Time per Device: %.6fs\n"+
+			"P90 Execution Time per Device: %.6fs\n"+
+			"P95 Execution Time per Device: %.6fs\n"+
+			"P99 Execution Time per Device: %.6fs\n"+
+			"P99.9 Execution Time per Device: %.6fs\n\n",
+			summary.Total, summary.SuccessCount,
+			summary.StartAt.Unix(), summary.Duration,
+			summary.Avg, summary.Max, summary.Min, summary.Std,
+			summary.P50, summary.P90, summary.P95, summary.P99, summary.P999))...)
+
+	if len(report.Phases) > 0 {
+		buffer = append(buffer, []byte("Phase Count Avg(s) Min(s) Max(s) P50(s) P95(s) P99(s)\n")...)
+		for _, phase := range report.Phases {
+			buffer = append(buffer,
+				[]byte(fmt.Sprintf("%s %d %.9f %.9f %.9f %.6f %.6f %.6f\n", phase.Phase, phase.Count,
+					phase.Avg, phase.Min, phase.Max, phase.P50, phase.P95, phase.P99))...)
+		}
+		buffer = append(buffer, '\n')
+	}
+
+	if summary.Reboots > 0 {
+		buffer = append(buffer, []byte("Reboots Rebooted-Devices Rebooted-Success\n")...)
+		buffer = append(buffer,
+			[]byte(fmt.Sprintf("%d %d %d\n\n", summary.Reboots, summary.RebootedDevices, summary.RebootedSuccess))...)
+	}
+
+	if summary.CancelCount > 0 {
+		buffer = append(buffer, []byte(fmt.Sprintf("Cancelled: %d\n\n", summary.CancelCount))...)
+	}
+
+	if summary.RejectCount > 0 {
+		buffer = append(buffer, []byte(fmt.Sprintf("Rejected: %d\n\n", summary.RejectCount))...)
+	}
+
+	if len(report.Assertions) > 0 {
+		buffer = append(buffer, []byte("Assertion Operator Threshold Actual Passed\n")...)
+		for _, assertion := range report.Assertions {
+			buffer = append(buffer,
+				[]byte(fmt.Sprintf("%s %s %.6f %.6f %t\n", assertion.Name, assertion.Operator,
+					assertion.Threshold, assertion.Actual, assertion.Passed))...)
+		}
+		buffer = append(buffer, '\n')
+	}
+
+	if len(report.Classes) > 0 {
+		buffer = append(buffer, []byte("Class Factory Total Success Avg(s) P50(s) P95(s) P99(s)\n")...)
+		for _, class := range report.Classes {
+			buffer = append(buffer,
+				[]byte(fmt.Sprintf("%s %s %d %d %.9f %.6f %.6f %.6f\n", class.Class, class.Factory, class.Summary.Total,
+					class.Summary.SuccessCount, class.Summary.Avg, class.Summary.P50, class.Summary.P95, class.Summary.P99))...)
+		}
+		buffer = append(buffer, '\n')
+	}
+
+	buffer = append(buffer, []byte("Device StartAt Duration(s) Success\n")...)
+	for _, device := range report.Devices {
+		buffer = append(buffer,
+			[]byte(fmt.Sprintf("%s %d %.9f %t\n", device.ID, device.StartAt.Unix(), device.Duration, device.Success))...)
+	}
+
+	return os.WriteFile(opth, buffer, 0644)
+}
+
+func (textResultWriter) writeConnect(report *ConnectReport, opth string) error {
+	summary := report.Summary
+
+	buffer := []byte{}
+	buffer = append(buffer,
+		[]byte(fmt.Sprintf("Total: %d\n"+
+			"Success: %d\n"+
+			"Failure: %d\n"+
+			"StartAt: %d\n"+
+			"Duration: %fs\n"+
+			"Avg Connect Time per Device: %.9fs\n"+
+			"Max Connect Time per Device: %.9fs\n"+
+			"Min Connect Time per Device: %.9fs\n"+
+			"P50 Connect Time per Device: %.6fs\n"+
+			"P90 Connect Time per Device: %.6fs\n"+
+			"P95 Connect Time per Device: %.6fs\n"+
+			"P99 Connect Time per Device: %.6fs\n"+
+			"P99.9 Connect Time per Device: %.6fs\n\n",
+			summary.Total, summary.SuccessCount, summary.FailureCount,
+			summary.StartAt.Unix(), summary.Duration,
+			summary.Latency.Avg, summary.Latency.Max, summary.Latency.Min,
+			summary.Latency.P50, summary.Latency.P90, summary.Latency.P95, summary.Latency.P99, summary.Latency.P999))...)
+
+	buffer = append(buffer, []byte("Device StartAt Duration(s) Success\n")...)
+	for _, device := range report.Devices {
+		buffer = append(buffer,
+			[]byte(fmt.Sprintf("%s %d %.9f %t\n", device.ID, device.StartAt.Unix(), device.Duration, device.Success))...)
+	}
+
+	return os.WriteFile(opth, buffer, 0644)
+}
+
+// jsonResultWriter writes the whole report as a single JSON document
+type jsonResultWriter struct{}
+
+func (jsonResultWriter) write(report *SimulationReport, opth string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(withExtension(opth, ".json"), data, 0644)
+}
+
+func (jsonResultWriter) writeConnect(report *ConnectReport, opth string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(withExtension(opth, ".json"), data, 0644)
+}
+
+// csvResultWriter writes one row per device in a CSV file, and the metadata and summary as key-value rows in a second CSV file
+type csvResultWriter struct{}
+
+func (csvResultWriter) write(report *SimulationReport, opth string) error {
+	rows := [][]string{{"device", "start_at", "duration_s", "success"}}
+	if len(report.Classes) > 0 {
+		rows[0] = append(rows[0], "class")
+	}
+	if report.Summary.Reboots > 0 {
+		rows[0] = append(rows[0], "reboots")
+	}
+	if report.Summary.CancelCount > 0 {
+		rows[0] = append(rows[0], "cancelled")
+	}
+	for _, device := range report.Devices {
+		row := []string{
+			device.ID,
+			formatTimestamp(device.StartAt),
+			formatSeconds(device.Duration),
+			strconv.FormatBool(device.Success),
+		}
+		if len(report.Classes) > 0 {
+			row = append(row, device.Class)
+		}
+		if report.Summary.Reboots > 0 {
+			row = append(row, strconv.Itoa(device.Reboots))
+		}
+		if report.Summary.CancelCount > 0 {
+			row = append(row, strconv.FormatBool(device.Cancelled))
+		}
+		rows = append(rows, row)
+	}
+	err := writeCSV(withExtension(opth, ".csv"), rows)
+	if err != nil {
+		return err
+	}
+
+	metadata := report.Metadata
+	summary := report.Summary
+	summaryRows := [][]string{
+		{"key", "value"},
+		{"target", metadata.Target},
+		{"task", metadata.Task},
+		{"factory", metadata.Factory},
+		{"seed", strconv.FormatInt(metadata.Seed, 10)},
+		{"config_hash", metadata.ConfigHash},
+		{"total", strconv.FormatInt(int64(summary.Total), 10)},
+		{"success", strconv.FormatInt(int64(summary.SuccessCount), 10)},
+		{"finished", strconv.FormatInt(int64(summary.FinishCount), 10)},
+		{"start_at", formatTimestamp(summary.StartAt)},
+		{"duration_s", formatSeconds(summary.Duration)},
+		{"avg_s", formatSeconds(summary.Avg)},
+		{"max_s", formatSeconds(summary.Max)},
+		{"min_s", formatSeconds(summary.Min)},
+		{"std_s", formatSeconds(summary.Std)},
+		{"p50_s", formatSeconds(summary.P50)},
+		{"p90_s", formatSeconds(summary.P90)},
+		{"p95_s", formatSeconds(summary.P95)},
+		{"p99_s", formatSeconds(summary.P99)},
+		{"p99.9_s", formatSeconds(summary.P999)},
+	}
+	if summary.Reboots > 0 {
+		summaryRows = append(summaryRows,
+			[]string{"reboots", strconv.FormatInt(int64(summary.Reboots), 10)},
+			[]string{"rebooted_devices", strconv.FormatInt(int64(summary.RebootedDevices), 10)},
+			[]string{"rebooted_success", strconv.FormatInt(int64(summary.RebootedSuccess), 10)},
+		)
+	}
+	if summary.CancelCount > 0 {
+		summaryRows = append(summaryRows, []string{"cancelled", strconv.FormatInt(int64(summary.CancelCount), 10)})
+	}
+	if summary.RejectCount > 0 {
+		summaryRows = append(summaryRows, []string{"rejected", strconv.FormatInt(int64(summary.RejectCount), 10)})
+	}
+	for _, phase := range report.Phases {
+		summaryRows = append(summaryRows,
+			[]string{fmt.Sprintf("phase_%s_count", phase.Phase), strconv.FormatInt(int64(phase.Count), 10)},
+			[]string{fmt.Sprintf("phase_%s_avg_s", phase.Phase), formatSeconds(phase.Avg)},
+			[]string{fmt.Sprintf("phase_%s_p95_s", phase.Phase), formatSeconds(phase.P95)},
+			[]string{fmt.Sprintf("phase_%s_p99_s", phase.Phase), formatSeconds(phase.P99)},
+		)
+	}
+	for _, class := range report.Classes {
+		summaryRows = append(summaryRows,
+			[]string{fmt.Sprintf("class_%s_factory", class.Class), class.Factory},
+			[]string{fmt.Sprintf("class_%s_total", class.Class), strconv.FormatInt(int64(class.Summary.Total), 10)},
+			[]string{fmt.Sprintf("class_%s_success", class.Class), strconv.FormatInt(int64(class.Summary.SuccessCount), 10)},
+			[]string{fmt.Sprintf("class_%s_avg_s", class.Class), formatSeconds(class.Summary.Avg)},
+			[]string{fmt.Sprintf("class_%s_p95_s", class.Class), formatSeconds(class.Summary.P95)},
+			[]string{fmt.Sprintf("class_%s_p99_s", class.Class), formatSeconds(class.Summary.P99)},
+		)
+	}
+	for _, assertion := range report.Assertions {
+		summaryRows = append(summaryRows,
+			[]string{fmt.Sprintf("assertion_%s_threshold", assertion.Name), strconv.FormatFloat(assertion.Threshold, 'f', -1, 64)},
+			[]string{fmt.Sprintf("assertion_%s_actual", assertion.Name), strconv.FormatFloat(assertion.Actual, 'f', -1, 64)},
+			[]string{fmt.Sprintf("assertion_%s_passed", assertion.Name), strconv.FormatBool(assertion.Passed)},
+		)
+	}
+	return writeCSV(withExtension(opth, "_summary.csv"), summaryRows)
+}
+
+func (csvResultWriter) writeConnect(report *ConnectReport, opth string) error {
+	hasClasses := false
+	for _, device := range report.Devices {
+		hasClasses = hasClasses || len(device.Class) > 0
+	}
+
+	rows := [][]string{{"device", "start_at", "duration_s", "success"}}
+	if hasClasses {
+		rows[0] = append(rows[0], "class")
+	}
+	for _, device := range report.Devices {
+		row := []string{
+			device.ID,
+			formatTimestamp(device.StartAt),
+			formatSeconds(device.Duration),
+			strconv.FormatBool(device.Success),
+		}
+		if hasClasses {
+			row = append(row, device.Class)
+		}
+		rows = append(rows, row)
+	}
+	err := writeCSV(withExtension(opth, ".csv"), rows)
+	if err != nil {
+		return err
+	}
+
+	metadata := report.Metadata
+	summary := report.Summary
+	summaryRows := [][]string{
+		{"key", "value"},
+		{"target", metadata.Target},
+		{"task", metadata.Task},
+		{"factory", metadata.Factory},
+		{"seed", strconv.FormatInt(metadata.Seed, 10)},
+		{"config_hash", metadata.ConfigHash},
+		{"total", strconv.FormatInt(int64(summary.Total), 10)},
+		{"success", strconv.FormatInt(int64(summary.SuccessCount), 10)},
+		{"failure", strconv.FormatInt(int64(summary.FailureCount), 10)},
+		{"start_at", formatTimestamp(summary.StartAt)},
+		{"duration_s", formatSeconds(summary.Duration)},
+		{"avg_s", formatSeconds(summary.Latency.Avg)},
+		{"max_s", formatSeconds(summary.Latency.Max)},
+		{"min_s", formatSeconds(summary.Latency.Min)},
+		{"p50_s", formatSeconds(summary.Latency.P50)},
+		{"p90_s", formatSeconds(summary.Latency.P90)},
+		{"p95_s", formatSeconds(summary.Latency.P95)},
+		{"p99_s", formatSeconds(summary.Latency.P99)},
+		{"p99.9_s", formatSeconds(summary.Latency.P999)},
+		{"failure_avg_s", formatSeconds(summary.FailureLatency.Avg)},
+	}
+	return writeCSV(withExtension(opth, "_summary.csv"), summaryRows)
+}
+
+// writeCSV writes all the rows to a CSV file
+func writeCSV(opth string, rows [][]string) error {
+	file, err := os.Create(opth)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	err = writer.WriteAll(rows)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// formatTimestamp formats a time as Unix seconds with nanoseconds precision
+func formatTimestamp(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+// formatSeconds formats a duration in seconds
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 9, 64)
+}
@@ -0,0 +1,191 @@
+package simulation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testReport returns a report of three devices, the second one failed
+func testReport() *SimulationReport {
+	start := time.Unix(1700000000, 500000000).UTC()
+	return &SimulationReport{
+		Metadata: SimulationMetadata{Target: "hawkbit", Task: "update", Factory: "HawkbitDDIDefaultFactory", Seed: 1, ConfigHash: "abc"},
+		Summary: SimulationSummary{
+			Total: 3, SuccessCount: 2, FinishCount: 3, StartAt: start, Duration: 4,
+			Avg: 2, Max: 3, Min: 1, P50: 2, P90: 3, P95: 3, P99: 3, P999: 3,
+		},
+		Phases:     []PhaseResult{{Phase: "DOWNLOADED", DurationSummary: DurationSummary{Count: 3, Avg: 1.5}}},
+		Assertions: []AssertionResult{{Name: "success-rate", Operator: ">=", Threshold: 0.5, Actual: 2.0 / 3, Passed: true}},
+		Devices: []DeviceResult{
+			{ID: "device0", SimulationResult: SimulationResult{StartAt: start, Duration: 1, Success: true}},
+			{ID: "device1", SimulationResult: SimulationResult{StartAt: start.Add(time.Second), Duration: 3, Success: false}},
+			{ID: "device2", SimulationResult: SimulationResult{StartAt: start.Add(time.Second), Duration: 2, Success: true}},
+		},
+	}
+}
+
+// readCSV reads all the rows of a CSV file
+func readCSV(t *testing.T, opth string) [][]string {
+	t.Helper()
+	file, err := os.Open(opth)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll %s: %s", opth, err)
+	}
+	return rows
+}
+
+func TestNewResultWriters(t *testing.T) {
+	writers, err := newResultWriters(nil)
+	if err != nil || !reflect.DeepEqual(writers, []resultWriter{textResultWriter{}}) {
+		t.Errorf("got writers %v and error %v, want the text writer by default", writers, err)
+	}
+	writers, err = newResultWriters([]string{"json", "csv"})
+	if err != nil || !reflect.DeepEqual(writers, []resultWriter{jsonResultWriter{}, csvResultWriter{}}) {
+		t.Errorf("got writers %v and error %v, want the JSON and CSV writers", writers, err)
+	}
+	if _, err := newResultWriters([]string{"parquet"}); err == nil {
+		t.Error("got no error for an unknown format")
+	}
+}
+
+func TestSortDeviceResults(t *testing.T) {
+	report := testReport()
+	devices := []DeviceResult{report.Devices[2], report.Devices[1], report.Devices[0]}
+	sortDeviceResults(devices)
+	if !reflect.DeepEqual(devices, report.Devices) {
+		t.Errorf("got devices %v, want them by start time, then by identifier", devices)
+	}
+}
+
+func TestTextResultWriter(t *testing.T) {
+	opth := filepath.Join(t.TempDir(), "simulator_analysis.txt")
+	if err := (textResultWriter{}).write(testReport(), opth); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	data, err := os.ReadFile(opth)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+
+	text := string(data)
+	for _, line := range []string{
+		"Total: 3\nSuccess: 2\nStartAt: 1700000000\n",
+		"Phase Count Avg(s) Min(s) Max(s) P50(s) P95(s) P99(s)\nDOWNLOADED 3 1.500000000 ",
+		"success-rate >= 0.500000 0.666667 true\n",
+		"Device StartAt Duration(s) Success\n" +
+			"device0 1700000000 1.000000000 true\n" +
+			"device1 1700000001 3.000000000 false\n" +
+			"device2 1700000001 2.000000000 true\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("analysis file misses %q:\n%s", line, text)
+		}
+	}
+	// the optional sections are written only if needed
+	for _, section := range []string{"Reboots", "Cancelled", "Rejected", "Class"} {
+		if strings.Contains(text, section) {
+			t.Errorf("analysis file has an empty %s section:\n%s", section, text)
+		}
+	}
+}
+
+func TestJSONResultWriter(t *testing.T) {
+	opth := filepath.Join(t.TempDir(), "simulator_analysis.txt")
+	report := testReport()
+	if err := (jsonResultWriter{}).write(report, opth); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(opth), "simulator_analysis.json"))
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+
+	var got SimulationReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if !reflect.DeepEqual(&got, report) {
+		t.Errorf("got report %+v, want %+v", got, *report)
+	}
+}
+
+func TestCSVResultWriter(t *testing.T) {
+	dir := t.TempDir()
+	opth := filepath.Join(dir, "simulator_analysis.txt")
+	report := testReport()
+	report.Summary.CancelCount = 1
+	report.Devices[1].Cancelled = true
+	if err := (csvResultWriter{}).write(report, opth); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	rows := readCSV(t, filepath.Join(dir, "simulator_analysis.csv"))
+	want := [][]string{
+		{"device", "start_at", "duration_s", "success", "cancelled"},
+		{"device0", "1700000000.500000000", "1.000000000", "true", "false"},
+		{"device1", "1700000001.500000000", "3.000000000", "false", "true"},
+		{"device2", "1700000001.500000000", "2.000000000", "true", "false"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got device rows %v, want %v", rows, want)
+	}
+
+	summary := map[string]string{}
+	for _, row := range readCSV(t, filepath.Join(dir, "simulator_analysis_summary.csv"))[1:] {
+		summary[row[0]] = row[1]
+	}
+	for key, value := range map[string]string{
+		"target":                        "hawkbit",
+		"seed":                          "1",
+		"success":                       "2",
+		"avg_s":                         "2.000000000",
+		"cancelled":                     "1",
+		"phase_DOWNLOADED_count":        "3",
+		"assertion_success-rate_passed": "true",
+	} {
+		if summary[key] != value {
+			t.Errorf("got summary %s %q, want %q", key, summary[key], value)
+		}
+	}
+	if _, ok := summary["reboots"]; ok {
+		t.Error("got reboots in the summary of a simulation without reboot")
+	}
+}
+
+func TestCSVConnectResultWriter(t *testing.T) {
+	dir := t.TempDir()
+	opth := filepath.Join(dir, "simulator_connect.txt")
+	report := testReport()
+	connect := &ConnectReport{
+		Metadata: report.Metadata,
+		Summary:  ConnectSummary{Total: 3, SuccessCount: 2, FailureCount: 1, Latency: DurationSummary{Avg: 0.5}},
+		Devices:  report.Devices,
+	}
+	connect.Devices[0].Class = "gateway"
+	if err := (csvResultWriter{}).writeConnect(connect, opth); err != nil {
+		t.Fatalf("writeConnect: %s", err)
+	}
+
+	rows := readCSV(t, filepath.Join(dir, "simulator_connect.csv"))
+	if want := []string{"device", "start_at", "duration_s", "success", "class"}; !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("got header %v, want %v", rows[0], want)
+	}
+	if len(rows) != 4 || rows[1][4] != "gateway" || rows[2][4] != "" {
+		t.Errorf("got rows %v, want the class of every device", rows)
+	}
+	summary := readCSV(t, filepath.Join(dir, "simulator_connect_summary.csv"))
+	if !reflect.DeepEqual(summary[8], []string{"failure", "1"}) || !reflect.DeepEqual(summary[11], []string{"avg_s", "0.500000000"}) {
+		t.Errorf("got summary %v, want 1 failure and an average of 0.5s", summary)
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"hitachienergy/scalability-test-client/config"
 	"hitachienergy/scalability-test-client/device"
+	"hitachienergy/scalability-test-client/registry"
 	"hitachienergy/scalability-test-client/templates"
+	"io"
+	"math/rand"
 	"plugin"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -19,14 +23,21 @@ type Simulator struct {
 	config    config.Config
 	rawConfig []byte
 
-	controllers   []*device.DeviceController
-	clientFactory templates.DeviceFactory
+	controllers     []*device.DeviceController
+	clientFactories map[string]templates.DeviceFactory // per device class
+	arrivals        []time.Duration
 
 	cancel context.CancelFunc
 
-	waitgroup   *waitGroup
-	taskStats   *dataStore
-	finishChann chan struct{}
+	waitgroup     *waitGroup
+	taskStats     *dataStore
+	writers       []resultWriter
+	requestStats  *requestStore
+	connectStats  *connectStore
+	classStats    map[string]*classStore // per device class, empty if the fleet is homogeneous
+	deviceClasses map[string]string      // device identifier -> device class
+	finishChann   chan struct{}
+	assertions    atomic.Pointer[[]AssertionResult]
 
 	isReady     atomic.Bool
 	isConnected atomic.Bool
@@ -46,33 +57,90 @@ func NewSimulator(simulationConfig config.Config, rawConfig []byte, log zerolog.
 
 // SetupDevices will create and starts all devices according to the simulation configuration
 func (s *Simulator) SetupDevices(indexOffset int, influnceRange config.SimulationInfluenceCount, logger *zerolog.Logger, finishChann chan struct{}) (err error) {
+	classes, err := s.config.Client.DeviceClasses(s.config.Simulation)
+	if err != nil {
+		return err
+	}
+	if s.config.Client.HasClasses() {
+		s.config.Client.Number = 0
+		for _, class := range classes {
+			s.config.Client.Number += class.Number
+		}
+	}
 	if s.config.Client.Number <= 0 {
 		return xerrors.Errorf("Non-positive client number. Got %d", s.config.Client.Number)
 	}
 
+	// fix the seed so that the random simulation scenario can be reproduced from the results metadata
+	if s.config.Simulation.Seed == 0 {
+		s.config.Simulation.Seed = time.Now().Unix()
+	}
+
 	s.finishChann = finishChann
 	s.taskStats = newDataStore(s.config.Client.Number)
-	s.waitgroup = newWaitGroup(s.config.Client.Number)
-
-	// load platform specific devices creation scripts
-	clientFactory, err := loadClientFactory(s.config.Client.Template, s.config.Client.Factory, s.rawConfig, logger)
+	s.writers, err = newResultWriters(s.config.Output.Formats)
 	if err != nil {
 		return err
 	}
-	s.clientFactory = clientFactory
+	s.connectStats = newConnectStore(s.config.Client.Number)
+	s.requestStats = newRequestStore()
+	s.waitgroup = newWaitGroup(s.config.Client.Number)
+	s.classStats = map[string]*classStore{}
+	s.clientFactories = map[string]templates.DeviceFactory{}
+
+	// load platform specific devices creation scripts, with the arguments of each device class
+	for _, class := range classes {
+		data := s.rawConfig
+		if s.config.Client.HasClasses() {
+			s.classStats[class.Name] = newClassStore(class.Number)
+			data, err = classRawConfig(s.rawConfig, class)
+			if err != nil {
+				return err
+			}
+		}
+		clientFactory, err := loadClientFactory(class.Template, class.Factory, data, logger)
+		if err != nil {
+			return err
+		}
+		s.clientFactories[class.Name] = clientFactory
+	}
 
 	// precompute devices controllers
-	controllers, err := device.CalculateAndSetController(s.config, indexOffset, influnceRange, logger, s.waitgroup.add, s.finishDevice)
+	controllers, err := device.CalculateAndSetController(s.config, indexOffset, influnceRange, logger, device.Callbacks{
+		Connect:   s.connectDevice,
+		StartTask: s.startTask,
+		Phase:     s.reachPhase,
+		Reboot:    s.rebootDevice,
+		Cancel:    s.cancelTask,
+		Finish:    s.finishDevice,
+		Request:   s.recordRequest,
+	})
 	if err != nil {
 		return err
 	}
 	s.controllers = controllers
+	s.deviceClasses = map[string]string{}
+	for _, controller := range controllers {
+		s.deviceClasses[controller.GetIdentifier()] = controller.GetClass()
+	}
+
+	// precompute devices arrival times for the ramp registration mode
+	if s.config.Client.DevicesRegisterMode == "ramp" {
+		profile, err := newRampProfile(s.config.Client.RampUp)
+		if err != nil {
+			return err
+		}
+		r := rand.New(rand.NewSource(s.config.Simulation.Seed))
+		s.arrivals = profile.schedule(r, len(s.controllers))
+	}
 
 	s.isReady.Store(true)
 
 	return nil
 }
 
+// StartDevices creates and connects all the devices according to the registration mode.
+// Devices that fail to connect abort the simulation, unless the rejections are measured (see keepRejected)
 func (s *Simulator) StartDevices() (err error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	s.cancel = cancel
@@ -80,19 +148,37 @@ func (s *Simulator) StartDevices() (err error) {
 	failureCount := 0
 	switch s.config.Client.DevicesRegisterMode {
 	case "parallel":
-		failureCount = s.parallelRegister(ctx, s.clientFactory)
+		failureCount = s.parallelRegister(ctx)
 	case "sequential":
-		failureCount = s.sequentialRegister(ctx, s.clientFactory)
+		failureCount = s.sequentialRegister(ctx)
+	case "ramp":
+		failureCount = s.rampRegister(ctx)
 	default:
 		return xerrors.Errorf("Unrecognized devices registration mode %s", s.config.Client.DevicesRegisterMode)
 	}
 	if failureCount > 0 {
-		return xerrors.Errorf("Fail to create and connect all devices. Fail: %d, Total: %d", failureCount, s.config.Client.Number)
+		if !s.keepRejected() {
+			return xerrors.Errorf("Fail to create and connect all devices. Fail: %d, Total: %d", failureCount, s.config.Client.Number)
+		}
+		// the rejections are part of the measurement, the other devices go on with their task
+		s.log.Warn().Msgf("Devices rejected during the registration. Rejected: %d, Total: %d", failureCount, s.config.Client.Number)
 	}
 	s.isConnected.Store(true)
 	return nil
 }
 
+// keepRejected checks whether the simulation goes on after registration failures: the rejections are measured in ramp mode,
+// and in parallel mode when the connect failure rate is asserted. The sequential mode stops at the first failure
+func (s *Simulator) keepRejected() bool {
+	switch s.config.Client.DevicesRegisterMode {
+	case "ramp":
+		return true
+	case "parallel":
+		return s.config.Simulation.Assertions.MaxConnectFailureRate != nil
+	}
+	return false
+}
+
 // StopDevices stops and clean all the devices
 func (s *Simulator) StopDevices() (err error) {
 	if s.cancel != nil {
@@ -123,30 +209,163 @@ func (s *Simulator) IsConnected() bool {
 	return s.isConnected.Load()
 }
 
-// GetProcess returns the in-time statistics of the simulation
+// IsEvaluated shows if the assertions are evaluated, i.e. the statistics of the simulation are final
+func (s *Simulator) IsEvaluated() bool {
+	return s.assertions.Load() != nil
+}
+
+// GetProcess returns the in-time statistics of the simulation. Assertions are only reported once evaluated
 func (s *Simulator) GetProcess() SimulationStats {
-	return s.taskStats.getStatistics()
+	stats := s.taskStats.getStatistics()
+	if assertions := s.assertions.Load(); assertions != nil {
+		stats.Assertions = *assertions
+	}
+	if len(s.classStats) > 0 {
+		stats.Classes = map[string]SimulationStats{}
+		for name, class := range s.classStats {
+			stats.Classes[name] = class.taskStats.getStatistics()
+		}
+	}
+	return stats
+}
+
+// EvaluateAssertions checks the service level objectives of the simulation and returns true if all of them passed.
+// It is meant to be called once at the end of the simulation, before saving the results
+func (s *Simulator) EvaluateAssertions() bool {
+	assertions := evaluateAssertions(s.config.Simulation.Assertions, s.taskStats.getStatistics(), s.connectStats.getStatistics())
+	s.assertions.Store(&assertions)
+
+	for _, assertion := range assertions {
+		if !assertion.Passed {
+			s.log.Error().Msgf("Assertion %s failed: %f %s %f is false", assertion.Name, assertion.Actual, assertion.Operator, assertion.Threshold)
+		}
+	}
+	return assertionsPassed(assertions)
+}
+
+// GetConnectStats returns the in-time statistics of the devices connection
+func (s *Simulator) GetConnectStats() ConnectStats {
+	stats := s.connectStats.getStatistics()
+	if len(s.classStats) > 0 {
+		stats.Classes = map[string]ConnectStats{}
+		for name, class := range s.classStats {
+			stats.Classes[name] = class.connectStats.getStatistics()
+		}
+	}
+	return stats
+}
+
+// WriteMetrics writes the in-time statistics of the simulation in the OpenMetrics text format
+func (s *Simulator) WriteMetrics(w io.Writer) error {
+	return writeMetrics(w, s.taskStats, s.connectStats, s.requestStats, s.classStats)
 }
 
 // SaveResult saves the simulation results to the target path
 func (s *Simulator) SaveResult(opth string) error {
-	return s.taskStats.saveToDisk(opth)
+	metadata := newSimulationMetadata(s.config.Target, s.config.Simulation.Task, s.factoryNames(), s.config.Simulation.Seed, s.rawConfig)
+	report := s.taskStats.report(metadata)
+	if assertions := s.assertions.Load(); assertions != nil {
+		report.Assertions = *assertions
+	}
+	if len(s.classStats) > 0 {
+		s.addClassResults(report)
+	}
+	return writeReport(report, opth, s.writers)
+}
+
+// SaveConnectResult saves the devices connection results to the target path
+func (s *Simulator) SaveConnectResult(opth string) error {
+	metadata := newSimulationMetadata(s.config.Target, s.config.Simulation.Task, s.factoryNames(), s.config.Simulation.Seed, s.rawConfig)
+	report := s.connectStats.report(metadata)
+	if len(s.classStats) > 0 {
+		for i := range report.Devices {
+			report.Devices[i].Class = s.deviceClasses[report.Devices[i].ID]
+		}
+	}
+	return writeConnectReport(report, opth, s.writers)
+}
+
+// connectDevice respresents the logic that need to be done when each device connects (or fails to connect) to the server
+// It is passed to the controller to be triggered for each device
+func (s *Simulator) connectDevice(id string, start time.Time, duration time.Duration, success bool) {
+	s.connectStats.storeState(id, start, duration, success)
+	class, hasClass := s.classStats[s.deviceClasses[id]]
+	if hasClass {
+		class.connectStats.storeState(id, start, duration, success)
+	}
+	s.waitgroup.add(success)
+
+	// a device that failed to connect never finishes its task, it must not hold the end of the simulation
+	if !success {
+		finish := s.taskStats.storeReject(id)
+		if hasClass {
+			class.taskStats.storeReject(id)
+		}
+		if finish && s.finishChann != nil {
+			s.finishChann <- struct{}{}
+		}
+	}
 }
 
 // finishDevice respresents the logic that need to be done when each device finishes it simulation
 // It is passed to the controller to be triggered for each device
 func (s *Simulator) finishDevice(id string, start time.Time, duration time.Duration, success bool) {
 	finish := s.taskStats.storeState(id, start, duration, success)
+	if class, ok := s.classStats[s.deviceClasses[id]]; ok {
+		class.taskStats.storeState(id, start, duration, success)
+	}
 	if finish && s.finishChann != nil {
 		s.finishChann <- struct{}{}
 	}
 }
 
+// startTask respresents the logic that need to be done when each device starts its task
+// It is passed to the controller to be triggered for each device
+func (s *Simulator) startTask(id string) {
+	s.taskStats.storeStart(id)
+	if class, ok := s.classStats[s.deviceClasses[id]]; ok {
+		class.taskStats.storeStart(id)
+	}
+}
+
+// recordRequest respresents the logic that need to be done when a device sends a request to the platform
+// It is passed to the controller to be triggered for each request
+func (s *Simulator) recordRequest(endpoint string, statusCode int, err error) {
+	s.requestStats.storeRequest(endpoint, statusCode, err)
+}
+
+// reachPhase respresents the logic that need to be done when a device reaches a new phase of its task
+// It is passed to the controller to be triggered for each device
+func (s *Simulator) reachPhase(id string, phase string, duration time.Duration) {
+	s.taskStats.storePhase(phase, duration)
+	if class, ok := s.classStats[s.deviceClasses[id]]; ok {
+		class.taskStats.storePhase(phase, duration)
+	}
+}
+
+// rebootDevice respresents the logic that need to be done when a crashed device goes offline before its reboot
+// It is passed to the controller to be triggered for each reboot
+func (s *Simulator) rebootDevice(id string) {
+	s.taskStats.storeReboot(id)
+	if class, ok := s.classStats[s.deviceClasses[id]]; ok {
+		class.taskStats.storeReboot(id)
+	}
+}
+
+// cancelTask respresents the logic that need to be done when the platform cancels the task of a device
+// It is passed to the controller to be triggered before the task finishes
+func (s *Simulator) cancelTask(id string) {
+	s.taskStats.storeCancel(id)
+	if class, ok := s.classStats[s.deviceClasses[id]]; ok {
+		class.taskStats.storeCancel(id)
+	}
+}
+
 // sequentialRegister connects all the devices to the server sequentially
-func (s *Simulator) sequentialRegister(ctx context.Context, clientFactory templates.DeviceFactory) (failureCount int) {
+func (s *Simulator) sequentialRegister(ctx context.Context) (failureCount int) {
 	s.log.Info().Msg("Starting devices registration in sequential mode ")
 	for _, controller := range s.controllers {
-		err := controller.NewDevice(ctx, clientFactory)
+		err := controller.NewDevice(ctx, s.clientFactories[controller.GetClass()])
 		if err != nil {
 			log.Err(err).Send()
 			failureCount += 1
@@ -163,18 +382,20 @@ func (s *Simulator) sequentialRegister(ctx context.Context, clientFactory templa
 }
 
 // paralleRegister connects all the devices to the server in parallel
-func (s *Simulator) parallelRegister(ctx context.Context, clientFactory templates.DeviceFactory) (failureCount int) {
+func (s *Simulator) parallelRegister(ctx context.Context) (failureCount int) {
 	s.log.Info().Msg("Starting devices registration in parallel mode ")
 	for idx, controller := range s.controllers {
 		go func(idx int, controller *device.DeviceController) {
-			err := controller.NewDevice(ctx, clientFactory)
+			err := controller.NewDevice(ctx, s.clientFactories[controller.GetClass()])
 			if err != nil {
 				log.Err(err).Send()
+				controller.Connect(false)
 				return
 			}
 			err = controller.StartDevice()
 			if err != nil {
 				log.Err(err).Send()
+				controller.Connect(false)
 				return
 			}
 		}(idx, controller)
@@ -183,7 +404,70 @@ func (s *Simulator) parallelRegister(ctx context.Context, clientFactory template
 	return failureCount
 }
 
+// rampRegister connects the devices to the server following the precomputed arrival times of the ramp profile.
+// Failures do not stop the registration so that the rejection rate can be observed
+func (s *Simulator) rampRegister(ctx context.Context) (failureCount int) {
+	rampUp := s.config.Client.RampUp
+	s.log.Info().Msgf("Starting devices registration in ramp mode (profile: %s, rate: %.2f -> %.2f devices/s over %s, poisson: %t)",
+		rampUp.Profile, rampUp.StartRate, rampUp.EndRate, time.Duration(rampUp.Duration), rampUp.Poisson)
+
+	// the connection results are saved once the registration returns, so the launched registrations are waited for
+	var launched sync.WaitGroup
+	start := time.Now()
+	for idx, controller := range s.controllers {
+		select {
+		case <-ctx.Done():
+			launched.Wait()
+			return len(s.controllers) - idx
+		case <-time.After(time.Until(start.Add(s.arrivals[idx]))):
+		}
+
+		launched.Add(1)
+		go func(controller *device.DeviceController) {
+			defer launched.Done()
+			err := controller.NewDevice(ctx, s.clientFactories[controller.GetClass()])
+			if err != nil {
+				log.Err(err).Send()
+				controller.Connect(false)
+				return
+			}
+			err = controller.StartDevice()
+			if err != nil {
+				log.Err(err).Send()
+				controller.Connect(false)
+				return
+			}
+		}(controller)
+	}
+	failureCount = <-s.waitgroup.readyChan
+	return failureCount
+}
+
+// loadClientFactory resolves the device factory against the factory registry.
+// If the factory is not registered, it is looked up in the plugin at the given path
 func loadClientFactory(path string, factoryName string, data []byte, logger *zerolog.Logger) (factory templates.DeviceFactory, err error) {
+	factory, ok := registry.Get(factoryName)
+	if !ok {
+		if len(path) == 0 {
+			return nil, xerrors.Errorf("Unknown client factory %s. Registered factories: %v", factoryName, registry.Names())
+		}
+		logger.Info().Msgf("Client factory %s is not registered, loading it from plugin %s", factoryName, path)
+		factory, err = loadPluginFactory(path, factoryName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	factory, err = factory.ParseConfig(data)
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid YAML config structure.")
+	}
+
+	return factory, nil
+}
+
+// loadPluginFactory loads a device factory exported by a Go plugin
+func loadPluginFactory(path string, factoryName string) (factory templates.DeviceFactory, err error) {
 	p, err := plugin.Open(path)
 	if err != nil {
 		return factory, err
@@ -199,10 +483,5 @@ func loadClientFactory(path string, factoryName string, data []byte, logger *zer
 		return factory, xerrors.Errorf("Invalid client factory interface %s: %s", factoryName, path)
 	}
 
-	factory, err = factory.ParseConfig(data)
-	if err != nil {
-		return nil, xerrors.Errorf("Invalid YAML config structure.")
-	}
-
 	return factory, nil
 }
@@ -0,0 +1,233 @@
+package simulation
+
+import (
+	"context"
+	"hitachienergy/scalability-test-client/config"
+	"hitachienergy/scalability-test-client/registry"
+	"hitachienergy/scalability-test-client/templates"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/xerrors"
+)
+
+// TEST_FACTORY is the name of the device factory registered by the simulator tests
+const TEST_FACTORY = "SimulatorTestFactory"
+
+// testFactory creates devices that connect and complete their task as soon as they start, except the rejected ones
+type testFactory struct {
+	sync.Mutex
+	rejected     map[int]bool
+	connectDelay time.Duration
+	started      []int // indexes of the started devices, in order
+}
+
+var factory = &testFactory{}
+
+func init() {
+	registry.Register(TEST_FACTORY, factory)
+}
+
+// reset clears the devices started by the previous test
+func (f *testFactory) reset(rejected []int, connectDelay time.Duration) {
+	f.Lock()
+	defer f.Unlock()
+	f.rejected = map[int]bool{}
+	for _, idx := range rejected {
+		f.rejected[idx] = true
+	}
+	f.connectDelay = connectDelay
+	f.started = nil
+}
+
+// startedDevices returns the indexes of the started devices, in order
+func (f *testFactory) startedDevices() []int {
+	f.Lock()
+	defer f.Unlock()
+	return append([]int{}, f.started...)
+}
+
+func (f *testFactory) ParseConfig(data []byte) (templates.DeviceFactory, error) {
+	return f, nil
+}
+
+func (f *testFactory) NewDevice(controller templates.Controller) (templates.Device, error) {
+	return &testDevice{factory: f, controller: controller}, nil
+}
+
+type testDevice struct {
+	factory    *testFactory
+	controller templates.Controller
+}
+
+func (d *testDevice) Start(ctx context.Context) error {
+	d.factory.Lock()
+	d.factory.started = append(d.factory.started, d.controller.GetIndex())
+	rejected, delay := d.factory.rejected[d.controller.GetIndex()], d.factory.connectDelay
+	d.factory.Unlock()
+
+	time.Sleep(delay)
+	if rejected {
+		d.controller.Connect(false)
+		return xerrors.Errorf("Device %s rejected", d.controller.GetIdentifier())
+	}
+	d.controller.Connect(true)
+	d.controller.StartTask()
+	d.controller.CompleteTask(true)
+	return nil
+}
+
+func (d *testDevice) Stop() error {
+	return nil
+}
+
+// newTestSimulator sets up a simulator of devices created by the test factory
+func newTestSimulator(t *testing.T, client config.ClientDefaultConfig, simulation config.SimulationConfig) (*Simulator, chan struct{}) {
+	client.Factory = TEST_FACTORY
+	client.NamePrefix = "device"
+	simulation.Task = "update"
+	simulation.Seed = 1
+	simulatorConfig := config.Config{Client: client, Simulation: simulation, Output: config.OutputDefaultConfig{Path: t.TempDir()}}
+
+	simulator := NewSimulator(simulatorConfig, nil, zerolog.Nop())
+	logger := zerolog.Nop()
+	finishChann := make(chan struct{}, 1)
+	err := simulator.SetupDevices(0, config.SimulationInfluenceCount{}, &logger, finishChann)
+	if err != nil {
+		t.Fatalf("SetupDevices: %s", err)
+	}
+	t.Cleanup(func() { simulator.StopDevices() })
+	return simulator, finishChann
+}
+
+// waitFinish waits for all the devices to finish their task or to be rejected
+func waitFinish(t *testing.T, finishChann chan struct{}) {
+	t.Helper()
+	select {
+	case <-finishChann:
+	case <-time.After(5 * time.Second):
+		t.Fatal("simulation not finished after 5s")
+	}
+}
+
+func TestSequentialRegisterStopsAtFirstFailure(t *testing.T) {
+	factory.reset([]int{2}, 0)
+	simulator, _ := newTestSimulator(t, config.ClientDefaultConfig{Number: 5, DevicesRegisterMode: "sequential"}, config.SimulationConfig{})
+
+	if err := simulator.StartDevices(); err == nil {
+		t.Fatal("StartDevices: got no error, want the registration failure")
+	}
+	if started := factory.startedDevices(); !reflect.DeepEqual(started, []int{0, 1, 2}) {
+		t.Errorf("got started devices %v, want [0 1 2]", started)
+	}
+	if simulator.IsConnected() {
+		t.Error("simulator connected after a registration failure")
+	}
+}
+
+func TestRampRegisterRecordsRejections(t *testing.T) {
+	factory.reset([]int{1, 3}, 0)
+	client := config.ClientDefaultConfig{Number: 5, DevicesRegisterMode: "ramp", RampUp: config.RampUpDetails{EndRate: 100}}
+	simulator, finishChann := newTestSimulator(t, client, config.SimulationConfig{})
+
+	if err := simulator.StartDevices(); err != nil {
+		t.Fatalf("StartDevices: %s", err)
+	}
+	waitFinish(t, finishChann)
+
+	started := factory.startedDevices()
+	sort.Ints(started)
+	if !reflect.DeepEqual(started, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("got started devices %v, want all of them", started)
+	}
+	connectStats := simulator.GetConnectStats()
+	if connectStats.SuccessCount != 3 || connectStats.FailureCount != 2 {
+		t.Errorf("got %d connected and %d rejected devices, want 3 and 2", connectStats.SuccessCount, connectStats.FailureCount)
+	}
+	stats := simulator.GetProcess()
+	// the rejected devices never run their task
+	if stats.SuccessCount != 3 || stats.FinishCount != 3 || stats.RejectCount != 2 {
+		t.Errorf("got %d successful, %d finished and %d rejected tasks, want 3, 3 and 2", stats.SuccessCount, stats.FinishCount, stats.RejectCount)
+	}
+}
+
+func TestParallelRegisterRejections(t *testing.T) {
+	failureRate := config.Percentage(0.5)
+	tests := []struct {
+		name       string
+		assertions config.AssertionsDetails
+		wantErr    bool
+	}{
+		{"aborted", config.AssertionsDetails{}, true},
+		{"measured by the connect failure rate assertion", config.AssertionsDetails{MaxConnectFailureRate: &failureRate}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			factory.reset([]int{0, 4}, 0)
+			client := config.ClientDefaultConfig{Number: 5, DevicesRegisterMode: "parallel"}
+			simulator, finishChann := newTestSimulator(t, client, config.SimulationConfig{Assertions: test.assertions})
+
+			err := simulator.StartDevices()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("StartDevices: got error %v, want error %t", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			waitFinish(t, finishChann)
+
+			if simulator.IsEvaluated() {
+				t.Error("assertions evaluated before the end of the simulation")
+			}
+			if !simulator.EvaluateAssertions() {
+				t.Errorf("assertions failed: %+v", simulator.GetProcess().Assertions)
+			}
+			want := []AssertionResult{{Name: "connect-failure-rate", Operator: "<=", Threshold: 0.5, Actual: 0.4, Passed: true}}
+			if got := simulator.GetProcess().Assertions; !simulator.IsEvaluated() || !reflect.DeepEqual(got, want) {
+				t.Errorf("got assertions %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRampRegisterCancelWaitsForLaunchedDevices(t *testing.T) {
+	// devices 0 and 1 arrive before the cancellation, and connect after it
+	factory.reset(nil, 300*time.Millisecond)
+	client := config.ClientDefaultConfig{Number: 5, DevicesRegisterMode: "ramp", RampUp: config.RampUpDetails{EndRate: 10}}
+	simulator, _ := newTestSimulator(t, client, config.SimulationConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if notLaunched := simulator.rampRegister(ctx); notLaunched != 3 {
+		t.Errorf("got %d devices not launched, want 3", notLaunched)
+	}
+	if connectStats := simulator.GetConnectStats(); connectStats.SuccessCount != 2 {
+		t.Errorf("got %d connected devices when the registration returned, want 2", connectStats.SuccessCount)
+	}
+}
+
+func TestLoadClientFactory(t *testing.T) {
+	logger := zerolog.Nop()
+
+	if got, err := loadClientFactory("", TEST_FACTORY, nil, &logger); err != nil || got != factory {
+		t.Errorf("got factory %v and error %v, want the registered factory", got, err)
+	}
+	// an unregistered factory is loaded from the plugin, if any
+	if _, err := loadClientFactory("", "UnknownFactory", nil, &logger); err == nil || !strings.Contains(err.Error(), TEST_FACTORY) {
+		t.Errorf("got error %v, want the registered factories listed", err)
+	}
+	if _, err := loadClientFactory(filepath.Join(t.TempDir(), "missing.so"), "UnknownFactory", nil, &logger); err == nil {
+		t.Error("got no error for a missing plugin")
+	}
+	// the registered factory takes precedence over the plugin
+	if _, err := loadClientFactory(filepath.Join(t.TempDir(), "missing.so"), TEST_FACTORY, nil, &logger); err != nil {
+		t.Errorf("got error %v, want the registered factory without loading the plugin", err)
+	}
+}
@@ -2,6 +2,8 @@ package templates
 
 import (
 	"context"
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/network"
 
 	"github.com/panjf2000/ants"
 	"github.com/rs/zerolog"
@@ -18,10 +20,21 @@ type Controller interface {
 	// interactions with the Device
 	Connect(success bool)
 	StartTask()
+	MarkPhase(phase string)
 	CompleteTask(success bool)
+	CancelTask()
+	ReportRequest(endpoint string, statusCode int, err error)
+
+	// state persisted by the device across its reboots, e.g. a partial download. It is cleared once the task is completed
+	TakeState(key string) (state interface{}, ok bool)
+	KeepState(key string, state interface{})
 
 	// getters and utils
 	GetIdentifier() string
+	GetIndex() int
 	GetLogger() *zerolog.Logger
 	GetScheduler() *ants.Pool
+	GetNetwork() *network.Shaper
+	GetDownloadFault() *fault.Download
+	GetUpdateOutcome() fault.UpdateOutcome
 }
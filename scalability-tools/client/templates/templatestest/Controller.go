@@ -0,0 +1,209 @@
+// Package templatestest provides a fake Controller to test the device implementations against the mock platforms,
+// without the simulator
+package templatestest
+
+import (
+	"context"
+	"sync"
+
+	"hitachienergy/scalability-test-client/fault"
+	"hitachienergy/scalability-test-client/network"
+	"hitachienergy/scalability-test-client/templates"
+
+	"github.com/panjf2000/ants"
+	"github.com/rs/zerolog"
+)
+
+// Controller is a fake templates.Controller recording the interactions of a single device. The device has no network
+// profile nor download fault. Its tasks are run by a scheduler of one worker, like the simulated devices
+type Controller struct {
+	id        string
+	index     int
+	logger    zerolog.Logger
+	scheduler *ants.Pool
+	outcome   fault.UpdateOutcome
+
+	sync.Mutex
+	connects  []bool
+	started   int
+	phases    []string
+	success   bool
+	cancelled bool
+	done      chan struct{}
+	requests  map[string][]int // status codes of the requests, per endpoint
+	errors    int
+	states    map[string]interface{}
+}
+
+// NewController creates a fake controller for the device with the given identifier and update outcome
+func NewController(id string, index int, outcome fault.UpdateOutcome) *Controller {
+	scheduler, _ := ants.NewPool(1)
+	return &Controller{
+		id:        id,
+		index:     index,
+		logger:    zerolog.Nop(),
+		scheduler: scheduler,
+		outcome:   outcome,
+		done:      make(chan struct{}),
+		requests:  map[string][]int{},
+		states:    map[string]interface{}{},
+	}
+}
+
+// Release stops the scheduler of the device
+func (c *Controller) Release() {
+	c.scheduler.Release()
+}
+
+// Done is closed once the task of the device is completed or cancelled
+func (c *Controller) Done() <-chan struct{} {
+	return c.done
+}
+
+// Result returns whether the task of the device succeeded or was cancelled
+func (c *Controller) Result() (success bool, cancelled bool) {
+	c.Lock()
+	defer c.Unlock()
+	return c.success, c.cancelled
+}
+
+// Connects returns the results of the connections of the device
+func (c *Controller) Connects() []bool {
+	c.Lock()
+	defer c.Unlock()
+	return append([]bool{}, c.connects...)
+}
+
+// Started returns the number of times the device started its task
+func (c *Controller) Started() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.started
+}
+
+// Phases returns the phases reached by the device, in order
+func (c *Controller) Phases() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string{}, c.phases...)
+}
+
+// Requests returns the status codes of the requests sent to an endpoint (0 if no response was received)
+func (c *Controller) Requests(endpoint string) []int {
+	c.Lock()
+	defer c.Unlock()
+	return append([]int{}, c.requests[endpoint]...)
+}
+
+// Errors returns the number of failed requests
+func (c *Controller) Errors() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.errors
+}
+
+// finish records the end of the task, only the first one counts
+func (c *Controller) finish(success bool, cancelled bool) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	c.success = success
+	c.cancelled = cancelled
+	c.states = map[string]interface{}{}
+	close(c.done)
+}
+
+func (c *Controller) NewDevice(ctx context.Context, clientFactory templates.DeviceFactory) error {
+	return nil
+}
+
+func (c *Controller) StartDevice() error {
+	return nil
+}
+
+func (c *Controller) StopDevice() error {
+	return nil
+}
+
+func (c *Controller) Connect(success bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.connects = append(c.connects, success)
+}
+
+func (c *Controller) StartTask() {
+	c.Lock()
+	defer c.Unlock()
+	c.started += 1
+}
+
+func (c *Controller) MarkPhase(phase string) {
+	c.Lock()
+	defer c.Unlock()
+	c.phases = append(c.phases, phase)
+}
+
+func (c *Controller) CompleteTask(success bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.finish(success, false)
+}
+
+func (c *Controller) CancelTask() {
+	c.Lock()
+	defer c.Unlock()
+	c.finish(false, true)
+}
+
+func (c *Controller) ReportRequest(endpoint string, statusCode int, err error) {
+	c.Lock()
+	defer c.Unlock()
+	c.requests[endpoint] = append(c.requests[endpoint], statusCode)
+	if err != nil {
+		c.errors += 1
+	}
+}
+
+func (c *Controller) TakeState(key string) (state interface{}, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	state, ok = c.states[key]
+	delete(c.states, key)
+	return state, ok
+}
+
+func (c *Controller) KeepState(key string, state interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.states[key] = state
+}
+
+func (c *Controller) GetIdentifier() string {
+	return c.id
+}
+
+func (c *Controller) GetIndex() int {
+	return c.index
+}
+
+func (c *Controller) GetLogger() *zerolog.Logger {
+	return &c.logger
+}
+
+func (c *Controller) GetScheduler() *ants.Pool {
+	return c.scheduler
+}
+
+func (c *Controller) GetNetwork() *network.Shaper {
+	return nil
+}
+
+func (c *Controller) GetDownloadFault() *fault.Download {
+	return nil
+}
+
+func (c *Controller) GetUpdateOutcome() fault.UpdateOutcome {
+	return c.outcome
+}
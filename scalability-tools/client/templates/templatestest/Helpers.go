@@ -0,0 +1,65 @@
+package templatestest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// StartHTTPServer serves a mock platform on a local port until the end of the test, and returns its endpoint
+// without scheme, as configured for the devices
+func StartHTTPServer(t testing.TB, handler http.Handler) string {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// StartDevice starts a device driven by the controller. The device and its scheduler are stopped at the end of the test
+func StartDevice(t testing.TB, controller *Controller, start func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		controller.Release()
+	})
+	return start(ctx)
+}
+
+// WaitTask waits for the device to complete or cancel its task
+func WaitTask(t testing.TB, controller *Controller, timeout time.Duration) {
+	t.Helper()
+	select {
+	case <-controller.Done():
+	case <-time.After(timeout):
+		t.Fatalf("%s: task not finished after %s. Phases: %v", controller.id, timeout, controller.Phases())
+	}
+}
+
+// WaitFor polls the condition until it holds
+func WaitFor(t testing.TB, name string, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not reached after %s", name, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// CountStatus counts the requests of the devices to the endpoints that got the status code
+func CountStatus(controllers map[string]*Controller, endpoints []string, statusCode int) int {
+	count := 0
+	for _, controller := range controllers {
+		for _, endpoint := range endpoints {
+			for _, code := range controller.Requests(endpoint) {
+				if code == statusCode {
+					count += 1
+				}
+			}
+		}
+	}
+	return count
+}
@@ -27,6 +27,7 @@ CONTAINER_PORT_BASE = 8086
 SIMULATOR_ENDPOINT_HOST = "localhost"
 SIMULATOR_ENDPOINT_PORT = 8086
 VALIDATE_PERIOD = 10
+ASSERTIONS_FAILED_EXIT_CODE = 2
 
 
 class DevicesHandler:
@@ -174,8 +175,8 @@ class BaseDevicesHandler(DevicesHandler):
                     )
             return affected
 
-        num_of_clients = self.data["client"]["numberOfDevices"]
-        num_of_containers = self.data["client"]["numberOfContainers"]
+        num_of_clients = self.num_of_devices
+        num_of_containers = self.num_of_containers
 
         num_of_dummy_workers = _count_affected_devices("dummyWork", num_of_clients)
         dummy_workers_per_container = _split(num_of_dummy_workers, num_of_containers)
@@ -183,9 +184,20 @@ class BaseDevicesHandler(DevicesHandler):
         num_of_crash_workers = _count_affected_devices("crash", num_of_clients)
         crash_workers_per_container = _split(num_of_crash_workers, num_of_containers)
 
+        num_of_disconnected = _count_affected_devices("disconnect", num_of_clients)
+        disconnected_per_container = _split(num_of_disconnected, num_of_containers)
+
+        num_of_altered = _count_affected_devices("downloadFault", num_of_clients)
+        altered_per_container = _split(num_of_altered, num_of_containers)
+
         return [
-            {"dummyWork": i, "crash": j}
-            for i, j in zip(dummy_workers_per_container, crash_workers_per_container)
+            {"dummyWork": i, "crash": j, "disconnect": k, "downloadFault": m}
+            for i, j, k, m in zip(
+                dummy_workers_per_container,
+                crash_workers_per_container,
+                disconnected_per_container,
+                altered_per_container,
+            )
         ]
 
     def start_devices(self):
@@ -262,6 +274,9 @@ class BaseDevicesHandler(DevicesHandler):
             if exitCode["StatusCode"] == 0:
                 log.info(f"{container.name} finished successfully")
                 self.finished_containers.append(container)
+            elif exitCode["StatusCode"] == ASSERTIONS_FAILED_EXIT_CODE:
+                log.warning(f"{container.name} finished but failed the simulation assertions")
+                self.finished_containers.append(container)
             else:
                 log.info(f"{container.name} ends with error. Exit code: {exitCode}")
 
@@ -337,7 +352,14 @@ class BaseDevicesHandler(DevicesHandler):
         Returns:
             _type_: _description_
         """
-        num_of_devices = data["client"]["numberOfDevices"]
+        if data["client"].get("classes"):
+            # heterogeneous fleet: the devices of each container are split across the classes by the simulator
+            num_of_devices = sum(
+                int(device_class["numberOfDevices"])
+                for device_class in data["client"]["classes"]
+            )
+        else:
+            num_of_devices = data["client"]["numberOfDevices"]
         if num_of_devices <= 0:
             raise Exception(
                 "The number of devices (client.number) must be greater than zero"